@@ -13,6 +13,7 @@ import (
 	"github.com/mattermost/rtcd/service/rtc"
 
 	pluginapi "github.com/mattermost/mattermost-plugin-api"
+	"github.com/mattermost/mattermost-plugin-api/cluster"
 	"github.com/mattermost/mattermost-server/v6/model"
 )
 
@@ -112,6 +113,13 @@ func (p *Plugin) OnActivate() error {
 		}
 		recordingJobRunner = "mattermost/calls-recorder:" + recorderVersion
 
+		// Transcriptions are experimental so a missing runner only disables them.
+		if transcriberVersion, ok := manifest.Props["calls_transcriber_version"].(string); ok {
+			transcriptionJobRunner = "mattermost/calls-transcriber:" + transcriberVersion
+		} else if cfg.transcriptionsEnabled() {
+			p.LogError("failed to get transcriber version from manifest, transcriptions are disabled")
+		}
+
 		go func() {
 			p.LogDebug("updating job runner")
 
@@ -130,7 +138,11 @@ func (p *Plugin) OnActivate() error {
 	}
 
 	if rtcdURL := cfg.getRTCDURL(); rtcdURL != "" && p.licenseChecker.RTCDAllowed() {
-		rtcdManager, err := p.newRTCDClientManager(rtcdURL)
+		p.mut.Lock()
+		p.nodeID = status.ClusterId
+		p.mut.Unlock()
+
+		rtcdManager, err := p.newRTCDClientManager(rtcdPoolConfig{URL: rtcdURL})
 		if err != nil {
 			err = fmt.Errorf("failed to create rtcd manager: %w", err)
 			p.LogError(err.Error())
@@ -141,6 +153,42 @@ func (p *Plugin) OnActivate() error {
 
 		p.rtcdManager = rtcdManager
 
+		p.rtcdPools = map[string]*rtcdClientManager{}
+		for _, poolCfg := range cfg.RTCDPools {
+			m, err := p.newRTCDClientManager(poolCfg)
+			if err != nil {
+				// A failing pool should not prevent calls from working
+				// so we fall back to the default one.
+				p.LogError("failed to create rtcd manager for pool", "pool", poolCfg.Name, "error", err.Error())
+				continue
+			}
+			p.LogDebug("rtcd client manager initialized successfully", "pool", poolCfg.Name)
+			p.rtcdPools[poolCfg.Name] = m
+		}
+
+		if cfg.rtcdFallbackEnabled() {
+			// The embedded server only serves calls started while no rtcd
+			// host is available so failing to start it is not fatal.
+			if rtcServer, err := p.newRTCServer(cfg); err != nil {
+				p.LogError("failed to start fallback rtc server", "error", err.Error())
+			} else {
+				p.mut.Lock()
+				p.rtcServer = rtcServer
+				p.mut.Unlock()
+			}
+		}
+
+		if err := p.startJobs(); err != nil {
+			p.stopRTC()
+			p.LogError(err.Error())
+			return err
+		}
+
+		p.openAuditSink(cfg)
+
+		if p.rtcServer != nil {
+			go p.wsWriter()
+		}
 		go p.clusterEventsHandler()
 
 		p.LogDebug("activated", "ClusterID", status.ClusterId)
@@ -148,6 +196,25 @@ func (p *Plugin) OnActivate() error {
 		return nil
 	}
 
+	rtcServer, err := p.newRTCServer(cfg)
+	if err != nil {
+		p.LogError(err.Error())
+		return err
+	}
+
+	p.mut.Lock()
+	p.nodeID = status.ClusterId
+	p.rtcServer = rtcServer
+	p.mut.Unlock()
+
+	if err := p.startJobs(); err != nil {
+		p.stopRTC()
+		p.LogError(err.Error())
+		return err
+	}
+
+	p.openAuditSink(cfg)
+
 	if os.Getenv("MM_CALLS_IS_HANDLER") != "" {
 		go func() {
 			p.LogInfo("calls handler, setting state", "clusterID", status.ClusterId)
@@ -171,6 +238,96 @@ func (p *Plugin) OnActivate() error {
 		}()
 	}
 
+	go p.clusterEventsHandler()
+	go p.wsWriter()
+	for i := 0; i < webhookWorkers; i++ {
+		go p.webhookWorker()
+	}
+
+	p.LogDebug("activated", "ClusterID", status.ClusterId)
+
+	return nil
+}
+
+// startJobs schedules the cluster jobs. It's called once nothing else can fail
+// during activation so that the jobs never outlive a failed activation.
+func (p *Plugin) startJobs() error {
+	var err error
+
+	p.scheduledCallsJob, err = cluster.Schedule(p.API, scheduledCallsJobKey, cluster.MakeWaitForInterval(scheduledCallsCheckInterval), p.processScheduledCalls)
+	if err != nil {
+		p.stopJobs()
+		return fmt.Errorf("failed to schedule calls reminders job: %w", err)
+	}
+
+	p.recordingsRetentionJob, err = cluster.Schedule(p.API, recordingsRetentionJobKey, cluster.MakeWaitForInterval(recordingsRetentionCheckInterval), p.purgeExpiredRecordings)
+	if err != nil {
+		p.stopJobs()
+		return fmt.Errorf("failed to schedule recordings retention job: %w", err)
+	}
+
+	p.complianceExportJob, err = cluster.Schedule(p.API, complianceExportJobKey, cluster.MakeWaitForInterval(complianceExportInterval), p.runComplianceExport)
+	if err != nil {
+		p.stopJobs()
+		return fmt.Errorf("failed to schedule compliance export job: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Plugin) stopJobs() {
+	for _, job := range []**cluster.Job{&p.scheduledCallsJob, &p.recordingsRetentionJob, &p.complianceExportJob} {
+		if *job == nil {
+			continue
+		}
+		if err := (*job).Close(); err != nil {
+			p.LogError(err.Error())
+		}
+		*job = nil
+	}
+}
+
+// stopRTC releases the rtcd clients and the embedded RTC server.
+func (p *Plugin) stopRTC() {
+	if p.rtcdManager != nil {
+		if err := p.rtcdManager.Close(); err != nil {
+			p.LogError(err.Error())
+		}
+	}
+
+	for _, m := range p.rtcdPools {
+		if err := m.Close(); err != nil {
+			p.LogError(err.Error())
+		}
+	}
+
+	if p.rtcServer != nil {
+		if err := p.rtcServer.Stop(); err != nil {
+			p.LogError(err.Error())
+		}
+	}
+}
+
+// openAuditSink starts audit logging. This is best effort, failing to open the
+// file should not prevent calls from working.
+func (p *Plugin) openAuditSink(cfg *configuration) {
+	path := cfg.AuditLogFile
+	if path == "" {
+		return
+	}
+
+	sink, err := newFileAuditSink(path)
+	if err != nil {
+		p.LogError("failed to open audit log file, audit logging is disabled", "error", err.Error(), "path", path)
+		return
+	}
+
+	p.mut.Lock()
+	p.auditSink = sink
+	p.mut.Unlock()
+}
+
+func (p *Plugin) newRTCServer(cfg *configuration) (*rtc.Server, error) {
 	rtcServerConfig := rtc.ServerConfig{
 		ICEAddressUDP:   cfg.UDPServerAddress,
 		ICEPortUDP:      *cfg.UDPServerPort,
@@ -185,49 +342,38 @@ func (p *Plugin) OnActivate() error {
 	}
 	rtcServer, err := rtc.NewServer(rtcServerConfig, newLogger(p), p.metrics.RTCMetrics())
 	if err != nil {
-		p.LogError(err.Error())
-		return err
+		return nil, err
 	}
 
 	if err := rtcServer.Start(); err != nil {
-		p.LogError(err.Error())
-		return err
+		return nil, err
 	}
 
-	p.mut.Lock()
-	p.nodeID = status.ClusterId
-	p.rtcServer = rtcServer
-	p.mut.Unlock()
-
-	go p.clusterEventsHandler()
-	go p.wsWriter()
-
-	p.LogDebug("activated", "ClusterID", status.ClusterId)
-
-	return nil
+	return rtcServer, nil
 }
 
 func (p *Plugin) OnDeactivate() error {
 	p.LogDebug("deactivate")
 	close(p.stopCh)
 
-	if p.rtcdManager != nil {
-		if err := p.rtcdManager.Close(); err != nil {
-			p.LogError(err.Error())
-		}
-	}
+	p.stopJobs()
 
-	if p.rtcServer != nil {
-		if err := p.rtcServer.Stop(); err != nil {
+	p.stopRTC()
+
+	if p.isSingleHandler() {
+		if err := p.cleanUpState(); err != nil {
 			p.LogError(err.Error())
 		}
 	}
 
-	if p.isSingleHandler() {
-		if err := p.cleanUpState(); err != nil {
+	p.mut.Lock()
+	if p.auditSink != nil {
+		if err := p.auditSink.Close(); err != nil {
 			p.LogError(err.Error())
 		}
+		p.auditSink = nil
 	}
+	p.mut.Unlock()
 
 	if err := p.unregisterCommands(); err != nil {
 		p.LogError(err.Error())
@@ -0,0 +1,154 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var adminCallEndRE = regexp.MustCompile(`^\/admin\/calls\/([a-z0-9]+)\/end$`)
+
+// adminCallInfo is the summary of a live call as shown to system admins.
+type adminCallInfo struct {
+	ID           string                `json:"id"`
+	ChannelID    string                `json:"channel_id"`
+	ChannelName  string                `json:"channel_name"`
+	ChannelType  model.ChannelType     `json:"channel_type"`
+	TeamID       string                `json:"team_id"`
+	StartAt      int64                 `json:"start_at"`
+	Duration     int64                 `json:"duration"`
+	Participants int                   `json:"participants"`
+	OwnerID      string                `json:"owner_id"`
+	HostID       string                `json:"host_id"`
+	RTCDHost     string                `json:"rtcd_host,omitempty"`
+	RTCDPool     string                `json:"rtcd_pool,omitempty"`
+	Recording    *RecordingStateClient `json:"recording,omitempty"`
+}
+
+func newAdminCallInfo(channelID string, call *callState, now int64) adminCallInfo {
+	info := adminCallInfo{
+		ID:           call.ID,
+		ChannelID:    channelID,
+		StartAt:      call.StartAt,
+		Duration:     now - call.StartAt,
+		Participants: len(call.Users),
+		OwnerID:      call.OwnerID,
+		HostID:       call.HostID,
+		RTCDHost:     call.RTCDHost,
+		RTCDPool:     call.RTCDPool,
+	}
+	if call.Recording != nil {
+		rec := call.Recording.RecordingStateClient
+		info.Recording = &rec
+	}
+	return info
+}
+
+// sortAdminCalls orders calls from the longest running to the most recent.
+func sortAdminCalls(calls []adminCallInfo) {
+	sort.SliceStable(calls, func(i, j int) bool {
+		return calls[i].StartAt < calls[j].StartAt
+	})
+}
+
+func (p *Plugin) handleGetAdminCalls(w http.ResponseWriter, r *http.Request) {
+	var res httpResponse
+	defer p.httpAudit("handleGetAdminCalls", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	calls := []adminCallInfo{}
+	now := time.Now().UnixMilli()
+	perPage := 200
+	for page := 0; ; page++ {
+		p.metrics.IncStoreOp("KVList")
+		channelIDs, appErr := p.API.KVList(page, perPage)
+		if appErr != nil {
+			res.Err = appErr.Error()
+			res.Code = http.StatusInternalServerError
+			return
+		}
+
+		for _, channelID := range channelIDs {
+			if len(channelID) != 26 {
+				continue
+			}
+
+			state, err := p.kvGetChannelState(channelID)
+			if err != nil {
+				p.LogError(err.Error())
+				continue
+			}
+			if state == nil || state.Call == nil || state.Call.EndAt > 0 {
+				continue
+			}
+
+			info := newAdminCallInfo(channelID, state.Call, now)
+			if channel, appErr := p.API.GetChannel(channelID); appErr != nil {
+				p.LogError("failed to get channel", "channelID", channelID, "err", appErr.Error())
+			} else {
+				info.ChannelName = channel.DisplayName
+				info.ChannelType = channel.Type
+				info.TeamID = channel.TeamId
+			}
+			calls = append(calls, info)
+		}
+
+		if len(channelIDs) < perPage {
+			break
+		}
+	}
+
+	sortAdminCalls(calls)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(calls); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+func (p *Plugin) handleAdminEndCall(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handleAdminEndCall", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	state, err := p.kvGetChannelState(channelID)
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	if state == nil || state.Call == nil {
+		res.Err = "no call ongoing"
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if err := p.endCall(channelID, state.Call.ID, userID); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
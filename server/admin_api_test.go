@@ -0,0 +1,65 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAdminCallInfo(t *testing.T) {
+	call := &callState{
+		ID:      "callID",
+		StartAt: 1000,
+		Users: map[string]*userState{
+			"userA": {},
+			"userB": {},
+		},
+		OwnerID:  "userA",
+		HostID:   "userB",
+		RTCDHost: "10.0.0.1",
+		RTCDPool: "eu",
+	}
+
+	info := newAdminCallInfo("channelID", call, 61000)
+	require.Equal(t, adminCallInfo{
+		ID:           "callID",
+		ChannelID:    "channelID",
+		StartAt:      1000,
+		Duration:     60000,
+		Participants: 2,
+		OwnerID:      "userA",
+		HostID:       "userB",
+		RTCDHost:     "10.0.0.1",
+		RTCDPool:     "eu",
+	}, info)
+
+	call.Recording = &recordingState{
+		ID: "recID",
+		RecordingStateClient: RecordingStateClient{
+			InitAt:  2000,
+			StartAt: 3000,
+		},
+	}
+	info = newAdminCallInfo("channelID", call, 61000)
+	require.Equal(t, &RecordingStateClient{
+		InitAt:  2000,
+		StartAt: 3000,
+	}, info.Recording)
+
+	// The returned info should not share the recording state.
+	call.Recording.EndAt = 4000
+	require.Zero(t, info.Recording.EndAt)
+}
+
+func TestSortAdminCalls(t *testing.T) {
+	calls := []adminCallInfo{
+		{ID: "c", StartAt: 300},
+		{ID: "a", StartAt: 100},
+		{ID: "b", StartAt: 200},
+	}
+	sortAdminCalls(calls)
+	require.Equal(t, []string{"a", "b", "c"}, []string{calls[0].ID, calls[1].ID, calls[2].ID})
+}
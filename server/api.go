@@ -5,6 +5,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
@@ -26,6 +27,12 @@ var callEndRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)\/end$`)
 
 const requestBodyMaxSizeBytes = 1024 * 1024 // 1MB
 
+// emptyCallTimeout is how long a call started without participants is kept
+// around waiting for someone to join.
+const emptyCallTimeout = 5 * time.Minute
+
+var errCallOngoing = errors.New("call is already ongoing")
+
 func (p *Plugin) handleGetVersion(w http.ResponseWriter, r *http.Request) {
 	info := map[string]interface{}{
 		"version": manifest.Version,
@@ -59,6 +66,7 @@ func (p *Plugin) handleGetChannel(w http.ResponseWriter, r *http.Request, channe
 
 	if state != nil {
 		info.Enabled = state.Enabled
+		info.Lobby = state.Lobby
 		// This is for backwards compatibility for mobile pre-v2
 		if info.Enabled == nil && mobile && !postGA {
 			cfg := p.getConfiguration()
@@ -150,6 +158,7 @@ func (p *Plugin) handleGetAllChannels(w http.ResponseWriter, r *http.Request) {
 			info := ChannelStateClient{
 				ChannelID: channelID,
 				Enabled:   enabled,
+				Lobby:     state.Lobby,
 			}
 			if state.Call != nil {
 				info.Call = state.Call.getClientState(p.getBotID())
@@ -197,8 +206,19 @@ func (p *Plugin) handleEndCall(w http.ResponseWriter, r *http.Request, channelID
 		return
 	}
 
-	callID := state.Call.ID
+	if err := p.endCall(channelID, state.Call.ID, userID); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
 
+// endCall marks the given call as ended and notifies its participants. If the
+// call doesn't end cleanly in a few seconds its state gets forcibly cleaned up.
+func (p *Plugin) endCall(channelID, callID, userID string) error {
 	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
 		if state == nil || state.Call == nil {
 			return nil, nil
@@ -214,9 +234,7 @@ func (p *Plugin) handleEndCall(w http.ResponseWriter, r *http.Request, channelID
 
 		return state, nil
 	}); err != nil {
-		res.Err = err.Error()
-		res.Code = http.StatusForbidden
-		return
+		return err
 	}
 
 	p.publishWebSocketEvent(wsEventCallEnd, map[string]interface{}{}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
@@ -246,18 +264,105 @@ func (p *Plugin) handleEndCall(w http.ResponseWriter, r *http.Request, channelID
 		}
 
 		for connID := range state.Call.Sessions {
-			if err := p.closeRTCSession(userID, connID, channelID, state.NodeID); err != nil {
+			if err := p.closeRTCSession(userID, connID, channelID, state.NodeID, p.isRTCDCall(state)); err != nil {
 				p.LogError(err.Error())
 			}
 		}
 
-		if err := p.cleanCallState(channelID); err != nil {
+		if err := p.cleanCallState(channelID, callEndReasonForced); err != nil {
 			p.LogError(err.Error())
 		}
 	}()
 
-	res.Code = http.StatusOK
-	res.Msg = "success"
+	return nil
+}
+
+// startCall starts a call in the channel on behalf of the given user without
+// them joining it. The call is ended if nobody joins it in time.
+func (p *Plugin) startCall(channel *model.Channel, userID, title, threadID string) (*callState, error) {
+	if channel.DeleteAt > 0 {
+		return nil, fmt.Errorf("cannot start call in archived channel")
+	}
+
+	if err := p.validateCallThread(channel.Id, threadID); err != nil {
+		return nil, err
+	}
+
+	var call *callState
+	var rtc rtcAssignment
+	if err := p.kvSetAtomicChannelState(channel.Id, func(state *channelState) (*channelState, error) {
+		if state == nil {
+			state = &channelState{}
+		}
+
+		if state.Call != nil {
+			return nil, errCallOngoing
+		}
+
+		if !p.userCanStartOrJoin(userID, channel.Id, state) {
+			return nil, fmt.Errorf("calls are not enabled")
+		}
+
+		var err error
+		if rtc, err = p.initCall(state, channel, userID); err != nil {
+			return nil, err
+		}
+		call = state.Call
+
+		return state, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	p.recordRTCAssignment(rtc)
+
+	p.track(evCallStarted, map[string]interface{}{
+		"CallID":      call.ID,
+		"ChannelID":   channel.Id,
+		"ChannelType": channel.Type,
+	})
+
+	postID, threadID, err := p.startCallPost(userID, channel.Id, call.StartAt, title, threadID)
+	if err != nil {
+		p.LogError(err.Error())
+	}
+	call.PostID = postID
+	call.ThreadID = threadID
+
+	p.onCallStarted(channel.Id, call, userID, postID, threadID)
+
+	if p.getConfiguration().ringingEnabled() && shouldRing(channel) {
+		p.startRinging(channel, call, userID, postID)
+	}
+
+	go p.endCallIfEmpty(channel.Id, call.ID, emptyCallTimeout)
+
+	return call, nil
+}
+
+// endCallIfEmpty ends the call if nobody has joined it once the timeout
+// expires.
+func (p *Plugin) endCallIfEmpty(channelID, callID string, timeout time.Duration) {
+	select {
+	case <-time.After(timeout):
+	case <-p.stopCh:
+		return
+	}
+
+	state, err := p.kvGetChannelState(channelID)
+	if err != nil {
+		p.LogError(err.Error())
+		return
+	}
+	if state == nil || state.Call == nil || state.Call.ID != callID || len(state.Call.Users) > 0 {
+		return
+	}
+
+	p.LogInfo("nobody joined the call, ending it", "channelID", channelID, "callID", callID)
+
+	if err := p.endCall(channelID, callID, ""); err != nil {
+		p.LogError(err.Error())
+	}
 }
 
 func (p *Plugin) handleServeStandalone(w http.ResponseWriter, r *http.Request) {
@@ -345,7 +450,14 @@ func (p *Plugin) handlePostChannel(w http.ResponseWriter, r *http.Request, chann
 		if state == nil {
 			state = &channelState{}
 		}
-		state.Enabled = info.Enabled
+		// Settings are applied independently so that lobby mode can be
+		// toggled on its own without affecting whether calls are enabled.
+		if info.setsEnabled() {
+			state.Enabled = info.Enabled
+		}
+		if info.Lobby != nil {
+			state.Lobby = info.Lobby
+		}
 		return state, nil
 	}); err != nil {
 		// handle creation case
@@ -354,14 +466,22 @@ func (p *Plugin) handlePostChannel(w http.ResponseWriter, r *http.Request, chann
 		return
 	}
 
-	var evType string
-	if info.Enabled != nil && *info.Enabled {
-		evType = "channel_enable_voice"
-	} else {
-		evType = "channel_disable_voice"
+	if info.Lobby != nil {
+		p.publishWebSocketEvent(wsEventChannelLobbyChanged, map[string]interface{}{
+			"lobby": *info.Lobby,
+		}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
 	}
 
-	p.publishWebSocketEvent(evType, nil, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+	if info.setsEnabled() {
+		evType := "channel_disable_voice"
+		auditEvent := auditEventChannelDisabled
+		if info.Enabled != nil && *info.Enabled {
+			evType = "channel_enable_voice"
+			auditEvent = auditEventChannelEnabled
+		}
+		p.publishWebSocketEvent(evType, nil, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+		p.audit(auditEvent, channelID, "", userID, nil)
+	}
 
 	if err := json.NewEncoder(w).Encode(info); err != nil {
 		p.LogError(err.Error())
@@ -490,6 +610,11 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if strings.HasPrefix(r.URL.Path, "/plugin/") {
+		p.handlePluginAPI(w, r)
+		return
+	}
+
 	userID := r.Header.Get("Mattermost-User-Id")
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -524,6 +649,31 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 			return
 		}
 
+		if r.URL.Path == "/calls/history" {
+			p.handleGetCallHistory(w, r)
+			return
+		}
+
+		if r.URL.Path == "/admin/calls" {
+			p.handleGetAdminCalls(w, r)
+			return
+		}
+
+		if r.URL.Path == "/admin/compliance/export" {
+			p.handleGetComplianceExport(w, r)
+			return
+		}
+
+		if r.URL.Path == "/admin/webhooks/deliveries" {
+			p.handleGetWebhookDeliveries(w, r)
+			return
+		}
+
+		if r.URL.Path == "/rtcd/hosts" {
+			p.handleGetRTCDHosts(w, r)
+			return
+		}
+
 		if r.URL.Path == "/turn-credentials" {
 			p.handleGetTURNCredentials(w, r)
 			return
@@ -534,6 +684,16 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 			return
 		}
 
+		if matches := channelPolicyRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handleGetChannelPolicy(w, r, matches[1])
+			return
+		}
+
+		if matches := callScheduledRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handleGetScheduledCalls(w, r, matches[1])
+			return
+		}
+
 		if matches := jobsRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
 			p.handleGetJob(w, r, matches[1])
 			return
@@ -559,11 +719,36 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 			return
 		}
 
+		if matches := channelPolicyRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handlePostChannelPolicy(w, r, matches[1])
+			return
+		}
+
 		if matches := callEndRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
 			p.handleEndCall(w, r, matches[1])
 			return
 		}
 
+		if matches := callStartRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handleStartCall(w, r, matches[1])
+			return
+		}
+
+		if matches := callInviteRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handleInviteToCall(w, r, matches[1])
+			return
+		}
+
+		if matches := callInviteActionRE.FindStringSubmatch(r.URL.Path); len(matches) == 3 {
+			p.handlePostInviteAction(w, r, matches[1], matches[2])
+			return
+		}
+
+		if matches := callRingingActionRE.FindStringSubmatch(r.URL.Path); len(matches) == 3 {
+			p.handleRingingAction(w, r, matches[1], matches[2])
+			return
+		}
+
 		if r.URL.Path == "/telemetry/track" {
 			p.handleTrackEvent(w, r)
 			return
@@ -573,6 +758,38 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 			p.handleRecordingAction(w, r, matches[1], matches[2])
 			return
 		}
+
+		if matches := callScheduledRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handlePostScheduledCall(w, r, matches[1])
+			return
+		}
+
+		if matches := callHostRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handlePostCallHost(w, r, matches[1])
+			return
+		}
+
+		if matches := callHostActionRE.FindStringSubmatch(r.URL.Path); len(matches) == 3 {
+			p.handleHostActionRequest(w, r, matches[1], matches[2])
+			return
+		}
+
+		if matches := adminCallEndRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handleAdminEndCall(w, r, matches[1])
+			return
+		}
+
+		if matches := rtcdHostActionRE.FindStringSubmatch(r.URL.Path); len(matches) == 3 {
+			p.handleRTCDHostAction(w, r, matches[1], matches[2])
+			return
+		}
+	}
+
+	if r.Method == http.MethodDelete {
+		if matches := callScheduledIDRE.FindStringSubmatch(r.URL.Path); len(matches) == 3 {
+			p.handleDeleteScheduledCall(w, r, matches[1], matches[2])
+			return
+		}
 	}
 
 	http.NotFound(w, r)
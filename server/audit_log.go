@@ -0,0 +1,97 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// The call lifecycle events recorded in the audit log.
+const (
+	auditEventCallStarted       = "call_started"
+	auditEventCallEnded         = "call_ended"
+	auditEventParticipantJoined = "participant_joined"
+	auditEventParticipantLeft   = "participant_left"
+	auditEventHostChanged       = "host_changed"
+	auditEventRecordingStarted  = "recording_started"
+	auditEventRecordingStopped  = "recording_stopped"
+	auditEventChannelEnabled    = "channel_enabled"
+	auditEventChannelDisabled   = "channel_disabled"
+)
+
+type auditRecord struct {
+	Timestamp int64                  `json:"timestamp"`
+	Event     string                 `json:"event"`
+	NodeID    string                 `json:"node_id"`
+	ChannelID string                 `json:"channel_id"`
+	CallID    string                 `json:"call_id,omitempty"`
+	UserID    string                 `json:"user_id,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// auditSink writes audit records as JSON lines.
+type auditSink struct {
+	mut sync.Mutex
+	w   io.WriteCloser
+}
+
+func newAuditSink(w io.WriteCloser) *auditSink {
+	return &auditSink{w: w}
+}
+
+func newFileAuditSink(path string) (*auditSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log file: %w", err)
+	}
+	return newAuditSink(f), nil
+}
+
+func (s *auditSink) Write(rec auditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	_, err = s.w.Write(data)
+	return err
+}
+
+func (s *auditSink) Close() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.w.Close()
+}
+
+// audit records a call lifecycle event if the audit log is enabled.
+func (p *Plugin) audit(event, channelID, callID, userID string, data map[string]interface{}) {
+	p.mut.RLock()
+	sink := p.auditSink
+	nodeID := p.nodeID
+	p.mut.RUnlock()
+
+	if sink == nil {
+		return
+	}
+
+	if err := sink.Write(auditRecord{
+		Timestamp: time.Now().UnixMilli(),
+		Event:     event,
+		NodeID:    nodeID,
+		ChannelID: channelID,
+		CallID:    callID,
+		UserID:    userID,
+		Data:      data,
+	}); err != nil {
+		p.LogError("failed to write audit record", "event", event, "err", err.Error())
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls_audit.jsonl")
+
+	sink, err := newFileAuditSink(path)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Write(auditRecord{
+		Timestamp: 100,
+		Event:     auditEventCallStarted,
+		ChannelID: "channelID",
+		CallID:    "callID",
+		UserID:    "userA",
+		Data:      map[string]interface{}{"host_id": "userA"},
+	}))
+	require.NoError(t, sink.Write(auditRecord{
+		Timestamp: 200,
+		Event:     auditEventParticipantJoined,
+		ChannelID: "channelID",
+		CallID:    "callID",
+		UserID:    "userB",
+	}))
+	require.NoError(t, sink.Close())
+
+	// Records are appended to existing files.
+	sink, err = newFileAuditSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(auditRecord{
+		Timestamp: 300,
+		Event:     auditEventCallEnded,
+		ChannelID: "channelID",
+		CallID:    "callID",
+	}))
+	require.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec auditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, records, 3)
+	require.Equal(t, auditEventCallStarted, records[0].Event)
+	require.Equal(t, "userA", records[0].Data["host_id"])
+	require.Equal(t, auditEventParticipantJoined, records[1].Event)
+	require.Equal(t, "userB", records[1].UserID)
+	require.Equal(t, auditEventCallEnded, records[2].Event)
+	require.Equal(t, int64(300), records[2].Timestamp)
+}
@@ -6,7 +6,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"io"
 	"net/http"
 	"regexp"
 	"time"
@@ -18,6 +18,9 @@ var botChRE = regexp.MustCompile(`^\/bot\/channels\/([a-z0-9]+)$`)
 var botUserImageRE = regexp.MustCompile(`^\/bot\/users\/([a-z0-9]+)\/image$`)
 var botUploadsRE = regexp.MustCompile(`^\/bot\/uploads\/?([a-z0-9]+)?$`)
 var botRecordingsRE = regexp.MustCompile(`^\/bot\/calls\/([a-z0-9]+)\/recordings$`)
+var botRecordingFileRE = regexp.MustCompile(`^\/bot\/calls\/([a-z0-9]+)\/recordings\/([a-z0-9]+)$`)
+var botTranscriptionsRE = regexp.MustCompile(`^\/bot\/calls\/([a-z0-9]+)\/transcriptions$`)
+var botRecordingRE = regexp.MustCompile(`^\/bot\/calls\/([a-z0-9]+)\/recording$`)
 
 func (p *Plugin) getBotID() string {
 	if p.botSession != nil {
@@ -164,6 +167,32 @@ func (p *Plugin) handleBotCreateUpload(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleBotGetRecording returns the state of the ongoing recording, including
+// its pause intervals, so that the recorder can sync up after (re)connecting.
+func (p *Plugin) handleBotGetRecording(w http.ResponseWriter, r *http.Request, callID string) {
+	var res httpResponse
+	defer p.httpAudit("handleBotGetRecording", &res, w, r)
+
+	state, err := p.kvGetChannelState(callID)
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	recState, err := state.getRecording()
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusNotFound
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(recState.getClientState()); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
 func (p *Plugin) handleBotPostRecordings(w http.ResponseWriter, r *http.Request, callID string) {
 	var res httpResponse
 	defer p.httpAudit("handleBotPostRecordings", &res, w, r)
@@ -189,7 +218,6 @@ func (p *Plugin) handleBotPostRecordings(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// Update call post
 	post, appErr := p.API.GetPost(postID)
 	if appErr != nil {
 		res.Err = "failed to get call post: " + appErr.Error()
@@ -197,46 +225,69 @@ func (p *Plugin) handleBotPostRecordings(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	threadID := post.Id
+	// Recordings are only visible to their creator until published.
+	if err := p.shareRecordingWithCreator(callID, post, fileID); err != nil {
+		res.Err = "failed to share recording: " + err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
 
-	// Post in thread
-	if post.RootId != "" {
-		threadID = post.RootId
+// handleBotGetRecordingFile streams a recording file of the call to the
+// transcription job.
+func (p *Plugin) handleBotGetRecordingFile(w http.ResponseWriter, r *http.Request, callID, fileID string) {
+	info, appErr := p.API.GetFileInfo(fileID)
+	if appErr != nil || info.ChannelId != callID {
+		http.NotFound(w, r)
+		return
 	}
 
-	recordings, ok := post.GetProp("recording_files").([]interface{})
-	if !ok {
-		recordings = []interface{}{
-			fileID,
-		}
-	} else {
-		recordings = append(recordings, fileID)
+	file, err := p.openFile(info.Path)
+	if err != nil {
+		p.LogError("failed to open recording file", "err", err.Error(), "fileID", fileID)
+		http.Error(w, "failed to open recording file", http.StatusInternalServerError)
+		return
 	}
-	post.AddProp("recording_files", recordings)
-	_, appErr = p.API.UpdatePost(post)
-	if appErr != nil {
-		res.Err = "failed to update call thread: " + appErr.Error()
-		res.Code = http.StatusInternalServerError
+	defer file.Close()
+
+	w.Header().Set("Content-Type", info.MimeType)
+	if _, err := io.Copy(w, file); err != nil {
+		p.LogError("failed to send recording file", "err", err.Error(), "fileID", fileID)
+	}
+}
+
+func (p *Plugin) handleBotPostTranscriptions(w http.ResponseWriter, r *http.Request, callID string) {
+	var res httpResponse
+	defer p.httpAudit("handleBotPostTranscriptions", &res, w, r)
+
+	var info struct {
+		PostID          string              `json:"post_id"`
+		RecordingFileID string              `json:"recording_file_id"`
+		Segments        []transcriptSegment `json:"segments"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, transcriptionMaxSizeBytes)).Decode(&info); err != nil {
+		res.Err = "failed to decode request body: " + err.Error()
+		res.Code = http.StatusBadRequest
 		return
 	}
 
-	startAt, _ := post.GetProp("start_at").(int64)
-	postMsg := "Here's the call recording"
-	if title, _ := post.GetProp("title").(string); title != "" {
-		postMsg = fmt.Sprintf("%s of %s at %s UTC", postMsg, title, time.UnixMilli(startAt).Format("3:04PM"))
+	if info.PostID == "" {
+		res.Err = "missing post_id from request body"
+		res.Code = http.StatusBadRequest
+		return
 	}
-	post = &model.Post{
-		UserId:    p.getBotID(),
-		ChannelId: callID,
-		Message:   postMsg,
-		Type:      "custom_calls_recording",
-		RootId:    threadID,
-		FileIds:   []string{fileID},
+
+	if info.RecordingFileID == "" {
+		res.Err = "missing recording_file_id from request body"
+		res.Code = http.StatusBadRequest
+		return
 	}
 
-	_, appErr = p.API.CreatePost(post)
-	if appErr != nil {
-		res.Err = "failed to create post: " + appErr.Error()
+	if err := p.saveTranscription(callID, info.PostID, info.RecordingFileID, info.Segments); err != nil {
+		res.Err = "failed to save transcription: " + err.Error()
 		res.Code = http.StatusInternalServerError
 		return
 	}
@@ -271,6 +322,16 @@ func (p *Plugin) handleBotAPI(w http.ResponseWriter, r *http.Request) {
 			p.handleBotGetUpload(w, r, matches[1])
 			return
 		}
+
+		if matches := botRecordingFileRE.FindStringSubmatch(r.URL.Path); len(matches) == 3 {
+			p.handleBotGetRecordingFile(w, r, matches[1], matches[2])
+			return
+		}
+
+		if matches := botRecordingRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handleBotGetRecording(w, r, matches[1])
+			return
+		}
 	}
 
 	if r.Method == http.MethodPost {
@@ -286,6 +347,11 @@ func (p *Plugin) handleBotAPI(w http.ResponseWriter, r *http.Request) {
 			p.handleBotPostRecordings(w, r, matches[1])
 			return
 		}
+
+		if matches := botTranscriptionsRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handleBotPostTranscriptions(w, r, matches[1])
+			return
+		}
 	}
 
 	http.NotFound(w, r)
@@ -0,0 +1,696 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	callHistoryKeyPrefix      = "callhistory_"
+	callHistoryIndexKeyPrefix = "callhistory_idx_"
+	// The index of a channel is sharded by the month its calls started in so
+	// that no single value grows without bounds.
+	callHistoryIndexShardKeyPrefix = "callhistory_idxshard_"
+	callHistoryIndexShardLayout    = "200601"
+	// Ended calls are indexed across all channels, sharded by the day they
+	// ended in, so that exports don't need to go through every channel.
+	callHistoryEndedIndexKey       = "callhistory_ended_idx"
+	callHistoryEndedShardKeyPrefix = "callhistory_ended_"
+	callHistoryEndedShardLayout    = "20060102"
+	callHistoryDefaultPerPage      = 60
+	callHistoryMaxPerPage          = 200
+)
+
+type callHistoryParticipant struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	JoinAt    int64  `json:"join_at"`
+	LeaveAt   int64  `json:"leave_at"`
+	// Quality is the summary of the stats sent by the participant's client.
+	Quality *callQualitySummary `json:"quality,omitempty"`
+}
+
+type callHistoryHostChange struct {
+	HostID string `json:"host_id"`
+	At     int64  `json:"at"`
+}
+
+type callHistoryRecording struct {
+	ID        string   `json:"id"`
+	JobID     string   `json:"job_id"`
+	CreatorID string   `json:"creator_id"`
+	FileIDs   []string `json:"file_ids,omitempty"`
+	RecordingStateClient
+}
+
+// callHistory is the durable record of a call. Contrary to callState it's
+// kept in the store after the call has ended.
+type callHistory struct {
+	ID           string                   `json:"id"`
+	ChannelID    string                   `json:"channel_id"`
+	StartAt      int64                    `json:"start_at"`
+	EndAt        int64                    `json:"end_at"`
+	OwnerID      string                   `json:"owner_id"`
+	ThreadID     string                   `json:"thread_id"`
+	PostID       string                   `json:"post_id"`
+	Participants []callHistoryParticipant `json:"participants"`
+	HostChanges  []callHistoryHostChange  `json:"host_changes"`
+	Recordings   []callHistoryRecording   `json:"recordings"`
+	Stats        callStats                `json:"stats"`
+	// Quality aggregates the stats sent by all the participants' clients.
+	Quality *callQualitySummary `json:"quality,omitempty"`
+}
+
+type callHistoryIndexEntry struct {
+	ID      string `json:"id"`
+	StartAt int64  `json:"start_at"`
+}
+
+type callHistoryEndedEntry struct {
+	ID    string `json:"id"`
+	EndAt int64  `json:"end_at"`
+}
+
+func (h *callHistory) addParticipant(userID, sessionID string, joinAt int64) {
+	h.Participants = append(h.Participants, callHistoryParticipant{
+		UserID:    userID,
+		SessionID: sessionID,
+		JoinAt:    joinAt,
+	})
+}
+
+func (h *callHistory) setParticipantLeft(userID, sessionID string, leaveAt int64, quality callQualitySummary) {
+	if i := h.getActiveParticipant(userID, sessionID); i >= 0 {
+		h.Participants[i].LeaveAt = leaveAt
+		h.addParticipantQuality(i, quality)
+	}
+}
+
+// getActiveParticipant returns the index of the given participant's session
+// if it hasn't left yet, -1 otherwise.
+func (h *callHistory) getActiveParticipant(userID, sessionID string) int {
+	for i := len(h.Participants) - 1; i >= 0; i-- {
+		if h.Participants[i].UserID == userID && h.Participants[i].SessionID == sessionID && h.Participants[i].LeaveAt == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// addParticipantQuality merges the quality stats of a session into the ones
+// of the participant and the call. A session can be flushed multiple times
+// as it moves across nodes on reconnect.
+func (h *callHistory) addParticipantQuality(i int, quality callQualitySummary) {
+	if quality.Samples == 0 {
+		return
+	}
+	if h.Participants[i].Quality == nil {
+		h.Participants[i].Quality = &callQualitySummary{}
+	}
+	h.Participants[i].Quality.merge(quality)
+	if h.Quality == nil {
+		h.Quality = &callQualitySummary{}
+	}
+	h.Quality.merge(quality)
+}
+
+func (h *callHistory) addHostChange(hostID string, at int64) {
+	if n := len(h.HostChanges); n > 0 && h.HostChanges[n-1].HostID == hostID {
+		return
+	}
+	h.HostChanges = append(h.HostChanges, callHistoryHostChange{
+		HostID: hostID,
+		At:     at,
+	})
+}
+
+func (h *callHistory) setRecording(rec callHistoryRecording) {
+	for i := range h.Recordings {
+		if h.Recordings[i].ID == rec.ID {
+			// Files are only known once uploaded so we keep them.
+			if rec.FileIDs == nil {
+				rec.FileIDs = h.Recordings[i].FileIDs
+			}
+			h.Recordings[i] = rec
+			return
+		}
+	}
+	h.Recordings = append(h.Recordings, rec)
+}
+
+func (h *callHistory) addRecordingFile(recID, fileID string) {
+	for i := range h.Recordings {
+		if h.Recordings[i].ID == recID {
+			h.Recordings[i].FileIDs = append(h.Recordings[i].FileIDs, fileID)
+			return
+		}
+	}
+	h.Recordings = append(h.Recordings, callHistoryRecording{
+		ID:      recID,
+		FileIDs: []string{fileID},
+	})
+}
+
+// end marks the call as ended, closing any participant session still open.
+func (h *callHistory) end(endAt int64, stats callStats) {
+	if h.EndAt == 0 {
+		h.EndAt = endAt
+	}
+	h.Stats = stats
+	for i := range h.Participants {
+		if h.Participants[i].LeaveAt == 0 {
+			h.Participants[i].LeaveAt = h.EndAt
+		}
+	}
+}
+
+// filterCallHistoryIndex returns the ids of the calls started in the
+// [since, until] range (a zero until means no upper bound), most recent first
+// and paginated.
+func filterCallHistoryIndex(entries []callHistoryIndexEntry, since, until int64, page, perPage int) []string {
+	filtered := make([]callHistoryIndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.StartAt < since || (until > 0 && entry.StartAt > until) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].StartAt > filtered[j].StartAt
+	})
+
+	ids := []string{}
+	for i := page * perPage; i < len(filtered) && i < (page+1)*perPage; i++ {
+		ids = append(ids, filtered[i].ID)
+	}
+
+	return ids
+}
+
+func (p *Plugin) kvGetCallHistory(callID string) (*callHistory, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(callHistoryKeyPrefix + callID)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var history *callHistory
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// callHistoryIndexShard returns the index shard of a call started at the
+// given time.
+func callHistoryIndexShard(startAt int64) string {
+	return time.UnixMilli(startAt).UTC().Format(callHistoryIndexShardLayout)
+}
+
+func callHistoryIndexShardKey(channelID, shard string) string {
+	return callHistoryIndexShardKeyPrefix + channelID + "_" + shard
+}
+
+// filterCallHistoryIndexShards returns the shards that can hold calls started
+// in the [since, until] range (a zero until means no upper bound), most recent
+// first.
+func filterCallHistoryIndexShards(shards []string, since, until int64) []string {
+	filtered := make([]string, 0, len(shards))
+	for _, shard := range shards {
+		start, err := time.Parse(callHistoryIndexShardLayout, shard)
+		if err != nil {
+			continue
+		}
+		if start.AddDate(0, 1, 0).UnixMilli() <= since || (until > 0 && start.UnixMilli() > until) {
+			continue
+		}
+		filtered = append(filtered, shard)
+	}
+
+	// The layout sorts lexicographically.
+	sort.Sort(sort.Reverse(sort.StringSlice(filtered)))
+
+	return filtered
+}
+
+// kvGetCallHistoryIndexShards returns the index shards of the channel.
+func (p *Plugin) kvGetCallHistoryIndexShards(channelID string) ([]string, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(callHistoryIndexKeyPrefix + channelID)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var shards []string
+	if err := json.Unmarshal(data, &shards); err != nil {
+		return nil, err
+	}
+	return shards, nil
+}
+
+func (p *Plugin) kvGetCallHistoryIndexShard(channelID, shard string) ([]callHistoryIndexEntry, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(callHistoryIndexShardKey(channelID, shard))
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var entries []callHistoryIndexEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// getCallHistoryIDs returns the ids of the calls started in the channel in
+// the [since, until] range, most recent first and paginated. Only the shards
+// needed to fill the requested page are read.
+func (p *Plugin) getCallHistoryIDs(channelID string, since, until int64, page, perPage int) ([]string, error) {
+	shards, err := p.kvGetCallHistoryIndexShards(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []callHistoryIndexEntry
+	var count int
+	for _, shard := range filterCallHistoryIndexShards(shards, since, until) {
+		shardEntries, err := p.kvGetCallHistoryIndexShard(channelID, shard)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, shardEntries...)
+
+		// Shards don't overlap so any remaining entry would come after the
+		// requested page.
+		for _, entry := range shardEntries {
+			if entry.StartAt >= since && (until == 0 || entry.StartAt <= until) {
+				count++
+			}
+		}
+		if count >= (page+1)*perPage {
+			break
+		}
+	}
+
+	return filterCallHistoryIndex(entries, since, until, page, perPage), nil
+}
+
+// kvSetAtomicCallHistory updates the history record for the given call. The
+// record gets created if missing since events can be processed out of order
+// across nodes.
+func (p *Plugin) kvSetAtomicCallHistory(callID, channelID string, cb func(history *callHistory) error) error {
+	return p.kvSetAtomic(callHistoryKeyPrefix+callID, func(data []byte) ([]byte, error) {
+		var history *callHistory
+		if data != nil {
+			if err := json.Unmarshal(data, &history); err != nil {
+				return nil, err
+			}
+		}
+		if history == nil {
+			history = &callHistory{
+				ID:        callID,
+				ChannelID: channelID,
+			}
+		}
+		if err := cb(history); err != nil {
+			return nil, err
+		}
+		return json.Marshal(history)
+	})
+}
+
+func (p *Plugin) addCallHistoryIndexEntry(channelID string, entry callHistoryIndexEntry) error {
+	shard := callHistoryIndexShard(entry.StartAt)
+
+	if err := p.kvSetAtomic(callHistoryIndexShardKey(channelID, shard), func(data []byte) ([]byte, error) {
+		var entries []callHistoryIndexEntry
+		if data != nil {
+			if err := json.Unmarshal(data, &entries); err != nil {
+				return nil, err
+			}
+		}
+		for _, e := range entries {
+			if e.ID == entry.ID {
+				return nil, nil
+			}
+		}
+		return json.Marshal(append(entries, entry))
+	}); err != nil {
+		return err
+	}
+
+	return p.kvSetAtomic(callHistoryIndexKeyPrefix+channelID, func(data []byte) ([]byte, error) {
+		var shards []string
+		if data != nil {
+			if err := json.Unmarshal(data, &shards); err != nil {
+				return nil, err
+			}
+		}
+		for _, s := range shards {
+			if s == shard {
+				return nil, nil
+			}
+		}
+		return json.Marshal(append(shards, shard))
+	})
+}
+
+// filterCallHistoryEndedShards returns the shards that can hold calls ended
+// in the (since, until] range, oldest first.
+func filterCallHistoryEndedShards(shards []string, since, until int64) []string {
+	filtered := make([]string, 0, len(shards))
+	for _, shard := range shards {
+		start, err := time.Parse(callHistoryEndedShardLayout, shard)
+		if err != nil {
+			continue
+		}
+		if start.AddDate(0, 0, 1).UnixMilli() <= since || start.UnixMilli() > until {
+			continue
+		}
+		filtered = append(filtered, shard)
+	}
+
+	sort.Strings(filtered)
+
+	return filtered
+}
+
+func (p *Plugin) kvGetCallHistoryEndedShards() ([]string, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(callHistoryEndedIndexKey)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var shards []string
+	if err := json.Unmarshal(data, &shards); err != nil {
+		return nil, err
+	}
+	return shards, nil
+}
+
+func (p *Plugin) kvGetCallHistoryEndedShard(shard string) ([]callHistoryEndedEntry, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(callHistoryEndedShardKeyPrefix + shard)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var entries []callHistoryEndedEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// getEndedCallIDs returns the ids of the calls that ended in the
+// (since, until] range.
+func (p *Plugin) getEndedCallIDs(since, until int64) ([]string, error) {
+	shards, err := p.kvGetCallHistoryEndedShards()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, shard := range filterCallHistoryEndedShards(shards, since, until) {
+		entries, err := p.kvGetCallHistoryEndedShard(shard)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.EndAt > since && entry.EndAt <= until {
+				ids = append(ids, entry.ID)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+func (p *Plugin) addCallHistoryEndedEntry(entry callHistoryEndedEntry) error {
+	shard := time.UnixMilli(entry.EndAt).UTC().Format(callHistoryEndedShardLayout)
+
+	if err := p.kvSetAtomic(callHistoryEndedShardKeyPrefix+shard, func(data []byte) ([]byte, error) {
+		var entries []callHistoryEndedEntry
+		if data != nil {
+			if err := json.Unmarshal(data, &entries); err != nil {
+				return nil, err
+			}
+		}
+		for _, e := range entries {
+			if e.ID == entry.ID {
+				return nil, nil
+			}
+		}
+		return json.Marshal(append(entries, entry))
+	}); err != nil {
+		return err
+	}
+
+	return p.kvSetAtomic(callHistoryEndedIndexKey, func(data []byte) ([]byte, error) {
+		var shards []string
+		if data != nil {
+			if err := json.Unmarshal(data, &shards); err != nil {
+				return nil, err
+			}
+		}
+		for _, s := range shards {
+			if s == shard {
+				return nil, nil
+			}
+		}
+		return json.Marshal(append(shards, shard))
+	})
+}
+
+func (p *Plugin) initCallHistory(channelID string, call *callState, postID, threadID string) error {
+	if err := p.kvSetAtomicCallHistory(call.ID, channelID, func(history *callHistory) error {
+		history.StartAt = call.StartAt
+		history.OwnerID = call.OwnerID
+		history.PostID = postID
+		history.ThreadID = threadID
+		if call.HostID != "" {
+			history.addHostChange(call.HostID, call.StartAt)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to init call history: %w", err)
+	}
+
+	if err := p.addCallHistoryIndexEntry(channelID, callHistoryIndexEntry{
+		ID:      call.ID,
+		StartAt: call.StartAt,
+	}); err != nil {
+		return fmt.Errorf("failed to add call history index entry: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Plugin) addCallHistoryParticipant(channelID, callID, userID, connID string, joinAt int64) {
+	if p.isBot(userID) {
+		return
+	}
+	if err := p.kvSetAtomicCallHistory(callID, channelID, func(history *callHistory) error {
+		history.addParticipant(userID, connID, joinAt)
+		return nil
+	}); err != nil {
+		p.LogError("failed to add call history participant", "error", err.Error(), "callID", callID, "userID", userID)
+	}
+}
+
+func (p *Plugin) setCallHistoryParticipantLeft(channelID, callID, userID, connID string, quality callQualitySummary) {
+	if p.isBot(userID) {
+		return
+	}
+	if err := p.kvSetAtomicCallHistory(callID, channelID, func(history *callHistory) error {
+		history.setParticipantLeft(userID, connID, time.Now().UnixMilli(), quality)
+		return nil
+	}); err != nil {
+		p.LogError("failed to update call history participant", "error", err.Error(), "callID", callID, "userID", userID)
+	}
+}
+
+// addCallHistoryParticipantQuality records the quality stats a session has
+// collected so far, for when it's about to be handled by a different node.
+func (p *Plugin) addCallHistoryParticipantQuality(channelID, callID, userID, connID string, quality callQualitySummary) {
+	if quality.Samples == 0 {
+		return
+	}
+	if err := p.kvSetAtomicCallHistory(callID, channelID, func(history *callHistory) error {
+		if i := history.getActiveParticipant(userID, connID); i >= 0 {
+			history.addParticipantQuality(i, quality)
+		}
+		return nil
+	}); err != nil {
+		p.LogError("failed to add call history participant quality", "error", err.Error(), "callID", callID, "userID", userID)
+	}
+}
+
+func (p *Plugin) addCallHistoryHostChange(channelID, callID, hostID string) {
+	if err := p.kvSetAtomicCallHistory(callID, channelID, func(history *callHistory) error {
+		history.addHostChange(hostID, time.Now().UnixMilli())
+		return nil
+	}); err != nil {
+		p.LogError("failed to add call history host change", "error", err.Error(), "callID", callID, "hostID", hostID)
+	}
+}
+
+func (p *Plugin) setCallHistoryRecording(channelID, callID string, recState *recordingState) {
+	if recState == nil {
+		return
+	}
+	if err := p.kvSetAtomicCallHistory(callID, channelID, func(history *callHistory) error {
+		history.setRecording(callHistoryRecording{
+			ID:                   recState.ID,
+			JobID:                recState.JobID,
+			CreatorID:            recState.CreatorID,
+			RecordingStateClient: recState.RecordingStateClient,
+		})
+		return nil
+	}); err != nil {
+		p.LogError("failed to set call history recording", "error", err.Error(), "callID", callID, "recID", recState.ID)
+	}
+}
+
+func (p *Plugin) addCallHistoryRecordingFile(channelID, callID, recID, fileID string) {
+	if err := p.kvSetAtomicCallHistory(callID, channelID, func(history *callHistory) error {
+		history.addRecordingFile(recID, fileID)
+		return nil
+	}); err != nil {
+		p.LogError("failed to add call history recording file", "error", err.Error(), "callID", callID, "recID", recID)
+	}
+}
+
+func (p *Plugin) endCallHistory(channelID string, call *callState) {
+	stats := call.Stats
+	if call.ScreenStartAt > 0 {
+		stats.ScreenDuration += secondsSinceTimestamp(call.ScreenStartAt)
+	}
+	var endAt int64
+	if err := p.kvSetAtomicCallHistory(call.ID, channelID, func(history *callHistory) error {
+		if call.Recording != nil {
+			history.setRecording(callHistoryRecording{
+				ID:                   call.Recording.ID,
+				JobID:                call.Recording.JobID,
+				CreatorID:            call.Recording.CreatorID,
+				RecordingStateClient: call.Recording.RecordingStateClient,
+			})
+		}
+		history.end(time.Now().UnixMilli(), stats)
+		endAt = history.EndAt
+		return nil
+	}); err != nil {
+		p.LogError("failed to end call history", "error", err.Error(), "callID", call.ID)
+		return
+	}
+
+	if err := p.addCallHistoryEndedEntry(callHistoryEndedEntry{ID: call.ID, EndAt: endAt}); err != nil {
+		p.LogError("failed to add call history ended entry", "error", err.Error(), "callID", call.ID)
+	}
+}
+
+func (p *Plugin) handleGetCallHistory(w http.ResponseWriter, r *http.Request) {
+	var res httpResponse
+	defer p.httpAudit("handleGetCallHistory", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	query := r.URL.Query()
+
+	channelID := query.Get("channel_id")
+	if channelID == "" {
+		res.Err = "missing channel_id"
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if !p.API.HasPermissionToChannel(userID, channelID, model.PermissionReadChannel) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	var since, until int64
+	var err error
+	if val := query.Get("since"); val != "" {
+		if since, err = strconv.ParseInt(val, 10, 64); err != nil {
+			res.Err = "invalid since parameter"
+			res.Code = http.StatusBadRequest
+			return
+		}
+	}
+	if val := query.Get("until"); val != "" {
+		if until, err = strconv.ParseInt(val, 10, 64); err != nil {
+			res.Err = "invalid until parameter"
+			res.Code = http.StatusBadRequest
+			return
+		}
+	}
+
+	page := 0
+	perPage := callHistoryDefaultPerPage
+	if val := query.Get("page"); val != "" {
+		if page, err = strconv.Atoi(val); err != nil || page < 0 {
+			res.Err = "invalid page parameter"
+			res.Code = http.StatusBadRequest
+			return
+		}
+	}
+	if val := query.Get("per_page"); val != "" {
+		if perPage, err = strconv.Atoi(val); err != nil || perPage <= 0 {
+			res.Err = "invalid per_page parameter"
+			res.Code = http.StatusBadRequest
+			return
+		}
+		if perPage > callHistoryMaxPerPage {
+			perPage = callHistoryMaxPerPage
+		}
+	}
+
+	callIDs, err := p.getCallHistoryIDs(channelID, since, until, page, perPage)
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	calls := []*callHistory{}
+	for _, callID := range callIDs {
+		history, err := p.kvGetCallHistory(callID)
+		if err != nil {
+			res.Err = err.Error()
+			res.Code = http.StatusInternalServerError
+			return
+		}
+		if history == nil {
+			p.LogWarn("call history record is missing", "callID", callID, "channelID", channelID)
+			continue
+		}
+		calls = append(calls, history)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(calls); err != nil {
+		p.LogError(err.Error())
+	}
+}
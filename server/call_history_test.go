@@ -0,0 +1,164 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallHistoryParticipants(t *testing.T) {
+	var h callHistory
+
+	h.addParticipant("userA", "connA", 100)
+	h.addParticipant("userB", "connB", 200)
+	h.setParticipantLeft("userA", "connA", 300, callQualitySummary{})
+	h.addParticipant("userA", "connC", 400)
+	h.setParticipantLeft("userA", "connA", 500, callQualitySummary{})
+
+	require.Equal(t, []callHistoryParticipant{
+		{UserID: "userA", SessionID: "connA", JoinAt: 100, LeaveAt: 300},
+		{UserID: "userB", SessionID: "connB", JoinAt: 200},
+		{UserID: "userA", SessionID: "connC", JoinAt: 400},
+	}, h.Participants)
+
+	h.end(600, callStats{Participants: 2, ScreenDuration: 10})
+	require.Equal(t, int64(600), h.EndAt)
+	require.Equal(t, int64(600), h.Participants[1].LeaveAt)
+	require.Equal(t, int64(600), h.Participants[2].LeaveAt)
+	require.Equal(t, int64(300), h.Participants[0].LeaveAt)
+	require.Equal(t, callStats{Participants: 2, ScreenDuration: 10}, h.Stats)
+
+	// Ending again should not override the end time.
+	h.end(700, h.Stats)
+	require.Equal(t, int64(600), h.EndAt)
+}
+
+func TestCallHistoryHostChanges(t *testing.T) {
+	var h callHistory
+
+	h.addHostChange("userA", 100)
+	h.addHostChange("userA", 200)
+	h.addHostChange("userB", 300)
+
+	require.Equal(t, []callHistoryHostChange{
+		{HostID: "userA", At: 100},
+		{HostID: "userB", At: 300},
+	}, h.HostChanges)
+}
+
+func TestCallHistoryRecordings(t *testing.T) {
+	var h callHistory
+
+	h.setRecording(callHistoryRecording{ID: "recA", RecordingStateClient: RecordingStateClient{InitAt: 100}})
+	h.setRecording(callHistoryRecording{ID: "recB", RecordingStateClient: RecordingStateClient{InitAt: 200}})
+	h.setRecording(callHistoryRecording{ID: "recA", JobID: "jobA", RecordingStateClient: RecordingStateClient{InitAt: 100, EndAt: 150}})
+
+	require.Equal(t, []callHistoryRecording{
+		{ID: "recA", JobID: "jobA", RecordingStateClient: RecordingStateClient{InitAt: 100, EndAt: 150}},
+		{ID: "recB", RecordingStateClient: RecordingStateClient{InitAt: 200}},
+	}, h.Recordings)
+}
+
+func TestFilterCallHistoryIndex(t *testing.T) {
+	entries := []callHistoryIndexEntry{
+		{ID: "callA", StartAt: 100},
+		{ID: "callB", StartAt: 200},
+		{ID: "callC", StartAt: 300},
+		{ID: "callD", StartAt: 400},
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		require.Empty(t, filterCallHistoryIndex(nil, 0, 0, 0, 10))
+	})
+
+	t.Run("no bounds", func(t *testing.T) {
+		require.Equal(t, []string{"callD", "callC", "callB", "callA"}, filterCallHistoryIndex(entries, 0, 0, 0, 10))
+	})
+
+	t.Run("since", func(t *testing.T) {
+		require.Equal(t, []string{"callD", "callC"}, filterCallHistoryIndex(entries, 300, 0, 0, 10))
+	})
+
+	t.Run("until", func(t *testing.T) {
+		require.Equal(t, []string{"callB", "callA"}, filterCallHistoryIndex(entries, 0, 200, 0, 10))
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		require.Equal(t, []string{"callD", "callC"}, filterCallHistoryIndex(entries, 0, 0, 0, 2))
+		require.Equal(t, []string{"callB", "callA"}, filterCallHistoryIndex(entries, 0, 0, 1, 2))
+		require.Empty(t, filterCallHistoryIndex(entries, 0, 0, 2, 2))
+	})
+}
+
+func TestCallHistoryRecordingFiles(t *testing.T) {
+	var h callHistory
+
+	h.setRecording(callHistoryRecording{ID: "recA", RecordingStateClient: RecordingStateClient{InitAt: 100}})
+	h.addRecordingFile("recA", "fileA")
+	h.addRecordingFile("recA", "fileB")
+
+	// Updating the recording state should keep its files.
+	h.setRecording(callHistoryRecording{ID: "recA", JobID: "jobA", RecordingStateClient: RecordingStateClient{InitAt: 100, EndAt: 150}})
+	require.Equal(t, []string{"fileA", "fileB"}, h.Recordings[0].FileIDs)
+	require.Equal(t, "jobA", h.Recordings[0].JobID)
+
+	// Files for unknown recordings are still tracked.
+	h.addRecordingFile("recB", "fileC")
+	require.Len(t, h.Recordings, 2)
+	require.Equal(t, []string{"fileC"}, h.Recordings[1].FileIDs)
+}
+
+func TestFilterCallHistoryIndexShards(t *testing.T) {
+	shards := []string{"202608", "202610", "202609"}
+	at := func(month time.Month, day int) int64 {
+		return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC).UnixMilli()
+	}
+
+	require.Equal(t, "202610", callHistoryIndexShard(at(time.October, 17)))
+	require.Equal(t, []string{"202610", "202609", "202608"}, filterCallHistoryIndexShards(shards, 0, 0))
+	require.Equal(t, []string{"202610", "202609"}, filterCallHistoryIndexShards(shards, at(time.September, 30), 0))
+	require.Equal(t, []string{"202609", "202608"}, filterCallHistoryIndexShards(shards, 0, at(time.September, 1)))
+	require.Empty(t, filterCallHistoryIndexShards(shards, at(time.November, 1), 0))
+}
+
+func TestGetCallHistoryIDs(t *testing.T) {
+	p, _, store := newTestPlugin(t)
+
+	at := func(month time.Month, day int) int64 {
+		return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC).UnixMilli()
+	}
+	require.NoError(t, p.addCallHistoryIndexEntry("channelA", callHistoryIndexEntry{ID: "callA", StartAt: at(time.August, 10)}))
+	require.NoError(t, p.addCallHistoryIndexEntry("channelA", callHistoryIndexEntry{ID: "callB", StartAt: at(time.September, 10)}))
+	require.NoError(t, p.addCallHistoryIndexEntry("channelA", callHistoryIndexEntry{ID: "callC", StartAt: at(time.October, 10)}))
+	require.NoError(t, p.addCallHistoryIndexEntry("channelA", callHistoryIndexEntry{ID: "callD", StartAt: at(time.October, 12)}))
+	// Adding the same entry twice is a no-op.
+	require.NoError(t, p.addCallHistoryIndexEntry("channelA", callHistoryIndexEntry{ID: "callD", StartAt: at(time.October, 12)}))
+
+	require.JSONEq(t, `["202608","202609","202610"]`, string(store.get(callHistoryIndexKeyPrefix+"channelA")))
+	entries, err := p.kvGetCallHistoryIndexShard("channelA", "202610")
+	require.NoError(t, err)
+	require.Equal(t, []callHistoryIndexEntry{
+		{ID: "callC", StartAt: at(time.October, 10)},
+		{ID: "callD", StartAt: at(time.October, 12)},
+	}, entries)
+
+	ids, err := p.getCallHistoryIDs("channelA", 0, 0, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"callD", "callC", "callB", "callA"}, ids)
+
+	ids, err = p.getCallHistoryIDs("channelA", at(time.September, 1), at(time.October, 11), 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"callC", "callB"}, ids)
+
+	ids, err = p.getCallHistoryIDs("channelA", 0, 0, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"callB", "callA"}, ids)
+
+	ids, err = p.getCallHistoryIDs("channelB", 0, 0, 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, ids)
+}
@@ -0,0 +1,363 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var callInviteActionRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)\/invite\/(approve|deny)$`)
+
+var (
+	errNoInvitePermission    = errors.New("no permissions to invite to the call")
+	errNoAddMemberPermission = errors.New("no permissions to add members to the channel")
+	errInviteRequestExpired  = errors.New("invite request has expired")
+)
+
+// inviteRequestTimeout is how long invites to users who are not channel
+// members wait for the host's approval.
+const inviteRequestTimeout = 5 * time.Minute
+
+const (
+	inviteActionApprove = "approve"
+	inviteActionDeny    = "deny"
+)
+
+// inviteRequestState is an invite to a user who is not a member of the call
+// channel, waiting for the host's approval.
+type inviteRequestState struct {
+	InviterID string `json:"inviter_id"`
+	RequestAt int64  `json:"request_at"`
+}
+
+func (s *inviteRequestState) expired(now int64) bool {
+	return now-s.RequestAt >= inviteRequestTimeout.Milliseconds()
+}
+
+type callInviteResult struct {
+	Invited []string `json:"invited"`
+	// The users who are not channel members and need to be approved by the
+	// host first.
+	Pending []string `json:"pending"`
+}
+
+// canInviteToCall returns whether the user can invite others to the call.
+// The owner of the call and its participants can invite others.
+func (p *Plugin) canInviteToCall(userID string, call *callState) bool {
+	if call.OwnerID == userID || call.Users[userID] != nil {
+		return true
+	}
+	return p.API.HasPermissionTo(userID, model.PermissionManageSystem)
+}
+
+// canAddChannelMembers returns whether the user can add members to the
+// channel.
+func (p *Plugin) canAddChannelMembers(userID string, channel *model.Channel) bool {
+	permission := model.PermissionManagePublicChannelMembers
+	if channel.Type == model.ChannelTypePrivate {
+		permission = model.PermissionManagePrivateChannelMembers
+	}
+	return p.API.HasPermissionToChannel(userID, channel.Id, permission)
+}
+
+// inviteUsers invites the given users to the ongoing call in the channel.
+// Channel members are invited right away. If enabled, other users get added
+// to the channel once the host approves them, unless the inviter is the host.
+// Either way the host needs permission to manage the channel's members.
+func (p *Plugin) inviteUsers(inviterID, channelID string, userIDs []string) (callInviteResult, error) {
+	result := callInviteResult{
+		Invited: []string{},
+		Pending: []string{},
+	}
+
+	if err := validateCallInvitees(userIDs); err != nil {
+		return result, err
+	}
+
+	state, err := p.kvGetChannelState(channelID)
+	if err != nil {
+		return result, err
+	}
+	if state == nil || state.Call == nil {
+		return result, fmt.Errorf("no call ongoing")
+	}
+
+	if !p.canInviteToCall(inviterID, state.Call) {
+		return result, errNoInvitePermission
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return result, appErr
+	}
+
+	var members, nonMembers []string
+	for _, userID := range userIDs {
+		if p.API.HasPermissionToChannel(userID, channelID, model.PermissionCreatePost) {
+			members = append(members, userID)
+		} else {
+			nonMembers = append(nonMembers, userID)
+		}
+	}
+
+	if len(nonMembers) > 0 {
+		// Members cannot be added to direct and group channels.
+		if channel.Type == model.ChannelTypeDirect || channel.Type == model.ChannelTypeGroup {
+			return result, fmt.Errorf("user %q is not a member of the channel", nonMembers[0])
+		}
+
+		if !p.getConfiguration().inviteNonMembersEnabled() {
+			return result, fmt.Errorf("user %q is not a member of the channel", nonMembers[0])
+		}
+
+		if inviterID == state.Call.HostID {
+			if !p.canAddChannelMembers(inviterID, channel) {
+				return result, errNoAddMemberPermission
+			}
+			for _, userID := range nonMembers {
+				if _, appErr := p.API.AddChannelMember(channelID, userID); appErr != nil {
+					return result, fmt.Errorf("failed to add user to channel: %w", appErr)
+				}
+			}
+			members = append(members, nonMembers...)
+		} else {
+			if err := p.requestCallInvite(channelID, state.Call.ID, inviterID, nonMembers); err != nil {
+				return result, err
+			}
+			result.Pending = nonMembers
+		}
+	}
+
+	if len(members) == 0 {
+		return result, nil
+	}
+
+	if err := p.inviteToCall(channel, state.Call, inviterID, members); err != nil {
+		return result, err
+	}
+	result.Invited = append(result.Invited, members...)
+
+	return result, nil
+}
+
+// requestCallInvite asks the host of the call to approve inviting users who
+// are not channel members. Requests expire if the host doesn't act on them in
+// time.
+func (p *Plugin) requestCallInvite(channelID, callID, inviterID string, userIDs []string) error {
+	var hostID string
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		if state == nil || state.Call == nil || state.Call.ID != callID {
+			return nil, fmt.Errorf("no call ongoing")
+		}
+		if state.Call.HostID == "" {
+			return nil, fmt.Errorf("call has no host to approve the invite")
+		}
+
+		if state.Call.InviteRequests == nil {
+			state.Call.InviteRequests = make(map[string]*inviteRequestState)
+		}
+		for _, userID := range userIDs {
+			state.Call.InviteRequests[userID] = &inviteRequestState{
+				InviterID: inviterID,
+				RequestAt: time.Now().UnixMilli(),
+			}
+		}
+		hostID = state.Call.HostID
+
+		return state, nil
+	}); err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		p.publishWebSocketEvent(wsEventCallInviteRequest, map[string]interface{}{
+			"channelID": channelID,
+			"userID":    userID,
+			"inviterID": inviterID,
+		}, &model.WebsocketBroadcast{UserId: hostID, ReliableClusterSend: true})
+	}
+
+	go p.expireInviteRequestsAfter(channelID, callID, userIDs, inviteRequestTimeout)
+
+	return nil
+}
+
+// expireInviteRequestsAfter removes the invite requests for the given users
+// that haven't been approved or denied once the timeout expires, letting both
+// the host and the inviter know.
+func (p *Plugin) expireInviteRequestsAfter(channelID, callID string, userIDs []string, timeout time.Duration) {
+	select {
+	case <-time.After(timeout):
+	case <-p.stopCh:
+		return
+	}
+
+	var hostID string
+	var expired map[string]*inviteRequestState
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		expired = nil
+
+		if state == nil || state.Call == nil || state.Call.ID != callID {
+			return nil, nil
+		}
+
+		now := time.Now().UnixMilli()
+		for _, userID := range userIDs {
+			// Requests may have been made again in the meantime.
+			if req, ok := state.Call.InviteRequests[userID]; ok && req.expired(now) {
+				if expired == nil {
+					expired = make(map[string]*inviteRequestState)
+				}
+				expired[userID] = req
+				delete(state.Call.InviteRequests, userID)
+			}
+		}
+		if len(expired) == 0 {
+			return nil, nil
+		}
+		hostID = state.Call.HostID
+
+		return state, nil
+	}); err != nil {
+		p.LogError("failed to expire invite requests", "err", err.Error(), "channelID", channelID)
+		return
+	}
+
+	for userID, req := range expired {
+		data := map[string]interface{}{
+			"channelID": channelID,
+			"userID":    userID,
+		}
+		p.publishWebSocketEvent(wsEventCallInviteExpired, data, &model.WebsocketBroadcast{UserId: req.InviterID, ReliableClusterSend: true})
+		if hostID != "" {
+			p.publishWebSocketEvent(wsEventCallInviteExpired, data, &model.WebsocketBroadcast{UserId: hostID, ReliableClusterSend: true})
+		}
+	}
+}
+
+// handleInviteRequestAction approves or denies a pending invite on behalf of
+// the call host. Approved users are added to the channel and invited.
+func (p *Plugin) handleInviteRequestAction(hostID, channelID, action, userID string) error {
+	if userID == "" {
+		return fmt.Errorf("missing userID")
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return appErr
+	}
+
+	// Invite requests may outlive the setting being enabled.
+	if action == inviteActionApprove {
+		if !p.getConfiguration().inviteNonMembersEnabled() {
+			return fmt.Errorf("inviting users who are not channel members is disabled")
+		}
+		if !p.canAddChannelMembers(hostID, channel) {
+			return errNoAddMemberPermission
+		}
+	}
+
+	var req *inviteRequestState
+	var call *callState
+	var expired bool
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		expired = false
+
+		if state == nil || state.Call == nil {
+			return nil, fmt.Errorf("no call ongoing")
+		}
+		if state.Call.HostID != hostID {
+			return nil, errNotHost
+		}
+		var ok bool
+		if req, ok = state.Call.InviteRequests[userID]; !ok {
+			return nil, fmt.Errorf("no pending invite for user")
+		}
+
+		delete(state.Call.InviteRequests, userID)
+		// Expired requests are normally removed already but the node
+		// expiring them could have gone away.
+		expired = req.expired(time.Now().UnixMilli())
+		call = state.Call.Clone()
+
+		return state, nil
+	}); err != nil {
+		return err
+	}
+
+	if expired {
+		return errInviteRequestExpired
+	}
+
+	if action == inviteActionDeny {
+		p.publishWebSocketEvent(wsEventCallInviteDenied, map[string]interface{}{
+			"channelID": channelID,
+			"userID":    userID,
+		}, &model.WebsocketBroadcast{UserId: req.InviterID, ReliableClusterSend: true})
+		return nil
+	}
+
+	if _, appErr := p.API.AddChannelMember(channelID, userID); appErr != nil {
+		return fmt.Errorf("failed to add user to channel: %w", appErr)
+	}
+
+	return p.inviteToCall(channel, call, req.InviterID, []string{userID})
+}
+
+func (p *Plugin) handlePostInviteAction(w http.ResponseWriter, r *http.Request, channelID, action string) {
+	var res httpResponse
+	defer p.httpAudit("handlePostInviteAction", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var data struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&data); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if err := p.handleInviteRequestAction(userID, channelID, action, data.UserID); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		if errors.Is(err, errNotHost) || errors.Is(err, errNoAddMemberPermission) {
+			res.Code = http.StatusForbidden
+		}
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
+
+// getInviteCommandText returns the response to the invite command given the
+// usernames of the invited users.
+func getInviteCommandText(result callInviteResult, usernames map[string]string) string {
+	mentions := func(userIDs []string) string {
+		names := make([]string, 0, len(userIDs))
+		for _, userID := range userIDs {
+			names = append(names, "@"+usernames[userID])
+		}
+		return strings.Join(names, ", ")
+	}
+
+	var lines []string
+	if len(result.Invited) > 0 {
+		lines = append(lines, fmt.Sprintf("Invited %s to the call.", mentions(result.Invited)))
+	}
+	if len(result.Pending) > 0 {
+		lines = append(lines, fmt.Sprintf("Asked the host to approve inviting %s as they are not members of the channel.", mentions(result.Pending)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInviteCommandText(t *testing.T) {
+	usernames := map[string]string{
+		"userA": "alice",
+		"userB": "bob",
+		"userC": "carol",
+	}
+
+	t.Run("invited", func(t *testing.T) {
+		text := getInviteCommandText(callInviteResult{
+			Invited: []string{"userA", "userB"},
+		}, usernames)
+		require.Equal(t, "Invited @alice, @bob to the call.", text)
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		text := getInviteCommandText(callInviteResult{
+			Pending: []string{"userC"},
+		}, usernames)
+		require.Equal(t, "Asked the host to approve inviting @carol as they are not members of the channel.", text)
+	})
+
+	t.Run("both", func(t *testing.T) {
+		text := getInviteCommandText(callInviteResult{
+			Invited: []string{"userA"},
+			Pending: []string{"userC"},
+		}, usernames)
+		require.Equal(t, "Invited @alice to the call.\nAsked the host to approve inviting @carol as they are not members of the channel.", text)
+	})
+}
+
+func TestInviteUsers(t *testing.T) {
+	hostID, participantID, userID := model.NewId(), model.NewId(), model.NewId()
+
+	t.Run("non-members disabled", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, nil)
+		api.On("HasPermissionToChannel", userID, channel.Id, model.PermissionCreatePost).Return(false).Once()
+
+		_, err := p.inviteUsers(hostID, channel.Id, []string{userID})
+		require.EqualError(t, err, fmt.Sprintf("user %q is not a member of the channel", userID))
+		api.AssertNotCalled(t, "AddChannelMember", mock.Anything, mock.Anything)
+	})
+
+	t.Run("host cannot add members", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, nil)
+		p.configuration.EnableInviteNonMembers = model.NewBool(true)
+		api.On("HasPermissionToChannel", userID, channel.Id, model.PermissionCreatePost).Return(false).Once()
+		api.On("HasPermissionToChannel", hostID, channel.Id, model.PermissionManagePrivateChannelMembers).Return(false).Once()
+
+		_, err := p.inviteUsers(hostID, channel.Id, []string{userID})
+		require.ErrorIs(t, err, errNoAddMemberPermission)
+		api.AssertNotCalled(t, "AddChannelMember", mock.Anything, mock.Anything)
+	})
+
+	t.Run("host adds members", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, nil)
+		p.configuration.EnableInviteNonMembers = model.NewBool(true)
+		api.On("HasPermissionToChannel", userID, channel.Id, model.PermissionCreatePost).Return(false).Once()
+		api.On("HasPermissionToChannel", hostID, channel.Id, model.PermissionManagePrivateChannelMembers).Return(true).Once()
+		api.On("AddChannelMember", channel.Id, userID).Return(&model.ChannelMember{}, nil).Once()
+		expectCallInvite(api, channel, hostID, userID)
+
+		result, err := p.inviteUsers(hostID, channel.Id, []string{userID})
+		require.NoError(t, err)
+		require.Equal(t, []string{userID}, result.Invited)
+		require.Empty(t, result.Pending)
+	})
+
+	t.Run("participant requests approval", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, nil)
+		p.configuration.EnableInviteNonMembers = model.NewBool(true)
+		api.On("HasPermissionToChannel", userID, channel.Id, model.PermissionCreatePost).Return(false).Once()
+		api.On("PublishWebSocketEvent", wsEventCallInviteRequest, map[string]interface{}{
+			"channelID": channel.Id,
+			"userID":    userID,
+			"inviterID": participantID,
+		}, &model.WebsocketBroadcast{UserId: hostID, ReliableClusterSend: true}).Once()
+
+		result, err := p.inviteUsers(participantID, channel.Id, []string{userID})
+		require.NoError(t, err)
+		require.Empty(t, result.Invited)
+		require.Equal(t, []string{userID}, result.Pending)
+		api.AssertNotCalled(t, "AddChannelMember", mock.Anything, mock.Anything)
+
+		state, err := p.kvGetChannelState(channel.Id)
+		require.NoError(t, err)
+		require.Equal(t, participantID, state.Call.InviteRequests[userID].InviterID)
+	})
+
+	t.Run("not in call", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, nil)
+		api.On("HasPermissionTo", userID, model.PermissionManageSystem).Return(false).Once()
+
+		_, err := p.inviteUsers(userID, channel.Id, []string{participantID})
+		require.ErrorIs(t, err, errNoInvitePermission)
+	})
+}
+
+func TestHandleInviteRequestAction(t *testing.T) {
+	hostID, participantID, userID := model.NewId(), model.NewId(), model.NewId()
+
+	newRequests := func(requestAt int64) map[string]*inviteRequestState {
+		return map[string]*inviteRequestState{
+			userID: {InviterID: participantID, RequestAt: requestAt},
+		}
+	}
+
+	inviteAction := func(p *Plugin, channelID, actorID, action string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/calls/"+channelID+"/invite/"+action, strings.NewReader(`{"user_id": "`+userID+`"}`))
+		r.Header.Set("Mattermost-User-Id", actorID)
+		p.ServeHTTP(nil, w, r)
+		return w.Code
+	}
+
+	getRequests := func(t *testing.T, p *Plugin, channelID string) map[string]*inviteRequestState {
+		t.Helper()
+		state, err := p.kvGetChannelState(channelID)
+		require.NoError(t, err)
+		return state.Call.InviteRequests
+	}
+
+	t.Run("invalid action", func(t *testing.T) {
+		p, _, channel := setupCallInviteTest(t, hostID, participantID, newRequests(time.Now().UnixMilli()))
+		require.Equal(t, http.StatusNotFound, inviteAction(p, channel.Id, hostID, "ignore"))
+	})
+
+	t.Run("approve disabled", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, newRequests(time.Now().UnixMilli()))
+		require.Equal(t, http.StatusBadRequest, inviteAction(p, channel.Id, hostID, inviteActionApprove))
+		require.Len(t, getRequests(t, p, channel.Id), 1)
+		api.AssertNotCalled(t, "AddChannelMember", mock.Anything, mock.Anything)
+	})
+
+	t.Run("host cannot add members", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, newRequests(time.Now().UnixMilli()))
+		p.configuration.EnableInviteNonMembers = model.NewBool(true)
+		api.On("HasPermissionToChannel", hostID, channel.Id, model.PermissionManagePrivateChannelMembers).Return(false).Once()
+
+		require.Equal(t, http.StatusForbidden, inviteAction(p, channel.Id, hostID, inviteActionApprove))
+		require.Len(t, getRequests(t, p, channel.Id), 1)
+		api.AssertNotCalled(t, "AddChannelMember", mock.Anything, mock.Anything)
+	})
+
+	t.Run("not host", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, newRequests(time.Now().UnixMilli()))
+		p.configuration.EnableInviteNonMembers = model.NewBool(true)
+		api.On("HasPermissionToChannel", participantID, channel.Id, model.PermissionManagePrivateChannelMembers).Return(true).Once()
+
+		require.Equal(t, http.StatusForbidden, inviteAction(p, channel.Id, participantID, inviteActionApprove))
+		require.Len(t, getRequests(t, p, channel.Id), 1)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, newRequests(time.Now().Add(-inviteRequestTimeout).UnixMilli()))
+		p.configuration.EnableInviteNonMembers = model.NewBool(true)
+		api.On("HasPermissionToChannel", hostID, channel.Id, model.PermissionManagePrivateChannelMembers).Return(true).Once()
+
+		require.Equal(t, http.StatusBadRequest, inviteAction(p, channel.Id, hostID, inviteActionApprove))
+		require.Empty(t, getRequests(t, p, channel.Id))
+		api.AssertNotCalled(t, "AddChannelMember", mock.Anything, mock.Anything)
+	})
+
+	t.Run("approve", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, newRequests(time.Now().UnixMilli()))
+		p.configuration.EnableInviteNonMembers = model.NewBool(true)
+		api.On("HasPermissionToChannel", hostID, channel.Id, model.PermissionManagePrivateChannelMembers).Return(true).Once()
+		api.On("AddChannelMember", channel.Id, userID).Return(&model.ChannelMember{}, nil).Once()
+		expectCallInvite(api, channel, participantID, userID)
+
+		require.Equal(t, http.StatusOK, inviteAction(p, channel.Id, hostID, inviteActionApprove))
+		require.Empty(t, getRequests(t, p, channel.Id))
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		p, api, channel := setupCallInviteTest(t, hostID, participantID, newRequests(time.Now().UnixMilli()))
+		api.On("PublishWebSocketEvent", wsEventCallInviteDenied, mock.Anything, &model.WebsocketBroadcast{UserId: participantID, ReliableClusterSend: true}).Once()
+
+		require.Equal(t, http.StatusOK, inviteAction(p, channel.Id, hostID, inviteActionDeny))
+		require.Empty(t, getRequests(t, p, channel.Id))
+		api.AssertNotCalled(t, "AddChannelMember", mock.Anything, mock.Anything)
+	})
+}
+
+func TestExpireInviteRequests(t *testing.T) {
+	hostID, participantID := model.NewId(), model.NewId()
+	p, api, channel := setupCallInviteTest(t, hostID, participantID, map[string]*inviteRequestState{
+		"userA": {InviterID: participantID, RequestAt: time.Now().Add(-inviteRequestTimeout).UnixMilli()},
+		// Requested again since.
+		"userB": {InviterID: participantID, RequestAt: time.Now().UnixMilli()},
+	})
+
+	data := map[string]interface{}{
+		"channelID": channel.Id,
+		"userID":    "userA",
+	}
+	api.On("PublishWebSocketEvent", wsEventCallInviteExpired, data, &model.WebsocketBroadcast{UserId: participantID, ReliableClusterSend: true}).Once()
+	api.On("PublishWebSocketEvent", wsEventCallInviteExpired, data, &model.WebsocketBroadcast{UserId: hostID, ReliableClusterSend: true}).Once()
+
+	p.expireInviteRequestsAfter(channel.Id, "callID", []string{"userA", "userB"}, 0)
+
+	state, err := p.kvGetChannelState(channel.Id)
+	require.NoError(t, err)
+	require.Len(t, state.Call.InviteRequests, 1)
+	require.NotNil(t, state.Call.InviteRequests["userB"])
+}
+
+func TestCanInviteToCall(t *testing.T) {
+	var p Plugin
+	call := &callState{
+		OwnerID: "userA",
+		Users: map[string]*userState{
+			"userB": {},
+		},
+	}
+
+	require.True(t, p.canInviteToCall("userA", call))
+	require.True(t, p.canInviteToCall("userB", call))
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// callQualityStats is a sample of the WebRTC statistics periodically
+// collected by clients.
+type callQualityStats struct {
+	// Round trip time in seconds.
+	RTT float64 `json:"rtt"`
+	// Jitter in seconds.
+	Jitter float64 `json:"jitter"`
+	// Fraction of packets lost, between 0 and 1.
+	PacketLoss float64 `json:"packet_loss"`
+	// Bitrate in bits per second.
+	Bitrate float64 `json:"bitrate"`
+}
+
+func (s callQualityStats) IsValid() error {
+	if s.RTT < 0 {
+		return fmt.Errorf("invalid rtt")
+	}
+	if s.Jitter < 0 {
+		return fmt.Errorf("invalid jitter")
+	}
+	if s.PacketLoss < 0 || s.PacketLoss > 1 {
+		return fmt.Errorf("invalid packet loss")
+	}
+	if s.Bitrate < 0 {
+		return fmt.Errorf("invalid bitrate")
+	}
+	return nil
+}
+
+type callQualityMetric struct {
+	Avg float64 `json:"avg"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// callQualitySummary aggregates quality samples for a session or a call.
+type callQualitySummary struct {
+	Samples    int               `json:"samples"`
+	RTT        callQualityMetric `json:"rtt"`
+	Jitter     callQualityMetric `json:"jitter"`
+	PacketLoss callQualityMetric `json:"packet_loss"`
+	Bitrate    callQualityMetric `json:"bitrate"`
+}
+
+func mergeCallQualityMetric(a callQualityMetric, aSamples int, b callQualityMetric, bSamples int) callQualityMetric {
+	if aSamples == 0 {
+		return b
+	}
+	return callQualityMetric{
+		Avg: (a.Avg*float64(aSamples) + b.Avg*float64(bSamples)) / float64(aSamples+bSamples),
+		Min: math.Min(a.Min, b.Min),
+		Max: math.Max(a.Max, b.Max),
+	}
+}
+
+func (s *callQualitySummary) merge(other callQualitySummary) {
+	if other.Samples == 0 {
+		return
+	}
+	s.RTT = mergeCallQualityMetric(s.RTT, s.Samples, other.RTT, other.Samples)
+	s.Jitter = mergeCallQualityMetric(s.Jitter, s.Samples, other.Jitter, other.Samples)
+	s.PacketLoss = mergeCallQualityMetric(s.PacketLoss, s.Samples, other.PacketLoss, other.Samples)
+	s.Bitrate = mergeCallQualityMetric(s.Bitrate, s.Samples, other.Bitrate, other.Samples)
+	s.Samples += other.Samples
+}
+
+func (s *callQualitySummary) add(stats callQualityStats) {
+	s.merge(callQualitySummary{
+		Samples:    1,
+		RTT:        callQualityMetric{Avg: stats.RTT, Min: stats.RTT, Max: stats.RTT},
+		Jitter:     callQualityMetric{Avg: stats.Jitter, Min: stats.Jitter, Max: stats.Jitter},
+		PacketLoss: callQualityMetric{Avg: stats.PacketLoss, Min: stats.PacketLoss, Max: stats.PacketLoss},
+		Bitrate:    callQualityMetric{Avg: stats.Bitrate, Min: stats.Bitrate, Max: stats.Bitrate},
+	})
+}
+
+// addQualityStats records a stats sample sent by the client of the given session.
+func (p *Plugin) addQualityStats(us *session, stats callQualityStats) error {
+	if err := stats.IsValid(); err != nil {
+		return err
+	}
+
+	p.metrics.ObserveClientStats(stats.RTT, stats.Jitter, stats.PacketLoss, stats.Bitrate)
+
+	us.mut.Lock()
+	us.quality.add(stats)
+	us.mut.Unlock()
+
+	return nil
+}
+
+// flushSessionQuality saves the quality stats collected by a session that's
+// being handed over to a different node.
+func (p *Plugin) flushSessionQuality(us *session, quality callQualitySummary) {
+	if quality.Samples == 0 {
+		return
+	}
+
+	state, err := p.kvGetChannelState(us.channelID)
+	if err != nil {
+		p.LogError("failed to get channel state", "error", err.Error())
+		return
+	} else if state == nil || state.Call == nil {
+		return
+	}
+
+	p.addCallHistoryParticipantQuality(us.channelID, state.Call.ID, us.userID, us.originalConnID, quality)
+}
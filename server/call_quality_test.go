@@ -0,0 +1,109 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallQualityStatsIsValid(t *testing.T) {
+	require.NoError(t, callQualityStats{}.IsValid())
+	require.NoError(t, callQualityStats{RTT: 0.1, Jitter: 0.01, PacketLoss: 0.05, Bitrate: 64000}.IsValid())
+	require.EqualError(t, callQualityStats{RTT: -1}.IsValid(), "invalid rtt")
+	require.EqualError(t, callQualityStats{Jitter: -1}.IsValid(), "invalid jitter")
+	require.EqualError(t, callQualityStats{PacketLoss: 1.5}.IsValid(), "invalid packet loss")
+	require.EqualError(t, callQualityStats{Bitrate: -1}.IsValid(), "invalid bitrate")
+}
+
+func TestCallQualitySummary(t *testing.T) {
+	var s callQualitySummary
+	s.add(callQualityStats{RTT: 0.1, Jitter: 0.02, PacketLoss: 0, Bitrate: 40000})
+	s.add(callQualityStats{RTT: 0.3, Jitter: 0.01, PacketLoss: 0.1, Bitrate: 80000})
+
+	require.Equal(t, 2, s.Samples)
+	require.InDelta(t, 0.2, s.RTT.Avg, 1e-9)
+	require.Equal(t, 0.1, s.RTT.Min)
+	require.Equal(t, 0.3, s.RTT.Max)
+	require.InDelta(t, 0.015, s.Jitter.Avg, 1e-9)
+	require.InDelta(t, 0.05, s.PacketLoss.Avg, 1e-9)
+	require.Equal(t, callQualityMetric{Avg: 60000, Min: 40000, Max: 80000}, s.Bitrate)
+
+	// Merging should weight averages by the number of samples.
+	var other callQualitySummary
+	other.add(callQualityStats{RTT: 0.5, Bitrate: 30000})
+	s.merge(other)
+	require.Equal(t, 3, s.Samples)
+	require.InDelta(t, 0.3, s.RTT.Avg, 1e-9)
+	require.Equal(t, 0.5, s.RTT.Max)
+	require.Equal(t, float64(30000), s.Bitrate.Min)
+
+	// Merging an empty summary is a no-op.
+	s.merge(callQualitySummary{})
+	require.Equal(t, 3, s.Samples)
+}
+
+func TestCallHistoryParticipantQuality(t *testing.T) {
+	var h callHistory
+	h.addParticipant("userA", "connA", 100)
+	h.addParticipant("userB", "connB", 100)
+
+	var qa callQualitySummary
+	qa.add(callQualityStats{RTT: 0.1})
+	h.setParticipantLeft("userA", "connA", 200, qa)
+	require.Equal(t, &qa, h.Participants[0].Quality)
+
+	var qb callQualitySummary
+	qb.add(callQualityStats{RTT: 0.3})
+	h.setParticipantLeft("userB", "connB", 300, qb)
+
+	require.NotNil(t, h.Quality)
+	require.Equal(t, 2, h.Quality.Samples)
+	require.InDelta(t, 0.2, h.Quality.RTT.Avg, 1e-9)
+
+	// Stats flushed before leaving are merged with the ones sent on leave.
+	h.addParticipant("userA", "connC", 400)
+	i := h.getActiveParticipant("userA", "connC")
+	require.Equal(t, 2, i)
+	h.addParticipantQuality(i, qa)
+	h.setParticipantLeft("userA", "connC", 500, qb)
+	require.Equal(t, 2, h.Participants[2].Quality.Samples)
+	require.InDelta(t, 0.2, h.Participants[2].Quality.RTT.Avg, 1e-9)
+	require.Equal(t, 4, h.Quality.Samples)
+	require.Equal(t, -1, h.getActiveParticipant("userA", "connC"))
+}
+
+func TestReconnectQualityFlush(t *testing.T) {
+	p, _, _ := newTestPlugin(t)
+
+	require.NoError(t, p.kvSetAtomicChannelState("channelID", func(_ *channelState) (*channelState, error) {
+		return &channelState{Call: &callState{ID: "callID"}}, nil
+	}))
+	require.NoError(t, p.initCallHistory("channelID", &callState{ID: "callID", StartAt: 100}, "postID", "postID"))
+	p.addCallHistoryParticipant("channelID", "callID", "userID", "connID", 100)
+
+	us := newUserSession("userID", "channelID", "connID", false)
+	require.NoError(t, p.addQualityStats(us, callQualityStats{RTT: 0.1}))
+	p.sessions["connID"] = us
+
+	// The session reconnected to a different node.
+	msg := clusterMessage{ConnID: "connID", UserID: "userID", SenderID: "nodeB"}
+	data, err := msg.ToJSON()
+	require.NoError(t, err)
+	require.NoError(t, p.handleEvent(model.PluginClusterEvent{Id: string(clusterMessageTypeReconnect), Data: data}))
+	require.Empty(t, p.sessions)
+
+	require.Eventually(t, func() bool {
+		history, err := p.kvGetCallHistory("callID")
+		require.NoError(t, err)
+		return history.Participants[0].Quality != nil && history.Participants[0].Quality.Samples == 1
+	}, time.Second, 10*time.Millisecond)
+
+	us.mut.Lock()
+	require.Zero(t, us.quality.Samples)
+	us.mut.Unlock()
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// Calls can be started and managed through the REST API without a websocket
+// connection, e.g. by bots using personal access tokens.
+var callStartRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)\/start$`)
+var callInviteRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)\/invite$`)
+
+const maxCallInvitees = 50
+
+type startCallRequest struct {
+	Title    string `json:"title"`
+	ThreadID string `json:"thread_id"`
+	// The users to invite once the call has started.
+	UserIDs []string `json:"user_ids"`
+}
+
+type inviteToCallRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+func callLink(siteURL, teamName, channelID string) string {
+	return fmt.Sprintf("%s/%s/channels/%s?join_call=true", siteURL, teamName, channelID)
+}
+
+// getCallLink returns the link to join the call in the given channel. Direct
+// and group channels are linked through one of the user's teams.
+func (p *Plugin) getCallLink(channel *model.Channel, userID string) (string, error) {
+	cfg := p.API.GetConfig()
+	if cfg == nil || cfg.ServiceSettings.SiteURL == nil || *cfg.ServiceSettings.SiteURL == "" {
+		return "", fmt.Errorf("SiteURL is not set")
+	}
+
+	var team *model.Team
+	if channel.TeamId != "" {
+		var appErr *model.AppError
+		team, appErr = p.API.GetTeam(channel.TeamId)
+		if appErr != nil {
+			return "", appErr
+		}
+	} else {
+		teams, appErr := p.API.GetTeamsForUser(userID)
+		if appErr != nil {
+			return "", appErr
+		}
+		if len(teams) == 0 {
+			return "", fmt.Errorf("user is not a member of any team")
+		}
+		team = teams[0]
+	}
+
+	return callLink(*cfg.ServiceSettings.SiteURL, team.Name, channel.Id), nil
+}
+
+func validateCallInvitees(userIDs []string) error {
+	if len(userIDs) == 0 {
+		return fmt.Errorf("user_ids should not be empty")
+	}
+	if len(userIDs) > maxCallInvitees {
+		return fmt.Errorf("cannot invite more than %d users", maxCallInvitees)
+	}
+	for _, userID := range userIDs {
+		if !model.IsValidId(userID) {
+			return fmt.Errorf("invalid user id %q", userID)
+		}
+	}
+	return nil
+}
+
+// checkCallInvitees verifies the invited users can join calls in the channel.
+func (p *Plugin) checkCallInvitees(channelID string, userIDs []string) error {
+	if err := validateCallInvitees(userIDs); err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if !p.API.HasPermissionToChannel(userID, channelID, model.PermissionCreatePost) {
+			return fmt.Errorf("user %q is not a member of the channel", userID)
+		}
+	}
+	return nil
+}
+
+func newCallInvitePost(botID, dmChannelID, channelID, callID, postMsg, link string) *model.Post {
+	slackAttachment := model.SlackAttachment{
+		Fallback:  postMsg,
+		Text:      postMsg,
+		Title:     "Join call",
+		TitleLink: link,
+	}
+
+	return &model.Post{
+		UserId:    botID,
+		ChannelId: dmChannelID,
+		Message:   postMsg,
+		Props: model.StringInterface{
+			"attachments":     []*model.SlackAttachment{&slackAttachment},
+			"call_channel_id": channelID,
+			"call_id":         callID,
+		},
+	}
+}
+
+// inviteToCall sends the given users a direct message from the Calls bot
+// with a link to join the call. Users already in the call are skipped.
+func (p *Plugin) inviteToCall(channel *model.Channel, call *callState, inviterID string, userIDs []string) error {
+	inviterName, err := p.getUserDisplayName(inviterID)
+	if err != nil {
+		return fmt.Errorf("failed to get inviter name: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		if _, ok := call.Users[userID]; ok {
+			continue
+		}
+
+		link, err := p.getCallLink(channel, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get call link: %w", err)
+		}
+
+		dm, appErr := p.API.GetDirectChannel(p.getBotID(), userID)
+		if appErr != nil {
+			return fmt.Errorf("failed to get direct channel: %w", appErr)
+		}
+
+		postMsg := fmt.Sprintf("%s invited you to join a call", inviterName)
+		if channel.Type == model.ChannelTypeOpen || channel.Type == model.ChannelTypePrivate {
+			postMsg += fmt.Sprintf(" in ~%s", channel.Name)
+		}
+
+		if _, appErr := p.API.CreatePost(newCallInvitePost(p.getBotID(), dm.Id, channel.Id, call.ID, postMsg, link)); appErr != nil {
+			return fmt.Errorf("failed to create post: %w", appErr)
+		}
+
+		p.publishWebSocketEvent(wsEventCallInvite, map[string]interface{}{
+			"channelID": channel.Id,
+			"callID":    call.ID,
+			"inviterID": inviterID,
+		}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+	}
+
+	return nil
+}
+
+func (p *Plugin) handleStartCall(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handleStartCall", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var req startCallRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if !p.API.HasPermissionToChannel(userID, channelID, model.PermissionCreatePost) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	if len(req.UserIDs) > 0 {
+		if err := p.checkCallInvitees(channelID, req.UserIDs); err != nil {
+			res.Err = err.Error()
+			res.Code = http.StatusBadRequest
+			return
+		}
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		res.Err = appErr.Error()
+		res.Code = appErr.StatusCode
+		return
+	}
+
+	call, err := p.startCall(channel, userID, req.Title, req.ThreadID)
+	if errors.Is(err, errCallOngoing) {
+		res.Err = err.Error()
+		res.Code = http.StatusConflict
+		return
+	} else if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if len(req.UserIDs) > 0 {
+		if err := p.inviteToCall(channel, call, userID, req.UserIDs); err != nil {
+			p.LogError("failed to invite users to call", "err", err.Error(), "channelID", channelID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(newCallInfo(channelID, call)); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+func (p *Plugin) handleInviteToCall(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handleInviteToCall", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var req inviteToCallRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&req); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	result, err := p.inviteUsers(userID, channelID, req.UserIDs)
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		if errors.Is(err, errNoInvitePermission) || errors.Is(err, errNoAddMemberPermission) {
+			res.Code = http.StatusForbidden
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		p.LogError(err.Error())
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallLink(t *testing.T) {
+	require.Equal(t, "http://localhost:8065/team/channels/channelID?join_call=true",
+		callLink("http://localhost:8065", "team", "channelID"))
+}
+
+func TestNewCallInvitePost(t *testing.T) {
+	post := newCallInvitePost("botID", "dmID", "channelID", "callID", "userA invited you to join a call", "http://localhost/link")
+	require.Equal(t, "botID", post.UserId)
+	require.Equal(t, "dmID", post.ChannelId)
+	require.Equal(t, "userA invited you to join a call", post.Message)
+	require.Equal(t, "channelID", post.GetProp("call_channel_id"))
+	require.Equal(t, "callID", post.GetProp("call_id"))
+
+	attachments, ok := post.GetProp("attachments").([]*model.SlackAttachment)
+	require.True(t, ok)
+	require.Len(t, attachments, 1)
+	require.Equal(t, "Join call", attachments[0].Title)
+	require.Equal(t, "http://localhost/link", attachments[0].TitleLink)
+}
+
+func TestValidateCallInvitees(t *testing.T) {
+	require.EqualError(t, validateCallInvitees(nil), "user_ids should not be empty")
+	require.EqualError(t, validateCallInvitees([]string{"invalid"}), `invalid user id "invalid"`)
+	require.NoError(t, validateCallInvitees([]string{model.NewId(), model.NewId()}))
+
+	userIDs := make([]string, maxCallInvitees+1)
+	for i := range userIDs {
+		userIDs[i] = model.NewId()
+	}
+	require.EqualError(t, validateCallInvitees(userIDs), "cannot invite more than 50 users")
+	require.NoError(t, validateCallInvitees(userIDs[:maxCallInvitees]))
+}
+
+// setupCallInviteTest starts a call in a private channel hosted by hostID
+// with participantID in it.
+func setupCallInviteTest(t *testing.T, hostID, participantID string, requests map[string]*inviteRequestState) (*Plugin, *plugintest.API, *model.Channel) {
+	t.Helper()
+
+	p, api, _ := newTestPlugin(t)
+
+	channel := &model.Channel{Id: model.NewId(), TeamId: "teamID", Name: "town-square", Type: model.ChannelTypePrivate}
+	require.NoError(t, p.kvSetAtomicChannelState(channel.Id, func(_ *channelState) (*channelState, error) {
+		return &channelState{
+			Call: &callState{
+				ID:      "callID",
+				OwnerID: hostID,
+				HostID:  hostID,
+				Users: map[string]*userState{
+					hostID:        {},
+					participantID: {},
+				},
+				InviteRequests: requests,
+			},
+		}, nil
+	}))
+	api.On("GetChannel", channel.Id).Return(channel, nil).Maybe()
+
+	return p, api, channel
+}
+
+// expectCallInvite sets the expectations for inviting the user to the call
+// through a direct message.
+func expectCallInvite(api *plugintest.API, channel *model.Channel, inviterID, userID string) {
+	api.On("GetUser", inviterID).Return(&model.User{Id: inviterID, Username: "inviter"}, nil).Once()
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("http://localhost:8065")}}).Twice()
+	api.On("GetTeam", channel.TeamId).Return(&model.Team{Id: channel.TeamId, Name: "team"}, nil).Once()
+	api.On("GetDirectChannel", "", userID).Return(&model.Channel{Id: "dmID"}, nil).Once()
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: "postID"}, nil).Once()
+	api.On("PublishWebSocketEvent", wsEventCallInvite, mock.Anything, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true}).Once()
+}
+
+func TestHandleStartCall(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	userID, inviteeID := model.NewId(), model.NewId()
+	channel := &model.Channel{Id: model.NewId(), TeamId: "teamID", Name: "incidents", Type: model.ChannelTypeOpen}
+	require.NoError(t, p.kvSetAtomicChannelState(channel.Id, func(_ *channelState) (*channelState, error) {
+		return &channelState{Enabled: model.NewBool(true)}, nil
+	}))
+	api.On("GetChannel", channel.Id).Return(channel, nil).Maybe()
+
+	startCall := func(userID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/calls/"+channel.Id+"/start", strings.NewReader(body))
+		r.Header.Set("Mattermost-User-Id", userID)
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("not a member", func(t *testing.T) {
+		api.On("HasPermissionToChannel", userID, channel.Id, model.PermissionCreatePost).Return(false).Once()
+		require.Equal(t, http.StatusForbidden, startCall(userID, "").Code)
+	})
+
+	t.Run("invitee not a member", func(t *testing.T) {
+		api.On("HasPermissionToChannel", userID, channel.Id, model.PermissionCreatePost).Return(true).Once()
+		api.On("HasPermissionToChannel", inviteeID, channel.Id, model.PermissionCreatePost).Return(false).Once()
+		require.Equal(t, http.StatusBadRequest, startCall(userID, `{"user_ids": ["`+inviteeID+`"]}`).Code)
+	})
+
+	t.Run("start and invite", func(t *testing.T) {
+		api.On("HasPermissionToChannel", userID, channel.Id, model.PermissionCreatePost).Return(true).Once()
+		api.On("HasPermissionToChannel", inviteeID, channel.Id, model.PermissionCreatePost).Return(true).Once()
+		expectStartCall(api, userID)
+		expectCallInvite(api, channel, userID, inviteeID)
+
+		w := startCall(userID, `{"title": "Incident", "user_ids": ["`+inviteeID+`"]}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var info callInfo
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&info))
+		require.Equal(t, userID, info.OwnerID)
+		// Starting a call doesn't join it.
+		require.Empty(t, info.Participants)
+
+		state, err := p.kvGetChannelState(channel.Id)
+		require.NoError(t, err)
+		require.Equal(t, info.ID, state.Call.ID)
+		require.Equal(t, "postID", state.Call.PostID)
+	})
+
+	t.Run("call ongoing", func(t *testing.T) {
+		api.On("HasPermissionToChannel", userID, channel.Id, model.PermissionCreatePost).Return(true).Once()
+		require.Equal(t, http.StatusConflict, startCall(userID, "").Code)
+	})
+}
+
+func TestHandleInviteToCall(t *testing.T) {
+	hostID, participantID, userID := model.NewId(), model.NewId(), model.NewId()
+	p, api, channel := setupCallInviteTest(t, hostID, participantID, nil)
+
+	inviteToCall := func(inviterID, channelID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/calls/"+channelID+"/invite", strings.NewReader(`{"user_ids": ["`+userID+`"]}`))
+		r.Header.Set("Mattermost-User-Id", inviterID)
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("no call", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, inviteToCall(hostID, model.NewId()).Code)
+	})
+
+	t.Run("not in call", func(t *testing.T) {
+		api.On("HasPermissionTo", userID, model.PermissionManageSystem).Return(false).Once()
+		require.Equal(t, http.StatusForbidden, inviteToCall(userID, channel.Id).Code)
+	})
+
+	t.Run("participant", func(t *testing.T) {
+		api.On("HasPermissionToChannel", userID, channel.Id, model.PermissionCreatePost).Return(true).Once()
+		expectCallInvite(api, channel, participantID, userID)
+
+		w := inviteToCall(participantID, channel.Id)
+		require.Equal(t, http.StatusOK, w.Code)
+		var result callInviteResult
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		require.Equal(t, []string{userID}, result.Invited)
+		require.Empty(t, result.Pending)
+	})
+}
+
+func TestStartCallClaimsScheduledPost(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	userID := model.NewId()
+	channel := &model.Channel{Id: model.NewId(), Type: model.ChannelTypeOpen}
+	require.NoError(t, p.kvSetAtomicChannelState(channel.Id, func(_ *channelState) (*channelState, error) {
+		return &channelState{Enabled: model.NewBool(true)}, nil
+	}))
+
+	sc := &scheduledCall{
+		ID:        model.NewId(),
+		ChannelID: channel.Id,
+		StartAt:   time.Now().Add(5 * time.Minute).UnixMilli(),
+		PostID:    "scheduledPostID",
+	}
+	require.NoError(t, p.addScheduledCallDueEntry(sc.dueEntry()))
+	require.NoError(t, p.kvSetAtomicScheduledCalls(channel.Id, func(calls map[string]*scheduledCall) (bool, error) {
+		calls[sc.ID] = sc
+		return true, nil
+	}))
+
+	scheduledPost := &model.Post{Id: "scheduledPostID", ChannelId: channel.Id}
+	scheduledPost.AddProp("scheduled_call_pending", true)
+	api.On("GetPost", "scheduledPostID").Return(scheduledPost, nil)
+	api.On("GetUser", userID).Return(&model.User{Id: userID, Username: "username"}, nil).Once()
+	api.On("GetConfig").Return(&model.Config{}).Once()
+	api.On("UpdatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.Id == "scheduledPostID" && post.GetProp("scheduled_call_id") == sc.ID &&
+			post.GetProp("scheduled_call_pending") == nil
+	})).Return(&model.Post{}, nil).Once()
+	api.On("PublishWebSocketEvent", wsEventCallStart, mock.Anything, mock.Anything).Once()
+
+	call, err := p.startCall(channel, userID, "", "")
+	require.NoError(t, err)
+	require.Equal(t, "scheduledPostID", call.PostID)
+	require.Equal(t, "scheduledPostID", call.ThreadID)
+	api.AssertNotCalled(t, "CreatePost", mock.Anything)
+
+	calls, err := p.kvGetScheduledCalls(channel.Id)
+	require.NoError(t, err)
+	require.Empty(t, calls)
+}
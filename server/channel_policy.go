@@ -0,0 +1,183 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var channelPolicyRE = regexp.MustCompile(`^\/([a-z0-9]+)\/policy$`)
+
+const (
+	callStartPolicyEveryone      = "everyone"
+	callStartPolicyChannelAdmins = "channel_admins"
+)
+
+// channelPolicy holds the per-channel call settings. Unset fields fall back to
+// the plugin configuration. The policy can only further restrict what the
+// plugin configuration allows.
+type channelPolicy struct {
+	MaxParticipants    *int   `json:"max_participants,omitempty"`
+	AllowScreenSharing *bool  `json:"allow_screen_sharing,omitempty"`
+	AllowRecordings    *bool  `json:"allow_recordings,omitempty"`
+	StartCalls         string `json:"start_calls,omitempty"`
+}
+
+func (cp *channelPolicy) IsValid() error {
+	if cp == nil {
+		return fmt.Errorf("policy should not be nil")
+	}
+
+	if cp.MaxParticipants != nil && *cp.MaxParticipants < 0 {
+		return fmt.Errorf("MaxParticipants is not valid: should not be negative")
+	}
+
+	switch cp.StartCalls {
+	case "", callStartPolicyEveryone, callStartPolicyChannelAdmins:
+	default:
+		return fmt.Errorf("StartCalls is not valid: %q", cp.StartCalls)
+	}
+
+	return nil
+}
+
+// maxParticipants returns the effective participants limit given the global
+// one. Zero means no limit.
+func (cp *channelPolicy) maxParticipants(globalMax int) int {
+	if cp == nil || cp.MaxParticipants == nil || *cp.MaxParticipants == 0 {
+		return globalMax
+	}
+	if globalMax != 0 && globalMax < *cp.MaxParticipants {
+		return globalMax
+	}
+	return *cp.MaxParticipants
+}
+
+func (cp *channelPolicy) screenSharingAllowed() bool {
+	return cp == nil || cp.AllowScreenSharing == nil || *cp.AllowScreenSharing
+}
+
+func (cp *channelPolicy) recordingsAllowed() bool {
+	return cp == nil || cp.AllowRecordings == nil || *cp.AllowRecordings
+}
+
+func (cp *channelPolicy) adminsOnlyStart() bool {
+	return cp != nil && cp.StartCalls == callStartPolicyChannelAdmins
+}
+
+// canStartCall returns whether the given user is allowed to start a call in
+// the channel as per its policy.
+func (p *Plugin) canStartCall(userID, channelID string, policy *channelPolicy) bool {
+	if !policy.adminsOnlyStart() {
+		return true
+	}
+
+	if p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		return true
+	}
+
+	cm, appErr := p.API.GetChannelMember(channelID, userID)
+	return appErr == nil && cm.SchemeAdmin
+}
+
+func (p *Plugin) handleGetChannelPolicy(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handleGetChannelPolicy", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	if !p.API.HasPermissionToChannel(userID, channelID, model.PermissionReadChannel) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	state, err := p.kvGetChannelState(channelID)
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	policy := &channelPolicy{}
+	if state != nil && state.Policy != nil {
+		policy = state.Policy
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+func (p *Plugin) handlePostChannelPolicy(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handlePostChannelPolicy", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	if permission, appErr := p.permissionToEnableDisableChannel(userID, channelID); appErr != nil || !permission {
+		res.Err = "Forbidden"
+		if appErr != nil {
+			res.Err = appErr.Error()
+		}
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	var policy channelPolicy
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&policy); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if err := policy.IsValid(); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		if state == nil {
+			state = &channelState{}
+		}
+		state.Policy = &policy
+		return state, nil
+	}); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	p.publishWebSocketEvent(wsEventChannelPolicyChanged, map[string]interface{}{
+		"policy": policy.toMap(),
+	}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+func (cp *channelPolicy) toMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"start_calls": cp.StartCalls,
+	}
+	if cp.MaxParticipants != nil {
+		m["max_participants"] = *cp.MaxParticipants
+	}
+	if cp.AllowScreenSharing != nil {
+		m["allow_screen_sharing"] = *cp.AllowScreenSharing
+	}
+	if cp.AllowRecordings != nil {
+		m["allow_recordings"] = *cp.AllowRecordings
+	}
+	return m
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+func TestChannelPolicyIsValid(t *testing.T) {
+	var policy *channelPolicy
+	require.EqualError(t, policy.IsValid(), "policy should not be nil")
+
+	policy = &channelPolicy{}
+	require.NoError(t, policy.IsValid())
+
+	policy.StartCalls = callStartPolicyChannelAdmins
+	require.NoError(t, policy.IsValid())
+
+	policy.StartCalls = "nobody"
+	require.EqualError(t, policy.IsValid(), `StartCalls is not valid: "nobody"`)
+
+	policy.StartCalls = callStartPolicyEveryone
+	policy.MaxParticipants = model.NewInt(-1)
+	require.EqualError(t, policy.IsValid(), "MaxParticipants is not valid: should not be negative")
+}
+
+func TestChannelPolicyMaxParticipants(t *testing.T) {
+	var policy *channelPolicy
+	require.Equal(t, 8, policy.maxParticipants(8))
+	require.Equal(t, 0, policy.maxParticipants(0))
+
+	policy = &channelPolicy{MaxParticipants: model.NewInt(4)}
+	require.Equal(t, 4, policy.maxParticipants(8))
+	require.Equal(t, 4, policy.maxParticipants(0))
+
+	// The policy cannot raise the global limit.
+	policy.MaxParticipants = model.NewInt(16)
+	require.Equal(t, 8, policy.maxParticipants(8))
+
+	policy.MaxParticipants = model.NewInt(0)
+	require.Equal(t, 8, policy.maxParticipants(8))
+}
+
+func TestChannelPolicyDefaults(t *testing.T) {
+	var policy *channelPolicy
+	require.True(t, policy.screenSharingAllowed())
+	require.True(t, policy.recordingsAllowed())
+	require.False(t, policy.adminsOnlyStart())
+
+	policy = &channelPolicy{
+		AllowScreenSharing: model.NewBool(false),
+		AllowRecordings:    model.NewBool(false),
+		StartCalls:         callStartPolicyChannelAdmins,
+	}
+	require.False(t, policy.screenSharingAllowed())
+	require.False(t, policy.recordingsAllowed())
+	require.True(t, policy.adminsOnlyStart())
+}
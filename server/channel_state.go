@@ -13,13 +13,16 @@ type recordingState struct {
 	CreatorID string `json:"creator_id"`
 	JobID     string `json:"job_id"`
 	BotConnID string `json:"bot_conn_id"`
+	// The number of times the recording job was restarted after failing.
+	Retries int `json:"retries,omitempty"`
 	RecordingStateClient
 }
 
 type userState struct {
-	Unmuted    bool  `json:"unmuted"`
-	RaisedHand int64 `json:"raised_hand"`
-	JoinAt     int64 `json:"join_at"`
+	Unmuted    bool   `json:"unmuted"`
+	RaisedHand int64  `json:"raised_hand"`
+	JoinAt     int64  `json:"join_at"`
+	ConnID     string `json:"conn_id,omitempty"`
 }
 
 type callStats struct {
@@ -28,27 +31,45 @@ type callStats struct {
 }
 
 type callState struct {
-	ID              string                `json:"id"`
-	StartAt         int64                 `json:"create_at"`
-	EndAt           int64                 `json:"end_at"`
-	Users           map[string]*userState `json:"users,omitempty"`
-	Sessions        map[string]struct{}   `json:"sessions,omitempty"`
-	OwnerID         string                `json:"owner_id"`
-	ThreadID        string                `json:"thread_id"`
-	PostID          string                `json:"post_id"`
-	ScreenSharingID string                `json:"screen_sharing_id"`
-	ScreenStreamID  string                `json:"screen_stream_id"`
-	ScreenStartAt   int64                 `json:"screen_start_at"`
-	Stats           callStats             `json:"stats"`
-	RTCDHost        string                `json:"rtcd_host"`
-	HostID          string                `json:"host_id"`
-	Recording       *recordingState       `json:"recording,omitempty"`
+	ID              string                         `json:"id"`
+	StartAt         int64                          `json:"create_at"`
+	EndAt           int64                          `json:"end_at"`
+	Users           map[string]*userState          `json:"users,omitempty"`
+	Sessions        map[string]struct{}            `json:"sessions,omitempty"`
+	OwnerID         string                         `json:"owner_id"`
+	ThreadID        string                         `json:"thread_id"`
+	PostID          string                         `json:"post_id"`
+	ScreenSharingID string                         `json:"screen_sharing_id"`
+	ScreenStreamID  string                         `json:"screen_stream_id"`
+	ScreenStartAt   int64                          `json:"screen_start_at"`
+	Stats           callStats                      `json:"stats"`
+	RTCDHost        string                         `json:"rtcd_host"`
+	RTCDPool        string                         `json:"rtcd_pool,omitempty"`
+	RTCBackend      string                         `json:"rtc_backend,omitempty"`
+	HostID          string                         `json:"host_id"`
+	AssignedHostID  string                         `json:"assigned_host_id,omitempty"`
+	Recording       *recordingState                `json:"recording,omitempty"`
+	Pending         map[string]*lobbyUserState     `json:"pending,omitempty"`
+	Admitted        map[string]struct{}            `json:"admitted,omitempty"`
+	Ringing         map[string]*ringingState       `json:"ringing,omitempty"`
+	InviteRequests  map[string]*inviteRequestState `json:"invite_requests,omitempty"`
+	// Removed holds the users the host removed, who cannot join again until
+	// the call ends.
+	Removed map[string]struct{} `json:"removed,omitempty"`
 }
 
+// The backends that can host the media of a call.
+const (
+	rtcBackendRTCD     = "rtcd"
+	rtcBackendEmbedded = "embedded"
+)
+
 type channelState struct {
-	NodeID  string     `json:"node_id,omitempty"`
-	Enabled *bool      `json:"enabled"`
-	Call    *callState `json:"call,omitempty"`
+	NodeID  string         `json:"node_id,omitempty"`
+	Enabled *bool          `json:"enabled"`
+	Lobby   *bool          `json:"lobby,omitempty"`
+	Policy  *channelPolicy `json:"policy,omitempty"`
+	Call    *callState     `json:"call,omitempty"`
 }
 
 type UserStateClient struct {
@@ -67,31 +88,85 @@ type CallStateClient struct {
 	OwnerID         string                `json:"owner_id"`
 	HostID          string                `json:"host_id"`
 	Recording       *RecordingStateClient `json:"recording,omitempty"`
+	Pending         []string              `json:"pending,omitempty"`
+}
+
+type RecordingPause struct {
+	StartAt int64 `json:"start_at"`
+	EndAt   int64 `json:"end_at"`
 }
 
 type RecordingStateClient struct {
-	InitAt  int64  `json:"init_at"`
-	StartAt int64  `json:"start_at"`
-	EndAt   int64  `json:"end_at"`
-	Err     string `json:"err,omitempty"`
+	InitAt  int64            `json:"init_at"`
+	StartAt int64            `json:"start_at"`
+	EndAt   int64            `json:"end_at"`
+	Err     string           `json:"err,omitempty"`
+	PauseAt int64            `json:"pause_at,omitempty"`
+	Pauses  []RecordingPause `json:"pauses,omitempty"`
 }
 
 type ChannelStateClient struct {
 	ChannelID string           `json:"channel_id,omitempty"`
 	Enabled   *bool            `json:"enabled,omitempty"`
+	Lobby     *bool            `json:"lobby,omitempty"`
 	Call      *CallStateClient `json:"call,omitempty"`
 }
 
+// setsEnabled returns whether a channel update request changes whether calls
+// are enabled. A request that doesn't set lobby mode always does, an unset
+// value restoring the default.
+func (cs *ChannelStateClient) setsEnabled() bool {
+	return cs.Enabled != nil || cs.Lobby == nil
+}
+
 func (rs *RecordingStateClient) toMap() map[string]interface{} {
 	if rs == nil {
 		return nil
 	}
+	pauses := make([]map[string]interface{}, 0, len(rs.Pauses))
+	for _, pause := range rs.Pauses {
+		pauses = append(pauses, map[string]interface{}{
+			"start_at": pause.StartAt,
+			"end_at":   pause.EndAt,
+		})
+	}
 	return map[string]interface{}{
 		"init_at":  rs.InitAt,
 		"start_at": rs.StartAt,
 		"end_at":   rs.EndAt,
 		"err":      rs.Err,
+		"pause_at": rs.PauseAt,
+		"pauses":   pauses,
+	}
+}
+
+func (rs *RecordingStateClient) isPaused() bool {
+	return rs.PauseAt > 0
+}
+
+// pause marks the recording as paused starting at the given timestamp.
+func (rs *RecordingStateClient) pause(ts int64) error {
+	if rs.StartAt == 0 || rs.EndAt > 0 {
+		return fmt.Errorf("recording is not in progress")
+	}
+	if rs.isPaused() {
+		return fmt.Errorf("recording is already paused")
+	}
+	rs.PauseAt = ts
+	return nil
+}
+
+// resume closes the current pause interval at the given timestamp.
+func (rs *RecordingStateClient) resume(ts int64) error {
+	if !rs.isPaused() {
+		return fmt.Errorf("recording is not paused")
 	}
+	rs.Pauses = append(rs.Pauses, RecordingPause{
+		StartAt: rs.PauseAt,
+		EndAt:   ts,
+	})
+	rs.PauseAt = 0
+	return nil
 }
 
 func (rs *recordingState) getClientState() *RecordingStateClient {
@@ -126,6 +201,48 @@ func (cs *callState) Clone() *callState {
 	if cs.Recording != nil {
 		newState.Recording = &recordingState{}
 		*newState.Recording = *cs.Recording
+		if cs.Recording.Pauses != nil {
+			newState.Recording.Pauses = make([]RecordingPause, len(cs.Recording.Pauses))
+			copy(newState.Recording.Pauses, cs.Recording.Pauses)
+		}
+	}
+
+	if cs.Pending != nil {
+		newState.Pending = make(map[string]*lobbyUserState, len(cs.Pending))
+		for id, state := range cs.Pending {
+			newState.Pending[id] = &lobbyUserState{}
+			*newState.Pending[id] = *state
+		}
+	}
+
+	if cs.Admitted != nil {
+		newState.Admitted = make(map[string]struct{}, len(cs.Admitted))
+		for id := range cs.Admitted {
+			newState.Admitted[id] = struct{}{}
+		}
+	}
+
+	if cs.Ringing != nil {
+		newState.Ringing = make(map[string]*ringingState, len(cs.Ringing))
+		for id, state := range cs.Ringing {
+			newState.Ringing[id] = &ringingState{}
+			*newState.Ringing[id] = *state
+		}
+	}
+
+	if cs.InviteRequests != nil {
+		newState.InviteRequests = make(map[string]*inviteRequestState, len(cs.InviteRequests))
+		for id, state := range cs.InviteRequests {
+			newState.InviteRequests[id] = &inviteRequestState{}
+			*newState.InviteRequests[id] = *state
+		}
+	}
+
+	if cs.Removed != nil {
+		newState.Removed = make(map[string]struct{}, len(cs.Removed))
+		for id := range cs.Removed {
+			newState.Removed[id] = struct{}{}
+		}
 	}
 
 	return &newState
@@ -152,6 +269,10 @@ func (cs *channelState) Clone() *channelState {
 	if cs.Call != nil {
 		newState.Call = cs.Call.Clone()
 	}
+	if cs.Policy != nil {
+		newState.Policy = &channelPolicy{}
+		*newState.Policy = *cs.Policy
+	}
 	return &newState
 }
 
@@ -183,6 +304,10 @@ func (cs *callState) getHostID(botID string) string {
 
 func (cs *callState) getClientState(botID string) *CallStateClient {
 	users, states := cs.getUsersAndStates(botID)
+	var pending []string
+	for id := range cs.Pending {
+		pending = append(pending, id)
+	}
 	return &CallStateClient{
 		ID:              cs.ID,
 		StartAt:         cs.StartAt,
@@ -194,6 +319,7 @@ func (cs *callState) getClientState(botID string) *CallStateClient {
 		OwnerID:         cs.OwnerID,
 		HostID:          cs.HostID,
 		Recording:       cs.Recording.getClientState(),
+		Pending:         pending,
 	}
 }
 
@@ -281,7 +407,7 @@ func (p *Plugin) cleanUpState() error {
 				continue
 			}
 
-			if err := p.cleanCallState(k); err != nil {
+			if err := p.cleanCallState(k, callEndReasonCleanUp); err != nil {
 				return fmt.Errorf("failed to clean up state: %w", err)
 			}
 		}
@@ -290,23 +416,27 @@ func (p *Plugin) cleanUpState() error {
 	return nil
 }
 
-func (p *Plugin) cleanCallState(channelID string) error {
+// cleanCallState removes the call from the channel state, if any. The reason
+// tells whether the call was actually ended or is only being cleaned up.
+func (p *Plugin) cleanCallState(channelID, reason string) error {
+	var endedCall *callState
+	var nodeID string
 	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
 		if state == nil {
 			return nil, nil
 		}
+		nodeID = state.NodeID
 		state.NodeID = ""
-
-		if state.Call != nil {
-			if _, err := p.updateCallPostEnded(state.Call.PostID); err != nil {
-				p.LogError(err.Error())
-			}
-		}
+		endedCall = state.Call
 		state.Call = nil
 		return state, nil
 	}); err != nil {
 		return fmt.Errorf("failed to cleanup state: %w", err)
 	}
 
+	if endedCall != nil {
+		p.onCallEnded(channelID, endedCall, nodeID, "", reason)
+	}
+
 	return nil
 }
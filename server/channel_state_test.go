@@ -9,6 +9,7 @@ import (
 
 	"github.com/mattermost/mattermost-server/v6/model"
 
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -244,6 +245,20 @@ func TestChannelStateClone(t *testing.T) {
 						StartAt: 1200,
 					},
 				},
+				Ringing: map[string]*ringingState{
+					"userD": {
+						RingAt: 1000,
+					},
+				},
+				InviteRequests: map[string]*inviteRequestState{
+					"userE": {
+						InviterID: "userA",
+						RequestAt: 1000,
+					},
+				},
+				Removed: map[string]struct{}{
+					"userF": {},
+				},
 			},
 		}
 
@@ -270,6 +285,18 @@ func TestChannelStateClone(t *testing.T) {
 		require.Condition(t, func() bool {
 			return cs.Call.Users["userA"] != cloned.Call.Users["userA"]
 		})
+
+		require.Condition(t, func() bool {
+			return cs.Call.Ringing["userD"] != cloned.Call.Ringing["userD"]
+		})
+
+		require.Condition(t, func() bool {
+			return cs.Call.InviteRequests["userE"] != cloned.Call.InviteRequests["userE"]
+		})
+
+		require.Condition(t, func() bool {
+			return !samePointer(t, cs.Call.Removed, cloned.Call.Removed)
+		})
 	})
 }
 
@@ -299,3 +326,91 @@ func TestRecordingStateGetClientState(t *testing.T) {
 		require.Equal(t, recState, rs.getClientState())
 	})
 }
+
+func TestRecordingStatePauseResume(t *testing.T) {
+	rs := &RecordingStateClient{
+		InitAt: 100,
+	}
+
+	require.EqualError(t, rs.pause(150), "recording is not in progress")
+
+	rs.StartAt = 200
+	require.EqualError(t, rs.resume(250), "recording is not paused")
+
+	require.NoError(t, rs.pause(300))
+	require.True(t, rs.isPaused())
+	require.EqualError(t, rs.pause(350), "recording is already paused")
+
+	require.NoError(t, rs.resume(400))
+	require.False(t, rs.isPaused())
+	require.NoError(t, rs.pause(500))
+	require.NoError(t, rs.resume(600))
+
+	require.Equal(t, []RecordingPause{
+		{StartAt: 300, EndAt: 400},
+		{StartAt: 500, EndAt: 600},
+	}, rs.Pauses)
+
+	rs.EndAt = 700
+	require.EqualError(t, rs.pause(800), "recording is not in progress")
+}
+
+func TestCleanCallState(t *testing.T) {
+	setupCall := func(t *testing.T, p *Plugin, channelID string) {
+		t.Helper()
+		require.NoError(t, p.kvSetAtomicChannelState(channelID, func(_ *channelState) (*channelState, error) {
+			return &channelState{
+				NodeID: p.nodeID,
+				Call: &callState{
+					ID:      "callID",
+					PostID:  "postID",
+					OwnerID: "callerID",
+					StartAt: 1000,
+					Users: map[string]*userState{
+						"callerID": {},
+					},
+					Ringing: map[string]*ringingState{
+						"userA": {RingAt: 1000},
+					},
+				},
+			}, nil
+		}))
+	}
+
+	t.Run("cleanup", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t)
+		channelID := model.NewId()
+		setupCall(t, p, channelID)
+
+		api.On("GetPost", "postID").Return(&model.Post{Id: "postID"}, nil).Once()
+		api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil).Once()
+		api.On("PublishWebSocketEvent", wsEventCallRingingStopped, mock.Anything, &model.WebsocketBroadcast{UserId: "userA", ReliableClusterSend: true}).Once()
+
+		require.NoError(t, p.cleanCallState(channelID, callEndReasonCleanUp))
+
+		// The call didn't actually end so no missed call is posted.
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+
+		state, err := p.kvGetChannelState(channelID)
+		require.NoError(t, err)
+		require.Nil(t, state.Call)
+		require.Empty(t, state.NodeID)
+	})
+
+	t.Run("forced", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t)
+		channelID := model.NewId()
+		setupCall(t, p, channelID)
+
+		api.On("GetPost", "postID").Return(&model.Post{Id: "postID"}, nil).Once()
+		api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil).Once()
+		api.On("PublishWebSocketEvent", wsEventCallRingingStopped, mock.Anything, &model.WebsocketBroadcast{UserId: "userA", ReliableClusterSend: true}).Once()
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil).Once()
+
+		require.NoError(t, p.cleanCallState(channelID, callEndReasonForced))
+
+		state, err := p.kvGetChannelState(channelID)
+		require.NoError(t, err)
+		require.Nil(t, state.Call)
+	})
+}
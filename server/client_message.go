@@ -27,6 +27,14 @@ const (
 	clientMessageTypeRaiseHand   = "raise_hand"
 	clientMessageTypeUnraiseHand = "unraise_hand"
 	clientMessageTypeReact       = "react"
+	clientMessageTypeStats       = "stats"
+
+	clientMessageTypeHostMute      = "host_mute"
+	clientMessageTypeHostLowerHand = "host_lower_hand"
+	clientMessageTypeHostScreenOff = "host_screen_off"
+	clientMessageTypeHostRemove    = "host_remove"
+	clientMessageTypeHostAdmit     = "host_admit"
+	clientMessageTypeHostReject    = "host_reject"
 )
 
 func (m *clientMessage) ToJSON() ([]byte, error) {
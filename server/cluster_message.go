@@ -16,17 +16,22 @@ type clusterMessage struct {
 	ChannelID     string        `json:"channel_id,omitempty"`
 	SenderID      string        `json:"sender_id,omitempty"`
 	ClientMessage clientMessage `json:"client_message,omitempty"`
+	RTCDHost      string        `json:"rtcd_host,omitempty"`
 }
 
 type clusterMessageType string
 
 const (
-	clusterMessageTypeConnect    clusterMessageType = "connect"
-	clusterMessageTypeDisconnect clusterMessageType = "disconnect"
-	clusterMessageTypeLeave      clusterMessageType = "leave"
-	clusterMessageTypeReconnect  clusterMessageType = "reconnect"
-	clusterMessageTypeSignaling  clusterMessageType = "signaling"
-	clusterMessageTypeUserState  clusterMessageType = "user_state"
+	clusterMessageTypeConnect        clusterMessageType = "connect"
+	clusterMessageTypeDisconnect     clusterMessageType = "disconnect"
+	clusterMessageTypeLeave          clusterMessageType = "leave"
+	clusterMessageTypeReconnect      clusterMessageType = "reconnect"
+	clusterMessageTypeSignaling      clusterMessageType = "signaling"
+	clusterMessageTypeUserState      clusterMessageType = "user_state"
+	clusterMessageTypeHostRemove     clusterMessageType = "host_remove"
+	clusterMessageTypeMigrate        clusterMessageType = "migrate"
+	clusterMessageTypeRTCDHostUpdate clusterMessageType = "rtcd_host_update"
+	clusterMessageTypeCallEnded      clusterMessageType = "call_ended"
 )
 
 func (m *clusterMessage) ToJSON() ([]byte, error) {
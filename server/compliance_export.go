@@ -0,0 +1,443 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	complianceExportJobKey         = "compliance_export_job"
+	complianceExportLastKey        = "compliance_export_last"
+	complianceExportInterval       = 24 * time.Hour
+	complianceExportFormatCSV      = "csv"
+	complianceExportFormatActiance = "actiance"
+)
+
+// Recording files get uploaded after their call ends so the scheduled export
+// only includes calls that have been over for a while.
+const complianceExportDelay = time.Hour
+
+type complianceUser struct {
+	Username string
+	Email    string
+}
+
+// complianceData holds the calls to export along with the users and channels
+// they reference.
+type complianceData struct {
+	Calls    []*callHistory
+	Users    map[string]complianceUser
+	Channels map[string]*model.Channel
+}
+
+func (d *complianceData) channelName(channelID string) string {
+	if ch := d.Channels[channelID]; ch != nil {
+		return ch.Name
+	}
+	return ""
+}
+
+func (d *complianceData) teamID(channelID string) string {
+	if ch := d.Channels[channelID]; ch != nil {
+		return ch.TeamId
+	}
+	return ""
+}
+
+func recordingFileIDs(h *callHistory) []string {
+	var fileIDs []string
+	for _, rec := range h.Recordings {
+		fileIDs = append(fileIDs, rec.FileIDs...)
+	}
+	return fileIDs
+}
+
+func callDurationSeconds(startAt, endAt int64) int64 {
+	if endAt < startAt {
+		return 0
+	}
+	return (endAt - startAt) / 1000
+}
+
+var complianceCSVHeader = []string{
+	"call_id",
+	"channel_id",
+	"channel_name",
+	"team_id",
+	"call_start_at",
+	"call_end_at",
+	"call_duration",
+	"owner_id",
+	"user_id",
+	"username",
+	"email",
+	"join_at",
+	"leave_at",
+	"duration",
+	"recording_file_ids",
+}
+
+// writeComplianceCSV writes a row for each participant session of the
+// exported calls. Times are in milliseconds and durations in seconds.
+func writeComplianceCSV(w io.Writer, data *complianceData) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(complianceCSVHeader); err != nil {
+		return err
+	}
+
+	for _, h := range data.Calls {
+		callFields := []string{
+			h.ID,
+			h.ChannelID,
+			data.channelName(h.ChannelID),
+			data.teamID(h.ChannelID),
+			strconv.FormatInt(h.StartAt, 10),
+			strconv.FormatInt(h.EndAt, 10),
+			strconv.FormatInt(callDurationSeconds(h.StartAt, h.EndAt), 10),
+			h.OwnerID,
+		}
+		fileIDs := strings.Join(recordingFileIDs(h), ";")
+
+		if len(h.Participants) == 0 {
+			row := append(append([]string{}, callFields...), "", "", "", "", "", "", fileIDs)
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, participant := range h.Participants {
+			user := data.Users[participant.UserID]
+			row := append(append([]string{}, callFields...),
+				participant.UserID,
+				user.Username,
+				user.Email,
+				strconv.FormatInt(participant.JoinAt, 10),
+				strconv.FormatInt(participant.LeaveAt, 10),
+				strconv.FormatInt(callDurationSeconds(participant.JoinAt, participant.LeaveAt), 10),
+				fileIDs,
+			)
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+type actianceParticipantEvent struct {
+	LoginName        string `xml:"LoginName"`
+	UserType         string `xml:"UserType"`
+	DateTimeUTC      int64  `xml:"DateTimeUTC"`
+	CorporateEmailID string `xml:"CorporateEmailID"`
+}
+
+type actianceFileTransfer struct {
+	LoginName   string `xml:"LoginName"`
+	UserType    string `xml:"UserType"`
+	FileName    string `xml:"FileName"`
+	DateTimeUTC int64  `xml:"DateTimeUTC"`
+}
+
+type actianceConversation struct {
+	Perspective         string                     `xml:"Perspective,attr"`
+	RoomID              string                     `xml:"RoomID"`
+	StartTimeUTC        int64                      `xml:"StartTimeUTC"`
+	ParticipantEntered  []actianceParticipantEvent `xml:"ParticipantEntered"`
+	FileTransferStarted []actianceFileTransfer     `xml:"FileTransferStarted"`
+	ParticipantLeft     []actianceParticipantEvent `xml:"ParticipantLeft"`
+	EndTimeUTC          int64                      `xml:"EndTimeUTC"`
+}
+
+type actianceFileDump struct {
+	XMLName       xml.Name               `xml:"FileDump"`
+	XSI           string                 `xml:"xmlns:xsi,attr"`
+	Conversations []actianceConversation `xml:"Conversation"`
+}
+
+// writeComplianceActiance writes a conversation for each exported call in
+// the same XML format used by Mattermost compliance exports. Times are in
+// seconds.
+func writeComplianceActiance(w io.Writer, data *complianceData) error {
+	dump := actianceFileDump{
+		XSI: "http://www.w3.org/2001/XMLSchema-instance",
+	}
+
+	for _, h := range data.Calls {
+		conv := actianceConversation{
+			Perspective:  data.channelName(h.ChannelID),
+			RoomID:       fmt.Sprintf("calls - %s - %s", data.channelName(h.ChannelID), h.ID),
+			StartTimeUTC: h.StartAt / 1000,
+			EndTimeUTC:   h.EndAt / 1000,
+		}
+
+		for _, participant := range h.Participants {
+			user := data.Users[participant.UserID]
+			ev := actianceParticipantEvent{
+				LoginName:        user.Username,
+				UserType:         "user",
+				DateTimeUTC:      participant.JoinAt / 1000,
+				CorporateEmailID: user.Email,
+			}
+			conv.ParticipantEntered = append(conv.ParticipantEntered, ev)
+			ev.DateTimeUTC = participant.LeaveAt / 1000
+			conv.ParticipantLeft = append(conv.ParticipantLeft, ev)
+		}
+
+		for _, rec := range h.Recordings {
+			creator := data.Users[rec.CreatorID]
+			for _, fileID := range rec.FileIDs {
+				conv.FileTransferStarted = append(conv.FileTransferStarted, actianceFileTransfer{
+					LoginName:   creator.Username,
+					UserType:    "user",
+					FileName:    fileID,
+					DateTimeUTC: rec.EndAt / 1000,
+				})
+			}
+		}
+
+		dump.Conversations = append(dump.Conversations, conv)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(dump); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func writeComplianceExport(w io.Writer, format string, data *complianceData) error {
+	switch format {
+	case complianceExportFormatCSV:
+		return writeComplianceCSV(w, data)
+	case complianceExportFormatActiance:
+		return writeComplianceActiance(w, data)
+	default:
+		return fmt.Errorf("invalid export format %q", format)
+	}
+}
+
+// getEndedCallHistories returns the history of the calls that ended in the
+// (since, until] range, sorted by start time.
+func (p *Plugin) getEndedCallHistories(since, until int64) ([]*callHistory, error) {
+	callIDs, err := p.getEndedCallIDs(since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := make([]*callHistory, 0, len(callIDs))
+	for _, callID := range callIDs {
+		history, err := p.kvGetCallHistory(callID)
+		if err != nil {
+			return nil, err
+		}
+		if history == nil || history.EndAt <= since || history.EndAt > until {
+			continue
+		}
+		calls = append(calls, history)
+	}
+
+	sort.SliceStable(calls, func(i, j int) bool {
+		return calls[i].StartAt < calls[j].StartAt
+	})
+
+	return calls, nil
+}
+
+func (p *Plugin) getComplianceData(since, until int64) (*complianceData, error) {
+	calls, err := p.getEndedCallHistories(since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &complianceData{
+		Calls:    calls,
+		Users:    map[string]complianceUser{},
+		Channels: map[string]*model.Channel{},
+	}
+
+	addUser := func(userID string) {
+		if _, ok := data.Users[userID]; ok || userID == "" {
+			return
+		}
+		user, appErr := p.API.GetUser(userID)
+		if appErr != nil {
+			p.LogError("failed to get user", "userID", userID, "err", appErr.Error())
+			data.Users[userID] = complianceUser{}
+			return
+		}
+		data.Users[userID] = complianceUser{
+			Username: user.Username,
+			Email:    user.Email,
+		}
+	}
+
+	for _, h := range calls {
+		if _, ok := data.Channels[h.ChannelID]; !ok {
+			channel, appErr := p.API.GetChannel(h.ChannelID)
+			if appErr != nil {
+				p.LogError("failed to get channel", "channelID", h.ChannelID, "err", appErr.Error())
+			}
+			data.Channels[h.ChannelID] = channel
+		}
+		for _, participant := range h.Participants {
+			addUser(participant.UserID)
+		}
+		for _, rec := range h.Recordings {
+			addUser(rec.CreatorID)
+		}
+	}
+
+	return data, nil
+}
+
+func complianceExportFileName(format string, since, until int64) string {
+	ext := "csv"
+	if format == complianceExportFormatActiance {
+		ext = "xml"
+	}
+	return fmt.Sprintf("calls_compliance_%d_%d.%s", since, until, ext)
+}
+
+// runComplianceExport writes the calls that ended since the previous run to
+// the configured export directory, leaving out the most recent ones until
+// their recordings are in.
+func (p *Plugin) runComplianceExport() {
+	cfg := p.getConfiguration()
+	if cfg.ComplianceExportDirectory == "" {
+		return
+	}
+
+	var since int64
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(complianceExportLastKey)
+	if appErr != nil {
+		p.LogError("failed to get last compliance export time", "err", appErr.Error())
+		return
+	}
+	if data != nil {
+		if err := json.Unmarshal(data, &since); err != nil {
+			p.LogError("failed to unmarshal last compliance export time", "err", err.Error())
+			return
+		}
+	}
+	until := time.Now().Add(-complianceExportDelay).UnixMilli()
+	if until <= since {
+		return
+	}
+
+	exportData, err := p.getComplianceData(since, until)
+	if err != nil {
+		p.LogError("failed to get compliance export data", "err", err.Error())
+		return
+	}
+
+	path := filepath.Join(cfg.ComplianceExportDirectory, complianceExportFileName(cfg.ComplianceExportFormat, since, until))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		p.LogError("failed to create compliance export file", "err", err.Error())
+		return
+	}
+	if err := writeComplianceExport(f, cfg.ComplianceExportFormat, exportData); err != nil {
+		p.LogError("failed to write compliance export", "err", err.Error(), "path", path)
+		f.Close()
+		return
+	}
+	if err := f.Close(); err != nil {
+		p.LogError("failed to close compliance export file", "err", err.Error(), "path", path)
+		return
+	}
+
+	data, err = json.Marshal(until)
+	if err != nil {
+		p.LogError(err.Error())
+		return
+	}
+	p.metrics.IncStoreOp("KVSet")
+	if appErr := p.API.KVSet(complianceExportLastKey, data); appErr != nil {
+		p.LogError("failed to set last compliance export time", "err", appErr.Error())
+		return
+	}
+
+	p.LogInfo("compliance export completed", "path", path, "calls", len(exportData.Calls))
+}
+
+func (p *Plugin) handleGetComplianceExport(w http.ResponseWriter, r *http.Request) {
+	var res httpResponse
+	defer p.httpAudit("handleGetComplianceExport", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = complianceExportFormatCSV
+	}
+	if format != complianceExportFormatCSV && format != complianceExportFormatActiance {
+		res.Err = "invalid format parameter"
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	var since int64
+	until := time.Now().UnixMilli()
+	var err error
+	if val := query.Get("since"); val != "" {
+		if since, err = strconv.ParseInt(val, 10, 64); err != nil {
+			res.Err = "invalid since parameter"
+			res.Code = http.StatusBadRequest
+			return
+		}
+	}
+	if val := query.Get("until"); val != "" {
+		if until, err = strconv.ParseInt(val, 10, 64); err != nil {
+			res.Err = "invalid until parameter"
+			res.Code = http.StatusBadRequest
+			return
+		}
+	}
+
+	data, err := p.getComplianceData(since, until)
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	contentType := "text/csv"
+	if format == complianceExportFormatActiance {
+		contentType = "application/xml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", complianceExportFileName(format, since, until)))
+	if err := writeComplianceExport(w, format, data); err != nil {
+		p.LogError(err.Error())
+	}
+}
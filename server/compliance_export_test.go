@@ -0,0 +1,169 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestComplianceData() *complianceData {
+	return &complianceData{
+		Calls: []*callHistory{
+			{
+				ID:        "callA",
+				ChannelID: "channelA",
+				StartAt:   10000,
+				EndAt:     70000,
+				OwnerID:   "userA",
+				Participants: []callHistoryParticipant{
+					{UserID: "userA", SessionID: "connA", JoinAt: 10000, LeaveAt: 70000},
+					{UserID: "userB", SessionID: "connB", JoinAt: 20000, LeaveAt: 50000},
+				},
+				Recordings: []callHistoryRecording{
+					{
+						ID:                   "recA",
+						CreatorID:            "userA",
+						FileIDs:              []string{"fileA", "fileB"},
+						RecordingStateClient: RecordingStateClient{EndAt: 60000},
+					},
+				},
+			},
+			{
+				ID:        "callB",
+				ChannelID: "channelB",
+				StartAt:   80000,
+				EndAt:     90000,
+				OwnerID:   "userB",
+			},
+		},
+		Users: map[string]complianceUser{
+			"userA": {Username: "alice", Email: "alice@example.com"},
+			"userB": {Username: "bob", Email: "bob@example.com"},
+		},
+		Channels: map[string]*model.Channel{
+			"channelA": {Id: "channelA", Name: "town-square", TeamId: "teamA"},
+		},
+	}
+}
+
+func TestWriteComplianceCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeComplianceExport(&buf, complianceExportFormatCSV, newTestComplianceData()))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		complianceCSVHeader,
+		{"callA", "channelA", "town-square", "teamA", "10000", "70000", "60", "userA", "userA", "alice", "alice@example.com", "10000", "70000", "60", "fileA;fileB"},
+		{"callA", "channelA", "town-square", "teamA", "10000", "70000", "60", "userA", "userB", "bob", "bob@example.com", "20000", "50000", "30", "fileA;fileB"},
+		{"callB", "channelB", "", "", "80000", "90000", "10", "userB", "", "", "", "", "", "", ""},
+	}, rows)
+}
+
+func TestWriteComplianceActiance(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeComplianceExport(&buf, complianceExportFormatActiance, newTestComplianceData()))
+
+	var dump actianceFileDump
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &dump))
+	require.Len(t, dump.Conversations, 2)
+
+	conv := dump.Conversations[0]
+	require.Equal(t, "town-square", conv.Perspective)
+	require.Equal(t, "calls - town-square - callA", conv.RoomID)
+	require.Equal(t, int64(10), conv.StartTimeUTC)
+	require.Equal(t, int64(70), conv.EndTimeUTC)
+	require.Equal(t, []actianceParticipantEvent{
+		{LoginName: "alice", UserType: "user", DateTimeUTC: 10, CorporateEmailID: "alice@example.com"},
+		{LoginName: "bob", UserType: "user", DateTimeUTC: 20, CorporateEmailID: "bob@example.com"},
+	}, conv.ParticipantEntered)
+	require.Equal(t, []actianceParticipantEvent{
+		{LoginName: "alice", UserType: "user", DateTimeUTC: 70, CorporateEmailID: "alice@example.com"},
+		{LoginName: "bob", UserType: "user", DateTimeUTC: 50, CorporateEmailID: "bob@example.com"},
+	}, conv.ParticipantLeft)
+	require.Equal(t, []actianceFileTransfer{
+		{LoginName: "alice", UserType: "user", FileName: "fileA", DateTimeUTC: 60},
+		{LoginName: "alice", UserType: "user", FileName: "fileB", DateTimeUTC: 60},
+	}, conv.FileTransferStarted)
+
+	require.Empty(t, dump.Conversations[1].ParticipantEntered)
+}
+
+func TestWriteComplianceExportInvalidFormat(t *testing.T) {
+	var buf bytes.Buffer
+	require.EqualError(t, writeComplianceExport(&buf, "pdf", newTestComplianceData()), `invalid export format "pdf"`)
+}
+
+func TestFilterCallHistoryEndedShards(t *testing.T) {
+	shards := []string{"20261017", "20261015", "20261016"}
+	at := func(day, hour int) int64 {
+		return time.Date(2026, time.October, day, hour, 0, 0, 0, time.UTC).UnixMilli()
+	}
+
+	require.Equal(t, []string{"20261015", "20261016", "20261017"}, filterCallHistoryEndedShards(shards, 0, at(18, 0)))
+	require.Equal(t, []string{"20261016", "20261017"}, filterCallHistoryEndedShards(shards, at(16, 12), at(18, 0)))
+	require.Equal(t, []string{"20261015"}, filterCallHistoryEndedShards(shards, 0, at(15, 12)))
+	require.Empty(t, filterCallHistoryEndedShards(shards, at(18, 0), at(19, 0)))
+}
+
+func TestRunComplianceExport(t *testing.T) {
+	p, api, store := newTestPlugin(t)
+	dir := t.TempDir()
+	p.configuration.ComplianceExportDirectory = dir
+
+	now := time.Now()
+	for callID, endAt := range map[string]time.Time{
+		"callA": now.Add(-48 * time.Hour),
+		"callB": now.Add(-2 * time.Hour),
+		"callC": now.Add(-10 * time.Minute),
+	} {
+		require.NoError(t, p.kvSetAtomicCallHistory(callID, "channelID", func(history *callHistory) error {
+			history.StartAt = endAt.Add(-time.Hour).UnixMilli()
+			history.end(endAt.UnixMilli(), callStats{})
+			return nil
+		}))
+		require.NoError(t, p.addCallHistoryEndedEntry(callHistoryEndedEntry{ID: callID, EndAt: endAt.UnixMilli()}))
+	}
+
+	// The previous run exported callA already.
+	since := now.Add(-24 * time.Hour).UnixMilli()
+	data, err := json.Marshal(since)
+	require.NoError(t, err)
+	store.set(complianceExportLastKey, data)
+
+	api.On("GetChannel", "channelID").Return(&model.Channel{Id: "channelID", Name: "town-square"}, nil).Once()
+
+	p.runComplianceExport()
+
+	// Ended calls are found through the index rather than by listing keys.
+	api.AssertNotCalled(t, "KVList", mock.Anything, mock.Anything)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	content, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	rows, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	require.NoError(t, err)
+
+	// callC is left for the next run since its recordings may not be in yet.
+	require.Len(t, rows, 2)
+	require.Equal(t, "callB", rows[1][0])
+
+	var until int64
+	require.NoError(t, json.Unmarshal(store.get(complianceExportLastKey), &until))
+	require.InDelta(t, now.Add(-complianceExportDelay).UnixMilli(), until, float64(time.Minute.Milliseconds()))
+}
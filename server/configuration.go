@@ -39,6 +39,14 @@ type configuration struct {
 	// The URL to a running RTCD service instance that should host the calls.
 	// When set (non empty) all calls will be handled by the external service.
 	RTCDServiceURL string
+	// The strategy used to choose the RTCD host new calls are routed to.
+	RTCDPlacementStrategy string
+	// A list of additional RTCD pools calls can be routed to based on their
+	// team or channel.
+	RTCDPools RTCDPoolsConfigs
+	// When set to true new calls are hosted on the embedded RTC server if
+	// no RTCD host is available.
+	EnableRTCDFallback *bool
 	// The secret key used to generate TURN short-lived authentication credentials
 	TURNStaticAuthSecret string
 	// The number of minutes that the generated TURN credentials will be valid for.
@@ -50,6 +58,30 @@ type configuration struct {
 	JobServiceURL string
 	// The audio and video quality of call recordings.
 	RecordingQuality string
+	// When set to true call recordings get transcribed once completed.
+	EnableTranscriptions *bool
+	// The number of days unpublished recordings are kept for before getting
+	// purged. The zero value means they are kept indefinitely.
+	RecordingRetentionDays *int
+	// The path to the file call lifecycle audit records are appended to.
+	// The zero value disables the audit log.
+	AuditLogFile string
+	// The local directory call compliance exports are periodically written
+	// to. The zero value disables scheduled exports.
+	ComplianceExportDirectory string
+	// The format of compliance exports, either csv or actiance.
+	ComplianceExportFormat string
+	// A list of endpoints call lifecycle events get posted to.
+	OutgoingWebhooks OutgoingWebhooksConfigs
+	// A comma separated list of the IDs of plugins allowed to use the
+	// inter-plugin API.
+	PluginAPIAllowedPlugins string
+	// When set to true the other members of direct and group channels are
+	// rung when a call starts.
+	EnableRinging *bool
+	// When set to true call hosts who can manage the channel's members can
+	// add users who are not members by inviting them to a call.
+	EnableInviteNonMembers *bool
 
 	clientConfig
 }
@@ -174,6 +206,27 @@ func (c *configuration) SetDefaults() {
 	if c.RecordingQuality == "" {
 		c.RecordingQuality = "medium"
 	}
+	if c.RTCDPlacementStrategy == "" {
+		c.RTCDPlacementStrategy = rtcdPlacementLeastCalls
+	}
+	if c.EnableTranscriptions == nil {
+		c.EnableTranscriptions = new(bool)
+	}
+	if c.EnableRTCDFallback == nil {
+		c.EnableRTCDFallback = new(bool)
+	}
+	if c.EnableRinging == nil {
+		c.EnableRinging = new(bool)
+	}
+	if c.EnableInviteNonMembers == nil {
+		c.EnableInviteNonMembers = new(bool)
+	}
+	if c.RecordingRetentionDays == nil {
+		c.RecordingRetentionDays = new(int)
+	}
+	if c.ComplianceExportFormat == "" {
+		c.ComplianceExportFormat = complianceExportFormatCSV
+	}
 }
 
 func (c *configuration) IsValid() error {
@@ -205,6 +258,26 @@ func (c *configuration) IsValid() error {
 		return fmt.Errorf("RecordingQuality is not valid")
 	}
 
+	if c.RTCDPlacementStrategy != rtcdPlacementLeastCalls && c.RTCDPlacementStrategy != rtcdPlacementLoadAware {
+		return fmt.Errorf("RTCDPlacementStrategy is not valid")
+	}
+
+	if err := c.RTCDPools.IsValid(); err != nil {
+		return fmt.Errorf("RTCDPools is not valid: %w", err)
+	}
+
+	if c.RecordingRetentionDays != nil && *c.RecordingRetentionDays < 0 {
+		return fmt.Errorf("RecordingRetentionDays is not valid: should not be negative")
+	}
+
+	if c.ComplianceExportFormat != complianceExportFormatCSV && c.ComplianceExportFormat != complianceExportFormatActiance {
+		return fmt.Errorf("ComplianceExportFormat is not valid")
+	}
+
+	if err := c.OutgoingWebhooks.IsValid(); err != nil {
+		return fmt.Errorf("OutgoingWebhooks is not valid: %w", err)
+	}
+
 	return nil
 }
 
@@ -215,9 +288,14 @@ func (c *configuration) Clone() *configuration {
 	cfg.UDPServerAddress = c.UDPServerAddress
 	cfg.ICEHostOverride = c.ICEHostOverride
 	cfg.RTCDServiceURL = c.RTCDServiceURL
+	cfg.RTCDPlacementStrategy = c.RTCDPlacementStrategy
 	cfg.JobServiceURL = c.JobServiceURL
 	cfg.TURNStaticAuthSecret = c.TURNStaticAuthSecret
 	cfg.RecordingQuality = c.RecordingQuality
+	cfg.AuditLogFile = c.AuditLogFile
+	cfg.ComplianceExportDirectory = c.ComplianceExportDirectory
+	cfg.ComplianceExportFormat = c.ComplianceExportFormat
+	cfg.PluginAPIAllowedPlugins = c.PluginAPIAllowedPlugins
 
 	if c.UDPServerPort != nil {
 		cfg.UDPServerPort = new(int)
@@ -241,6 +319,23 @@ func (c *configuration) Clone() *configuration {
 		copy(cfg.ICEServersConfigs, c.ICEServersConfigs)
 	}
 
+	if c.RTCDPools != nil {
+		cfg.RTCDPools = make(RTCDPoolsConfigs, len(c.RTCDPools))
+		for i, pool := range c.RTCDPools {
+			cfg.RTCDPools[i] = pool
+			cfg.RTCDPools[i].TeamIDs = append([]string(nil), pool.TeamIDs...)
+			cfg.RTCDPools[i].ChannelIDs = append([]string(nil), pool.ChannelIDs...)
+		}
+	}
+
+	if c.OutgoingWebhooks != nil {
+		cfg.OutgoingWebhooks = make(OutgoingWebhooksConfigs, len(c.OutgoingWebhooks))
+		for i, hook := range c.OutgoingWebhooks {
+			cfg.OutgoingWebhooks[i] = hook
+			cfg.OutgoingWebhooks[i].Events = append([]string(nil), hook.Events...)
+		}
+	}
+
 	if c.MaxCallParticipants != nil {
 		cfg.MaxCallParticipants = model.NewInt(*c.MaxCallParticipants)
 	}
@@ -265,9 +360,55 @@ func (c *configuration) Clone() *configuration {
 		cfg.MaxRecordingDuration = model.NewInt(*c.MaxRecordingDuration)
 	}
 
+	if c.EnableTranscriptions != nil {
+		cfg.EnableTranscriptions = model.NewBool(*c.EnableTranscriptions)
+	}
+
+	if c.EnableRTCDFallback != nil {
+		cfg.EnableRTCDFallback = model.NewBool(*c.EnableRTCDFallback)
+	}
+
+	if c.EnableRinging != nil {
+		cfg.EnableRinging = model.NewBool(*c.EnableRinging)
+	}
+
+	if c.EnableInviteNonMembers != nil {
+		cfg.EnableInviteNonMembers = model.NewBool(*c.EnableInviteNonMembers)
+	}
+
+	if c.RecordingRetentionDays != nil {
+		cfg.RecordingRetentionDays = model.NewInt(*c.RecordingRetentionDays)
+	}
+
 	return &cfg
 }
 
+func (c *configuration) rtcdFallbackEnabled() bool {
+	return c.EnableRTCDFallback != nil && *c.EnableRTCDFallback
+}
+
+// pluginAPIAllowed returns whether the given plugin is allowed to use the
+// inter-plugin API.
+func (c *configuration) pluginAPIAllowed(pluginID string) bool {
+	if pluginID == "" {
+		return false
+	}
+	for _, id := range strings.Split(c.PluginAPIAllowedPlugins, ",") {
+		if strings.TrimSpace(id) == pluginID {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *configuration) ringingEnabled() bool {
+	return c.EnableRinging != nil && *c.EnableRinging
+}
+
+func (c *configuration) inviteNonMembersEnabled() bool {
+	return c.EnableInviteNonMembers != nil && *c.EnableInviteNonMembers
+}
+
 func (c *configuration) getRTCDURL() string {
 	if url := os.Getenv("MM_CALLS_RTCD_URL"); url != "" {
 		return url
@@ -289,6 +430,10 @@ func (c *configuration) recordingsEnabled() bool {
 	return false
 }
 
+func (c *configuration) transcriptionsEnabled() bool {
+	return c.recordingsEnabled() && c.EnableTranscriptions != nil && *c.EnableTranscriptions
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
@@ -402,6 +547,9 @@ func (p *Plugin) setOverrides(cfg *configuration) {
 	cfg.UDPServerAddress = strings.TrimSpace(cfg.UDPServerAddress)
 	cfg.RTCDServiceURL = strings.TrimSpace(cfg.RTCDServiceURL)
 	cfg.JobServiceURL = strings.TrimSpace(cfg.JobServiceURL)
+	cfg.AuditLogFile = strings.TrimSpace(cfg.AuditLogFile)
+	cfg.ComplianceExportDirectory = strings.TrimSpace(cfg.ComplianceExportDirectory)
+	cfg.PluginAPIAllowedPlugins = strings.TrimSpace(cfg.PluginAPIAllowedPlugins)
 }
 
 func (p *Plugin) isSingleHandler() bool {
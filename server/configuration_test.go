@@ -103,6 +103,36 @@ func TestConfigurationIsValid(t *testing.T) {
 			}(),
 			err: "RecordingQuality is not valid",
 		},
+		{
+			name: "invalid RTCDPlacementStrategy",
+			input: func() configuration {
+				var cfg configuration
+				cfg.SetDefaults()
+				cfg.RTCDPlacementStrategy = "random"
+				return cfg
+			}(),
+			err: "RTCDPlacementStrategy is not valid",
+		},
+		{
+			name: "invalid RecordingRetentionDays",
+			input: func() configuration {
+				var cfg configuration
+				cfg.SetDefaults()
+				cfg.RecordingRetentionDays = model.NewInt(-1)
+				return cfg
+			}(),
+			err: "RecordingRetentionDays is not valid: should not be negative",
+		},
+		{
+			name: "invalid ComplianceExportFormat",
+			input: func() configuration {
+				var cfg configuration
+				cfg.SetDefaults()
+				cfg.ComplianceExportFormat = "pdf"
+				return cfg
+			}(),
+			err: "ComplianceExportFormat is not valid",
+		},
 		{
 			name:  "defaults",
 			input: defaultConfig,
@@ -138,3 +168,14 @@ func TestGetClientConfig(t *testing.T) {
 	require.Equal(t, true, *clientCfg.AllowEnableCalls)
 	require.Equal(t, cfg.DefaultEnabled, clientCfg.DefaultEnabled)
 }
+
+func TestPluginAPIAllowed(t *testing.T) {
+	cfg := &configuration{}
+	require.False(t, cfg.pluginAPIAllowed("playbooks"))
+
+	cfg.PluginAPIAllowedPlugins = "playbooks, com.example.incidents"
+	require.True(t, cfg.pluginAPIAllowed("playbooks"))
+	require.True(t, cfg.pluginAPIAllowed("com.example.incidents"))
+	require.False(t, cfg.pluginAPIAllowed("com.example"))
+	require.False(t, cfg.pluginAPIAllowed(""))
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var callHostActionRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)\/host\/(mute|lower_hand|screen_off|remove)$`)
+var callHostRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)\/host$`)
+
+var errNotHost = errors.New("no permissions to perform host actions")
+var errUserRemoved = errors.New("user was removed from the call")
+
+var hostActionMsgTypes = map[string]string{
+	"mute":       clientMessageTypeHostMute,
+	"lower_hand": clientMessageTypeHostLowerHand,
+	"screen_off": clientMessageTypeHostScreenOff,
+	"remove":     clientMessageTypeHostRemove,
+}
+
+type hostActionData struct {
+	UserID string `json:"user_id"`
+}
+
+// relayUserStateMessage forwards a user state change to the RTC server
+// handling the given session, relaying it to the handler node if needed.
+func (p *Plugin) relayUserStateMessage(connID, userID, channelID, handlerID string, isRTCD bool, msg clientMessage) error {
+	if handlerID != p.nodeID {
+		return p.sendClusterMessage(clusterMessage{
+			ConnID:        connID,
+			UserID:        userID,
+			ChannelID:     channelID,
+			SenderID:      p.nodeID,
+			ClientMessage: msg,
+		}, clusterMessageTypeUserState, handlerID)
+	}
+
+	var msgType rtc.MessageType
+	switch msg.Type {
+	case clientMessageTypeMute:
+		msgType = rtc.MuteMessage
+	case clientMessageTypeUnmute:
+		msgType = rtc.UnmuteMessage
+	case clientMessageTypeScreenOn:
+		msgType = rtc.ScreenOnMessage
+	case clientMessageTypeScreenOff:
+		msgType = rtc.ScreenOffMessage
+	default:
+		return fmt.Errorf("unexpected client message type %q", msg.Type)
+	}
+
+	if err := p.sendRTCMessage(rtc.Message{
+		SessionID: connID,
+		Type:      msgType,
+		Data:      msg.Data,
+	}, channelID, isRTCD); err != nil {
+		return fmt.Errorf("failed to send RTC message: %w", err)
+	}
+
+	return nil
+}
+
+// closeUserSessions makes the sessions matching the given original connection
+// ID, handled by this node, leave the call.
+func (p *Plugin) closeUserSessions(channelID, originalConnID string) {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	for _, us := range p.sessions {
+		if us.channelID != channelID || us.originalConnID != originalConnID {
+			continue
+		}
+		if atomic.CompareAndSwapInt32(&us.left, 0, 1) {
+			p.LogDebug("closing leaveCh", "connID", us.connID, "originalConnID", originalConnID)
+			close(us.leaveCh)
+		}
+	}
+}
+
+// handleHostAction performs an action on behalf of the call host on another
+// participant.
+func (p *Plugin) handleHostAction(hostID, channelID, msgType, userID string) error {
+	if userID == "" {
+		return fmt.Errorf("missing userID")
+	}
+	if p.isBot(userID) {
+		return fmt.Errorf("cannot perform host actions on the bot")
+	}
+
+	var prevState channelState
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		if state == nil {
+			return nil, fmt.Errorf("channel state is missing from store")
+		}
+		if state.Call == nil {
+			return nil, fmt.Errorf("no call ongoing")
+		}
+		if state.Call.HostID != hostID {
+			return nil, errNotHost
+		}
+		uState := state.Call.Users[userID]
+		if uState == nil {
+			return nil, fmt.Errorf("user is not in the call")
+		}
+
+		prevState = *state.Clone()
+
+		switch msgType {
+		case clientMessageTypeHostMute:
+			uState.Unmuted = false
+		case clientMessageTypeHostLowerHand:
+			uState.RaisedHand = 0
+		case clientMessageTypeHostScreenOff:
+			if state.Call.ScreenSharingID != userID {
+				return nil, fmt.Errorf("user is not sharing their screen")
+			}
+			state.Call.ScreenSharingID = ""
+			state.Call.ScreenStreamID = ""
+			if state.Call.ScreenStartAt > 0 {
+				state.Call.Stats.ScreenDuration += secondsSinceTimestamp(state.Call.ScreenStartAt)
+				state.Call.ScreenStartAt = 0
+			}
+		case clientMessageTypeHostRemove:
+			// The session gets removed from the state once it leaves the
+			// call. The user is kept out for the rest of the call.
+			if state.Call.Removed == nil {
+				state.Call.Removed = make(map[string]struct{})
+			}
+			state.Call.Removed[userID] = struct{}{}
+			delete(state.Call.Admitted, userID)
+		default:
+			return nil, fmt.Errorf("unexpected host action %q", msgType)
+		}
+
+		return state, nil
+	}); err != nil {
+		return err
+	}
+
+	connID := prevState.Call.Users[userID].ConnID
+
+	handlerID := p.getCallHandlerID(&prevState)
+	isRTCD := p.isRTCDCall(&prevState)
+
+	switch msgType {
+	case clientMessageTypeHostMute:
+		if err := p.relayUserStateMessage(connID, userID, channelID, handlerID, isRTCD, clientMessage{Type: clientMessageTypeMute}); err != nil {
+			p.LogError(err.Error())
+		}
+		p.publishWebSocketEvent(wsEventUserMuted, map[string]interface{}{
+			"userID": userID,
+		}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+		p.publishWebSocketEvent(wsEventHostMute, map[string]interface{}{
+			"channelID": channelID,
+		}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+	case clientMessageTypeHostLowerHand:
+		p.publishWebSocketEvent(wsEventUserUnraiseHand, map[string]interface{}{
+			"userID":      userID,
+			"raised_hand": 0,
+		}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+		p.publishWebSocketEvent(wsEventHostLowerHand, map[string]interface{}{
+			"channelID": channelID,
+		}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+	case clientMessageTypeHostScreenOff:
+		if err := p.relayUserStateMessage(connID, userID, channelID, handlerID, isRTCD, clientMessage{Type: clientMessageTypeScreenOff}); err != nil {
+			p.LogError(err.Error())
+		}
+		p.publishWebSocketEvent(wsEventUserScreenOff, map[string]interface{}{
+			"userID": userID,
+		}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+		p.publishWebSocketEvent(wsEventHostScreenOff, map[string]interface{}{
+			"channelID": channelID,
+		}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+	case clientMessageTypeHostRemove:
+		p.publishWebSocketEvent(wsEventHostRemoved, map[string]interface{}{
+			"channelID": channelID,
+		}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+
+		p.closeUserSessions(channelID, connID)
+		if err := p.sendClusterMessage(clusterMessage{
+			ConnID:    connID,
+			UserID:    userID,
+			ChannelID: channelID,
+			SenderID:  p.nodeID,
+		}, clusterMessageTypeHostRemove, ""); err != nil {
+			p.LogError(err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (p *Plugin) handleHostActionRequest(w http.ResponseWriter, r *http.Request, channelID, action string) {
+	var res httpResponse
+	defer p.httpAudit("handleHostActionRequest", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var data hostActionData
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&data); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if err := p.handleHostAction(userID, channelID, hostActionMsgTypes[action], data.UserID); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		if errors.Is(err, errNotHost) {
+			res.Code = http.StatusForbidden
+		}
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
+
+// isChannelAdmin returns whether the given user is an admin of the channel or
+// a system admin. Besides the host, these users can change the host of a call.
+func (p *Plugin) isChannelAdmin(userID, channelID string) bool {
+	if p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		return true
+	}
+
+	cm, appErr := p.API.GetChannelMember(channelID, userID)
+	return appErr == nil && cm.SchemeAdmin
+}
+
+// assignCallHost explicitly makes newHostID the host of the ongoing call. The
+// assigned user regains the host role when rejoining the call.
+func (p *Plugin) assignCallHost(requesterID, channelID, newHostID string) error {
+	if newHostID == "" {
+		return fmt.Errorf("missing user_id")
+	}
+	if p.isBot(newHostID) {
+		return fmt.Errorf("cannot assign host to the bot")
+	}
+
+	// Admin permissions don't depend on the call so they are resolved ahead of
+	// the update, whether the requester is the host is checked against it.
+	isAdmin := p.isChannelAdmin(requesterID, channelID)
+
+	var callID string
+	var prevHostID string
+	var call callState
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		if state == nil || state.Call == nil {
+			return nil, fmt.Errorf("no call ongoing")
+		}
+		if state.Call.HostID != requesterID && !isAdmin {
+			return nil, errNotHost
+		}
+		if state.Call.Users[newHostID] == nil {
+			return nil, fmt.Errorf("user is not in the call")
+		}
+
+		callID = state.Call.ID
+		prevHostID = state.Call.HostID
+		state.Call.HostID = newHostID
+		state.Call.AssignedHostID = newHostID
+		call = *state.Call.Clone()
+
+		return state, nil
+	}); err != nil {
+		return err
+	}
+
+	if prevHostID == newHostID {
+		return nil
+	}
+
+	// Sending both events, call_host_changed keeps the clients state in sync
+	// while call_host_assigned lets them notify about the explicit change.
+	p.publishWebSocketEvent(wsEventCallHostChanged, map[string]interface{}{
+		"hostID": newHostID,
+	}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+	p.publishWebSocketEvent(wsEventCallHostAssigned, map[string]interface{}{
+		"hostID":     newHostID,
+		"prevHostID": prevHostID,
+		"assignedBy": requesterID,
+	}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+
+	p.addCallHistoryHostChange(channelID, callID, newHostID)
+	p.notifyLobbyHost(channelID, &call)
+	p.audit(auditEventHostChanged, channelID, callID, requesterID, map[string]interface{}{
+		"host_id":      newHostID,
+		"prev_host_id": prevHostID,
+	})
+
+	return nil
+}
+
+func (p *Plugin) handlePostCallHost(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handlePostCallHost", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var data struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&data); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if err := p.assignCallHost(userID, channelID, data.UserID); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		if errors.Is(err, errNotHost) {
+			res.Code = http.StatusForbidden
+		}
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostRemove(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	channel := &model.Channel{Id: model.NewId(), Type: model.ChannelTypeOpen}
+	require.NoError(t, p.kvSetAtomicChannelState(channel.Id, func(state *channelState) (*channelState, error) {
+		return &channelState{
+			NodeID: "nodeID",
+			Call: &callState{
+				ID:      "callID",
+				OwnerID: "hostID",
+				HostID:  "hostID",
+				Users: map[string]*userState{
+					"hostID": {},
+					"userID": {ConnID: "connID"},
+				},
+				Sessions: map[string]struct{}{
+					"hostConnID": {},
+					"connID":     {},
+				},
+				Admitted: map[string]struct{}{
+					"userID": {},
+				},
+			},
+		}, nil
+	}))
+
+	api.On("PublishWebSocketEvent", wsEventHostRemoved, mock.Anything, &model.WebsocketBroadcast{UserId: "userID", ReliableClusterSend: true}).Once()
+	api.On("PublishPluginClusterEvent", mock.Anything, mock.Anything).Return(nil).Once()
+
+	t.Run("not host", func(t *testing.T) {
+		err := p.handleHostAction("userID", channel.Id, clientMessageTypeHostRemove, "hostID")
+		require.ErrorIs(t, err, errNotHost)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/calls/"+channel.Id+"/host/remove", strings.NewReader(`{"user_id": "userID"}`))
+	r.Header.Set("Mattermost-User-Id", "hostID")
+	p.ServeHTTP(nil, w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	state, err := p.kvGetChannelState(channel.Id)
+	require.NoError(t, err)
+	require.Equal(t, map[string]struct{}{"userID": {}}, state.Call.Removed)
+	require.Empty(t, state.Call.Admitted)
+
+	// Simulate the session leaving the call.
+	require.NoError(t, p.kvSetAtomicChannelState(channel.Id, func(state *channelState) (*channelState, error) {
+		delete(state.Call.Users, "userID")
+		delete(state.Call.Sessions, "connID")
+		return state, nil
+	}))
+
+	// The removed user cannot join again, even through a new session.
+	_, _, err = p.addUserSession("userID", "newConnID", channel)
+	require.ErrorIs(t, err, errUserRemoved)
+}
+
+func TestAssignCallHost(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	channelID := model.NewId()
+	require.NoError(t, p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		return &channelState{
+			Call: &callState{
+				ID:      "callID",
+				OwnerID: "hostID",
+				HostID:  "hostID",
+				Users: map[string]*userState{
+					"hostID":  {},
+					"userID":  {},
+					"adminID": {},
+				},
+			},
+		}, nil
+	}))
+
+	api.On("HasPermissionTo", mock.AnythingOfType("string"), model.PermissionManageSystem).Return(false)
+	api.On("GetChannelMember", channelID, "userID").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannelMember", channelID, "hostID").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannelMember", channelID, "adminID").Return(&model.ChannelMember{SchemeAdmin: true}, nil)
+	api.On("PublishWebSocketEvent", mock.Anything, mock.Anything, mock.Anything)
+
+	t.Run("not host", func(t *testing.T) {
+		require.ErrorIs(t, p.assignCallHost("userID", channelID, "userID"), errNotHost)
+	})
+
+	t.Run("host", func(t *testing.T) {
+		require.NoError(t, p.assignCallHost("hostID", channelID, "userID"))
+		state, err := p.kvGetChannelState(channelID)
+		require.NoError(t, err)
+		require.Equal(t, "userID", state.Call.HostID)
+
+		// The previous host can no longer assign it.
+		require.ErrorIs(t, p.assignCallHost("hostID", channelID, "hostID"), errNotHost)
+	})
+
+	t.Run("channel admin", func(t *testing.T) {
+		require.NoError(t, p.assignCallHost("adminID", channelID, "hostID"))
+		state, err := p.kvGetChannelState(channelID)
+		require.NoError(t, err)
+		require.Equal(t, "hostID", state.Call.HostID)
+		require.Equal(t, "hostID", state.Call.AssignedHostID)
+	})
+}
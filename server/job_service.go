@@ -23,9 +23,13 @@ import (
 const jobServiceConfigKey = "jobservice_config"
 const runnerUpdateLockTimeout = 2 * time.Minute
 
+// jobTypeTranscribing is the type of the jobs transcribing call recordings.
+const jobTypeTranscribing offloader.JobType = "transcribing"
+
 var (
-	recordingJobRunner  = ""
-	recorderBaseConfigs = map[string]recorder.RecorderConfig{
+	recordingJobRunner     = ""
+	transcriptionJobRunner = ""
+	recorderBaseConfigs    = map[string]recorder.RecorderConfig{
 		"low": {
 			Width:        1280,
 			Height:       720,
@@ -305,3 +309,40 @@ func (s *jobService) RunRecordingJob(callID, postID, authToken string) (string,
 
 	return job.ID, nil
 }
+
+func (s *jobService) RunTranscriptionJob(callID, postID, recordingFileID, authToken string) (string, error) {
+	if transcriptionJobRunner == "" {
+		return "", fmt.Errorf("transcription job runner is not set")
+	}
+
+	serverCfg := s.ctx.API.GetConfig()
+	if serverCfg == nil {
+		return "", fmt.Errorf("failed to get server configuration")
+	}
+
+	var siteURL string
+	if serverCfg.ServiceSettings.SiteURL == nil {
+		s.ctx.LogWarn("SiteURL is not set, using default")
+		siteURL = model.ServiceSettingsDefaultSiteURL
+	} else {
+		siteURL = *serverCfg.ServiceSettings.SiteURL
+	}
+
+	job, err := s.RunJob(offloader.JobConfig{
+		Type:           jobTypeTranscribing,
+		MaxDurationSec: int64(transcriptionTimeout.Seconds()),
+		Runner:         transcriptionJobRunner,
+		InputData: map[string]interface{}{
+			"site_url":          siteURL,
+			"call_id":           callID,
+			"post_id":           postID,
+			"recording_file_id": recordingFileID,
+			"auth_token":        authToken,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return job.ID, nil
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var errUserInLobby = errors.New("user is waiting in the lobby")
+
+// errLobbyAdminUnresolved is returned by a state update that needs to know
+// whether the joining user is an admin to decide whether they should wait in
+// the lobby.
+var errLobbyAdminUnresolved = errors.New("lobby admin check needed")
+
+// lobbyKnockTimeout is how long users wait in the lobby before giving up.
+const lobbyKnockTimeout = 10 * time.Minute
+
+type lobbyUserState struct {
+	KnockAt int64  `json:"knock_at"`
+	ConnID  string `json:"conn_id"`
+}
+
+func (cs *channelState) lobbyEnabled() bool {
+	return cs.Lobby != nil && *cs.Lobby
+}
+
+// mustWaitInLobby returns whether the given user should be admitted by the
+// host before joining the ongoing call. Starting a call is never gated.
+// Channel and system admins skip the lobby as well, which is left to the
+// caller to check since it can't be done during a state update.
+func (p *Plugin) mustWaitInLobby(userID string, state *channelState) bool {
+	if !state.lobbyEnabled() || state.Call == nil {
+		return false
+	}
+
+	if p.isBot(userID) || userID == state.Call.OwnerID || userID == state.Call.HostID || userID == state.Call.AssignedHostID {
+		return false
+	}
+
+	_, ok := state.Call.Admitted[userID]
+	return !ok
+}
+
+// knockLobby notifies the host that the user is waiting to be admitted. If
+// the call has no host yet, the knock is sent once one is assigned.
+func (p *Plugin) knockLobby(userID, connID, channelID string, state channelState) {
+	if state.Call == nil {
+		return
+	}
+
+	p.mut.Lock()
+	p.lobbyConns[connID] = channelID
+	p.mut.Unlock()
+
+	p.publishWebSocketEvent(wsEventCallLobbyWaiting, map[string]interface{}{
+		"channelID": channelID,
+		"connID":    connID,
+	}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+
+	if state.Call.HostID != "" {
+		p.publishWebSocketEvent(wsEventCallLobbyKnock, map[string]interface{}{
+			"channelID": channelID,
+			"userID":    userID,
+		}, &model.WebsocketBroadcast{UserId: state.Call.HostID, ReliableClusterSend: true})
+	}
+
+	go p.expireLobbyKnockAfter(userID, connID, channelID, lobbyKnockTimeout)
+}
+
+// notifyLobbyHost sends the knocks of all the users waiting in the lobby to
+// the host of the call. It's called whenever the host changes.
+func (p *Plugin) notifyLobbyHost(channelID string, call *callState) {
+	if call == nil || call.HostID == "" {
+		return
+	}
+
+	for userID := range call.Pending {
+		p.publishWebSocketEvent(wsEventCallLobbyKnock, map[string]interface{}{
+			"channelID": channelID,
+			"userID":    userID,
+		}, &model.WebsocketBroadcast{UserId: call.HostID, ReliableClusterSend: true})
+	}
+}
+
+// leaveLobby removes the user from the lobby if still waiting from the given
+// connection, returning whether it was.
+func (p *Plugin) leaveLobby(userID, connID, channelID string) (bool, error) {
+	p.mut.Lock()
+	delete(p.lobbyConns, connID)
+	p.mut.Unlock()
+
+	var hostID string
+	var left bool
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		left = false
+		if state == nil || state.Call == nil {
+			return nil, nil
+		}
+		if us, ok := state.Call.Pending[userID]; !ok || us.ConnID != connID {
+			return nil, nil
+		}
+
+		delete(state.Call.Pending, userID)
+		hostID = state.Call.HostID
+		left = true
+
+		return state, nil
+	}); err != nil {
+		return false, err
+	}
+
+	if left && hostID != "" {
+		p.publishWebSocketEvent(wsEventCallLobbyLeft, map[string]interface{}{
+			"channelID": channelID,
+			"userID":    userID,
+		}, &model.WebsocketBroadcast{UserId: hostID, ReliableClusterSend: true})
+	}
+
+	return left, nil
+}
+
+// expireLobbyKnockAfter removes the user from the lobby if they haven't been
+// admitted or rejected once the timeout expires.
+func (p *Plugin) expireLobbyKnockAfter(userID, connID, channelID string, timeout time.Duration) {
+	select {
+	case <-time.After(timeout):
+	case <-p.stopCh:
+		return
+	}
+
+	left, err := p.leaveLobby(userID, connID, channelID)
+	if err != nil {
+		p.LogError("failed to expire lobby knock", "err", err.Error(), "userID", userID, "channelID", channelID)
+		return
+	}
+
+	if left {
+		p.publishWebSocketEvent(wsEventCallLobbyExpired, map[string]interface{}{
+			"channelID": channelID,
+		}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+	}
+}
+
+// handleLobbyAction admits or rejects a user waiting in the lobby on behalf
+// of the call host. Admitted users are expected to send a new join message.
+func (p *Plugin) handleLobbyAction(hostID, channelID, msgType, userID string) error {
+	if userID == "" {
+		return fmt.Errorf("missing userID")
+	}
+
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		if state == nil {
+			return nil, fmt.Errorf("channel state is missing from store")
+		}
+		if state.Call == nil {
+			return nil, fmt.Errorf("no call ongoing")
+		}
+		if state.Call.HostID != hostID {
+			return nil, errNotHost
+		}
+		if _, ok := state.Call.Pending[userID]; !ok {
+			return nil, fmt.Errorf("user is not waiting in the lobby")
+		}
+
+		delete(state.Call.Pending, userID)
+
+		if msgType == clientMessageTypeHostAdmit {
+			if state.Call.Admitted == nil {
+				state.Call.Admitted = make(map[string]struct{})
+			}
+			state.Call.Admitted[userID] = struct{}{}
+		}
+
+		return state, nil
+	}); err != nil {
+		return err
+	}
+
+	evType := wsEventCallLobbyRejected
+	if msgType == clientMessageTypeHostAdmit {
+		evType = wsEventCallLobbyAdmitted
+	}
+
+	p.publishWebSocketEvent(evType, map[string]interface{}{
+		"channelID": channelID,
+	}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+
+	return nil
+}
+
+func newLobbyUserState(connID string) *lobbyUserState {
+	return &lobbyUserState{
+		KnockAt: time.Now().UnixMilli(),
+		ConnID:  connID,
+	}
+}
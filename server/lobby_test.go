@@ -0,0 +1,190 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLobbyKnock(t *testing.T) {
+	setup := func(t *testing.T, hostID string) (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t)
+
+		require.NoError(t, p.kvSetAtomicChannelState("channelID", func(state *channelState) (*channelState, error) {
+			return &channelState{
+				Call: &callState{
+					ID:      "callID",
+					OwnerID: "ownerID",
+					HostID:  hostID,
+					Pending: map[string]*lobbyUserState{
+						"userID": newLobbyUserState("connID"),
+					},
+				},
+			}, nil
+		}))
+
+		return p, api
+	}
+
+	t.Run("no host", func(t *testing.T) {
+		p, api := setup(t, "")
+		api.On("PublishWebSocketEvent", wsEventCallLobbyWaiting, mock.Anything, &model.WebsocketBroadcast{UserId: "userID", ReliableClusterSend: true}).Once()
+
+		state, err := p.kvGetChannelState("channelID")
+		require.NoError(t, err)
+		p.knockLobby("userID", "connID", "channelID", *state)
+
+		// The knock is sent once a host is assigned.
+		api.On("PublishWebSocketEvent", wsEventCallLobbyKnock, map[string]interface{}{
+			"channelID": "channelID",
+			"userID":    "userID",
+		}, &model.WebsocketBroadcast{UserId: "hostID", ReliableClusterSend: true}).Once()
+		state.Call.HostID = "hostID"
+		p.notifyLobbyHost("channelID", state.Call)
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		p, api := setup(t, "hostID")
+		api.On("PublishWebSocketEvent", wsEventCallLobbyWaiting, mock.Anything, &model.WebsocketBroadcast{UserId: "userID", ReliableClusterSend: true}).Once()
+		api.On("PublishWebSocketEvent", wsEventCallLobbyKnock, mock.Anything, &model.WebsocketBroadcast{UserId: "hostID", ReliableClusterSend: true}).Once()
+		api.On("PublishWebSocketEvent", wsEventCallLobbyLeft, map[string]interface{}{
+			"channelID": "channelID",
+			"userID":    "userID",
+		}, &model.WebsocketBroadcast{UserId: "hostID", ReliableClusterSend: true}).Once()
+
+		state, err := p.kvGetChannelState("channelID")
+		require.NoError(t, err)
+		p.knockLobby("userID", "connID", "channelID", *state)
+
+		p.OnWebSocketDisconnect("connID", "userID")
+
+		require.Eventually(t, func() bool {
+			state, err := p.kvGetChannelState("channelID")
+			require.NoError(t, err)
+			return len(state.Call.Pending) == 0
+		}, time.Second, 10*time.Millisecond)
+
+		p.mut.RLock()
+		defer p.mut.RUnlock()
+		require.Empty(t, p.lobbyConns)
+	})
+
+	t.Run("stale connection", func(t *testing.T) {
+		p, _ := setup(t, "hostID")
+
+		// A connection other than the one the user knocked from doesn't
+		// remove them from the lobby.
+		left, err := p.leaveLobby("userID", "otherConnID", "channelID")
+		require.NoError(t, err)
+		require.False(t, left)
+
+		state, err := p.kvGetChannelState("channelID")
+		require.NoError(t, err)
+		require.Contains(t, state.Call.Pending, "userID")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		p, api := setup(t, "hostID")
+		api.On("PublishWebSocketEvent", wsEventCallLobbyLeft, mock.Anything, &model.WebsocketBroadcast{UserId: "hostID", ReliableClusterSend: true}).Once()
+		api.On("PublishWebSocketEvent", wsEventCallLobbyExpired, mock.Anything, &model.WebsocketBroadcast{UserId: "userID", ReliableClusterSend: true}).Once()
+
+		p.expireLobbyKnockAfter("userID", "connID", "channelID", 0)
+
+		state, err := p.kvGetChannelState("channelID")
+		require.NoError(t, err)
+		require.Empty(t, state.Call.Pending)
+	})
+}
+
+func TestAddUserSessionLobby(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	channel := &model.Channel{Id: model.NewId(), Type: model.ChannelTypeOpen}
+	setLobby := func(enabled bool) {
+		require.NoError(t, p.kvSetAtomicChannelState(channel.Id, func(_ *channelState) (*channelState, error) {
+			return &channelState{
+				Lobby: model.NewBool(enabled),
+				Call: &callState{
+					ID:       "callID",
+					OwnerID:  "ownerID",
+					HostID:   "ownerID",
+					Users:    map[string]*userState{"ownerID": {}},
+					Sessions: map[string]struct{}{"ownerConnID": {}},
+				},
+			}, nil
+		}))
+	}
+
+	t.Run("lobby disabled", func(t *testing.T) {
+		setLobby(false)
+		_, _, err := p.addUserSession("userID", "connID", channel)
+		require.NoError(t, err)
+		// Permissions are not needed when there's no lobby.
+		api.AssertNotCalled(t, "HasPermissionTo", mock.Anything, mock.Anything)
+	})
+
+	t.Run("member waits", func(t *testing.T) {
+		setLobby(true)
+		api.On("HasPermissionTo", "userID", model.PermissionManageSystem).Return(false).Once()
+		api.On("GetChannelMember", channel.Id, "userID").Return(&model.ChannelMember{}, nil).Once()
+
+		state, _, err := p.addUserSession("userID", "connID", channel)
+		require.ErrorIs(t, err, errUserInLobby)
+		require.Contains(t, state.Call.Pending, "userID")
+		require.NotContains(t, state.Call.Users, "userID")
+	})
+
+	t.Run("channel admin joins", func(t *testing.T) {
+		setLobby(true)
+		api.On("HasPermissionTo", "adminID", model.PermissionManageSystem).Return(false).Once()
+		api.On("GetChannelMember", channel.Id, "adminID").Return(&model.ChannelMember{SchemeAdmin: true}, nil).Once()
+
+		state, _, err := p.addUserSession("adminID", "adminConnID", channel)
+		require.NoError(t, err)
+		require.Contains(t, state.Call.Users, "adminID")
+	})
+}
+
+func TestHandlePostChannelLobby(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	channelID := model.NewId()
+	api.On("HasPermissionTo", "adminID", model.PermissionManageSystem).Return(true)
+
+	postChannel := func(body string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/"+channelID, strings.NewReader(body))
+		r.Header.Set("Mattermost-User-Id", "adminID")
+		p.ServeHTTP(nil, w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	api.On("PublishWebSocketEvent", "channel_enable_voice", mock.Anything, mock.Anything).Once()
+	api.On("PublishWebSocketEvent", wsEventChannelLobbyChanged, map[string]interface{}{"lobby": true}, mock.Anything).Once()
+	postChannel(`{"enabled": true, "lobby": true}`)
+
+	state, err := p.kvGetChannelState(channelID)
+	require.NoError(t, err)
+	require.True(t, *state.Enabled)
+	require.True(t, state.lobbyEnabled())
+
+	// Toggling lobby mode alone leaves calls enabled.
+	api.On("PublishWebSocketEvent", wsEventChannelLobbyChanged, map[string]interface{}{"lobby": false}, mock.Anything).Once()
+	postChannel(`{"lobby": false}`)
+
+	state, err = p.kvGetChannelState(channelID)
+	require.NoError(t, err)
+	require.True(t, *state.Enabled)
+	require.False(t, state.lobbyEnabled())
+}
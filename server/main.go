@@ -30,7 +30,9 @@ func main() {
 	plugin.ClientMain(&Plugin{
 		stopCh:      make(chan struct{}),
 		clusterEvCh: make(chan model.PluginClusterEvent, clusterEventQueueSize),
+		webhookCh:   make(chan func(), webhookQueueSize),
 		sessions:    map[string]*session{},
+		lobbyConns:  map[string]string{},
 		metrics:     performance.NewMetrics(),
 		apiLimiters: map[string]*rate.Limiter{},
 	})
@@ -19,16 +19,31 @@ const (
 	metricsSubSystemWS      = "websocket"
 	metricsSubSystemCluster = "cluster"
 	metricsSubSystemStore   = "store"
+	metricsSubSystemRTCD    = "rtcd"
+	metricsSubSystemClient  = "client"
+	metricsSubSystemCalls   = "calls"
+	metricsSubSystemRecs    = "recordings"
 )
 
 type Metrics struct {
 	registry   *prometheus.Registry
 	rtcMetrics *perf.Metrics
 
-	WebSocketConnections   *prometheus.GaugeVec
-	WebSocketEventCounters *prometheus.CounterVec
-	ClusterEventCounters   *prometheus.CounterVec
-	StoreOpCounters        *prometheus.CounterVec
+	WebSocketConnections      *prometheus.GaugeVec
+	WebSocketEventCounters    *prometheus.CounterVec
+	ClusterEventCounters      *prometheus.CounterVec
+	StoreOpCounters           *prometheus.CounterVec
+	RTCDFallbackCounter       prometheus.Counter
+	ClientRTTHistogram        prometheus.Histogram
+	ClientJitterHistogram     prometheus.Histogram
+	ClientPacketLossHistogram prometheus.Histogram
+	ClientBitrateHistogram    prometheus.Histogram
+	CallsActiveGauge          prometheus.Gauge
+	CallParticipantsHistogram prometheus.Histogram
+	CallDurationHistogram     prometheus.Histogram
+	ScreenShareCounter        prometheus.Counter
+	RecordingJobCounters      *prometheus.CounterVec
+	RTCDHostSelectionCounters *prometheus.CounterVec
 }
 
 func NewMetrics() *Metrics {
@@ -83,6 +98,124 @@ func NewMetrics() *Metrics {
 	)
 	m.registry.MustRegister(m.StoreOpCounters)
 
+	m.RTCDFallbackCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemRTCD,
+			Name:      "fallbacks_total",
+			Help:      "Total number of calls started on the embedded RTC server because no RTCD host was available",
+		},
+	)
+	m.registry.MustRegister(m.RTCDFallbackCounter)
+
+	m.ClientRTTHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemClient,
+			Name:      "rtt",
+			Help:      "Round trip time in seconds as reported by clients",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 10),
+		},
+	)
+	m.registry.MustRegister(m.ClientRTTHistogram)
+
+	m.ClientJitterHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemClient,
+			Name:      "jitter",
+			Help:      "Jitter in seconds as reported by clients",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 10),
+		},
+	)
+	m.registry.MustRegister(m.ClientJitterHistogram)
+
+	m.ClientPacketLossHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemClient,
+			Name:      "packet_loss",
+			Help:      "Fraction of packets lost as reported by clients",
+			Buckets:   []float64{0, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1},
+		},
+	)
+	m.registry.MustRegister(m.ClientPacketLossHistogram)
+
+	m.ClientBitrateHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemClient,
+			Name:      "bitrate",
+			Help:      "Bitrate in bits per second as reported by clients",
+			Buckets:   prometheus.ExponentialBuckets(8000, 2, 10),
+		},
+	)
+	m.registry.MustRegister(m.ClientBitrateHistogram)
+
+	m.CallsActiveGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemCalls,
+			Name:      "active",
+			Help:      "Number of calls started on this node that haven't ended yet. Should be summed across nodes.",
+		},
+	)
+	m.registry.MustRegister(m.CallsActiveGauge)
+
+	m.CallParticipantsHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemCalls,
+			Name:      "participants",
+			Help:      "Maximum number of participants of ended calls",
+			Buckets:   []float64{1, 2, 3, 5, 10, 20, 50, 100, 200},
+		},
+	)
+	m.registry.MustRegister(m.CallParticipantsHistogram)
+
+	m.CallDurationHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemCalls,
+			Name:      "duration_seconds",
+			Help:      "Duration of ended calls in seconds",
+			Buckets:   []float64{30, 60, 300, 600, 1800, 3600, 7200, 14400},
+		},
+	)
+	m.registry.MustRegister(m.CallDurationHistogram)
+
+	m.ScreenShareCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemCalls,
+			Name:      "screen_shares_total",
+			Help:      "Total number of screen sharing sessions started",
+		},
+	)
+	m.registry.MustRegister(m.ScreenShareCounter)
+
+	m.RecordingJobCounters = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemRecs,
+			Name:      "jobs_total",
+			Help:      "Total number of recording jobs by status",
+		},
+		[]string{"status"},
+	)
+	m.registry.MustRegister(m.RecordingJobCounters)
+
+	m.RTCDHostSelectionCounters = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubSystemRTCD,
+			Name:      "host_selections_total",
+			Help:      "Total number of calls assigned to RTCD hosts",
+		},
+		[]string{"pool", "host"},
+	)
+	m.registry.MustRegister(m.RTCDHostSelectionCounters)
+
 	m.rtcMetrics = perf.NewMetrics(metricsNamespace, m.registry)
 
 	return &m
@@ -115,3 +248,39 @@ func (m *Metrics) IncClusterEvent(evType string) {
 func (m *Metrics) IncStoreOp(op string) {
 	m.StoreOpCounters.With(prometheus.Labels{"type": op}).Inc()
 }
+
+func (m *Metrics) IncRTCDFallback() {
+	m.RTCDFallbackCounter.Inc()
+}
+
+func (m *Metrics) ObserveClientStats(rtt, jitter, packetLoss, bitrate float64) {
+	m.ClientRTTHistogram.Observe(rtt)
+	m.ClientJitterHistogram.Observe(jitter)
+	m.ClientPacketLossHistogram.Observe(packetLoss)
+	m.ClientBitrateHistogram.Observe(bitrate)
+}
+
+func (m *Metrics) IncCallsActive() {
+	m.CallsActiveGauge.Inc()
+}
+
+func (m *Metrics) DecCallsActive() {
+	m.CallsActiveGauge.Dec()
+}
+
+func (m *Metrics) ObserveCallEnded(duration float64, participants int) {
+	m.CallDurationHistogram.Observe(duration)
+	m.CallParticipantsHistogram.Observe(float64(participants))
+}
+
+func (m *Metrics) IncScreenShare() {
+	m.ScreenShareCounter.Inc()
+}
+
+func (m *Metrics) IncRecordingJob(status string) {
+	m.RecordingJobCounters.With(prometheus.Labels{"status": status}).Inc()
+}
+
+func (m *Metrics) IncRTCDHostSelection(pool, host string) {
+	m.RTCDHostSelectionCounters.With(prometheus.Labels{"pool": pool, "host": host}).Inc()
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/mattermost/rtcd/service/rtc"
 
 	pluginapi "github.com/mattermost/mattermost-plugin-api"
+	"github.com/mattermost/mattermost-plugin-api/cluster"
 	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/mattermost/mattermost-server/v6/plugin"
 )
@@ -41,12 +42,22 @@ type Plugin struct {
 	nodeID      string // the node cluster id
 	stopCh      chan struct{}
 	clusterEvCh chan model.PluginClusterEvent
+	webhookCh   chan func() // queued deliveries of call events
 	sessions    map[string]*session
+	// lobbyConns maps the connections of users waiting in the lobby to the
+	// channel of the call they are waiting for.
+	lobbyConns map[string]string
 
 	rtcServer   *rtc.Server
 	rtcdManager *rtcdClientManager
+	rtcdPools   map[string]*rtcdClientManager
 
 	jobService *jobService
+	auditSink  *auditSink
+
+	scheduledCallsJob      *cluster.Job
+	recordingsRetentionJob *cluster.Job
+	complianceExportJob    *cluster.Job
 
 	// A map of userID -> limiter to implement basic, user based API rate-limiting.
 	// TODO: consider moving this to a dedicated API object.
@@ -153,6 +164,13 @@ func (p *Plugin) handleEvent(ev model.PluginClusterEvent) error {
 			if !us.rtc {
 				delete(p.sessions, us.connID)
 			}
+			// The session continues on a different node so the quality
+			// stats collected here are flushed to the call history.
+			us.mut.Lock()
+			quality := us.quality
+			us.quality = callQualitySummary{}
+			us.mut.Unlock()
+			go p.flushSessionQuality(us, quality)
 		} else {
 			return fmt.Errorf("session already reconnected, connID=%q", msg.ConnID)
 		}
@@ -173,6 +191,32 @@ func (p *Plugin) handleEvent(ev model.PluginClusterEvent) error {
 			p.LogDebug("closing leaveCh", "connID", msg.ConnID)
 			close(us.leaveCh)
 		}
+	case clusterMessageTypeHostRemove:
+		p.LogDebug("host remove event", "ChannelID", msg.ChannelID, "UserID", msg.UserID, "ConnID", msg.ConnID)
+		p.closeUserSessions(msg.ChannelID, msg.ConnID)
+	case clusterMessageTypeMigrate:
+		p.LogDebug("migrate event", "ChannelID", msg.ChannelID, "RTCDHost", msg.RTCDHost)
+		if p.rtcdManager == nil {
+			return fmt.Errorf("rtcd manager is not initialized")
+		}
+		m, err := p.getRTCDManagerForCall(msg.ChannelID)
+		if err != nil {
+			return err
+		}
+		m.migrateSessions(msg.ChannelID, msg.RTCDHost)
+	case clusterMessageTypeRTCDHostUpdate:
+		p.LogDebug("rtcd host update event", "RTCDHost", msg.RTCDHost)
+		if p.rtcdManager == nil {
+			return fmt.Errorf("rtcd manager is not initialized")
+		}
+		for _, m := range p.getRTCDManagers() {
+			if err := m.applyHostAdminState(msg.RTCDHost); err != nil {
+				return err
+			}
+		}
+	case clusterMessageTypeCallEnded:
+		p.LogDebug("call ended event", "ChannelID", msg.ChannelID)
+		p.metrics.DecCallsActive()
 	case clusterMessageTypeDisconnect:
 		p.LogDebug("disconnect event", "ChannelID", msg.ChannelID, "UserID", msg.UserID, "ConnID", msg.ConnID)
 		p.mut.RLock()
@@ -210,7 +254,7 @@ func (p *Plugin) handleEvent(ev model.PluginClusterEvent) error {
 			Data:      msg.ClientMessage.Data,
 		}
 
-		if err := p.sendRTCMessage(rtcMsg, us.channelID); err != nil {
+		if err := p.sendRTCMessage(rtcMsg, us.channelID, us.rtcd); err != nil {
 			return fmt.Errorf("failed to send RTC message: %w", err)
 		}
 	case clusterMessageTypeUserState:
@@ -244,7 +288,7 @@ func (p *Plugin) handleEvent(ev model.PluginClusterEvent) error {
 			Data:      msg.ClientMessage.Data,
 		}
 
-		if err := p.sendRTCMessage(rtcMsg, us.channelID); err != nil {
+		if err := p.sendRTCMessage(rtcMsg, us.channelID, us.rtcd); err != nil {
 			return fmt.Errorf("failed to send RTC message: %w", err)
 		}
 	default:
@@ -267,33 +311,34 @@ func (p *Plugin) clusterEventsHandler() {
 	}
 }
 
-func (p *Plugin) startNewCallPost(userID, channelID string, startAt int64, title, threadID string) (string, string, error) {
+func (p *Plugin) getUserDisplayName(userID string) (string, error) {
 	user, appErr := p.API.GetUser(userID)
 	if appErr != nil {
-		return "", "", appErr
+		return "", appErr
 	}
 
 	cfg := p.API.GetConfig()
 	if cfg == nil {
-		return "", "", fmt.Errorf("failed to get configuration")
+		return "", fmt.Errorf("failed to get configuration")
 	}
 
 	showFullName := cfg.PrivacySettings.ShowFullName != nil && *cfg.PrivacySettings.ShowFullName
 
-	var postMsg string
 	if user.FirstName != "" && user.LastName != "" && showFullName {
-		postMsg = fmt.Sprintf("%s %s started a call", user.FirstName, user.LastName)
-	} else {
-		postMsg = fmt.Sprintf("%s started a call", user.Username)
+		return fmt.Sprintf("%s %s", user.FirstName, user.LastName), nil
 	}
 
+	return user.Username, nil
+}
+
+func newCallPost(userID, channelID, postMsg string, startAt int64, title, threadID string) *model.Post {
 	slackAttachment := model.SlackAttachment{
 		Fallback: postMsg,
 		Title:    postMsg,
 		Text:     postMsg,
 	}
 
-	post := &model.Post{
+	return &model.Post{
 		UserId:    userID,
 		ChannelId: channelID,
 		RootId:    threadID,
@@ -305,16 +350,10 @@ func (p *Plugin) startNewCallPost(userID, channelID string, startAt int64, title
 			"title":       title,
 		},
 	}
+}
 
-	createdPost, appErr := p.API.CreatePost(post)
-	if appErr != nil {
-		return "", "", appErr
-	}
-	if threadID == "" {
-		threadID = createdPost.Id
-	}
-
-	err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+func (p *Plugin) setCallPost(channelID, postID, threadID string) error {
+	return p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
 		if state == nil {
 			return nil, fmt.Errorf("channel state is missing from store")
 		}
@@ -322,14 +361,47 @@ func (p *Plugin) startNewCallPost(userID, channelID string, startAt int64, title
 			return nil, fmt.Errorf("call is missing from channel state")
 		}
 
-		state.Call.PostID = createdPost.Id
+		state.Call.PostID = postID
 		state.Call.ThreadID = threadID
 		return state, nil
 	})
+}
+
+// startCallPost creates the post of a call that has just started. If the call
+// was scheduled the post that was created along with the reminder is reused.
+func (p *Plugin) startCallPost(userID, channelID string, startAt int64, title, threadID string) (string, string, error) {
+	if threadID == "" {
+		postID, threadID, err := p.startScheduledCallPost(userID, channelID, startAt, title)
+		if err != nil {
+			p.LogError(err.Error())
+		} else if postID != "" {
+			return postID, threadID, nil
+		}
+	}
+
+	return p.startNewCallPost(userID, channelID, startAt, title, threadID)
+}
+
+func (p *Plugin) startNewCallPost(userID, channelID string, startAt int64, title, threadID string) (string, string, error) {
+	displayName, err := p.getUserDisplayName(userID)
 	if err != nil {
 		return "", "", err
 	}
 
+	post := newCallPost(userID, channelID, fmt.Sprintf("%s started a call", displayName), startAt, title, threadID)
+
+	createdPost, appErr := p.API.CreatePost(post)
+	if appErr != nil {
+		return "", "", appErr
+	}
+	if threadID == "" {
+		threadID = createdPost.Id
+	}
+
+	if err := p.setCallPost(channelID, createdPost.Id, threadID); err != nil {
+		return "", "", err
+	}
+
 	return createdPost.Id, threadID, nil
 }
 
@@ -0,0 +1,394 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// The inter-plugin API lets other plugins control calls through PluginHTTP
+// requests.
+//
+// Requests are authenticated by the Mattermost-Plugin-ID header, which the
+// server only sets on inter-plugin requests, and only the plugins configured
+// in PluginAPIAllowedPlugins are let through. These are trusted like the
+// server itself: they can read the state of any call and receive the events
+// of all calls. Actions that change a call are instead taken on behalf of a
+// user, given as user_id, and are subject to the same permission checks as
+// the user facing API.
+var pluginCallRE = regexp.MustCompile(`^\/plugin\/calls\/([a-z0-9]+)$`)
+var pluginCallActionRE = regexp.MustCompile(`^\/plugin\/calls\/([a-z0-9]+)\/(start|end)$`)
+
+const pluginCallbacksKey = "plugin_callbacks"
+
+type callInfo struct {
+	ID              string   `json:"id"`
+	ChannelID       string   `json:"channel_id"`
+	StartAt         int64    `json:"start_at"`
+	OwnerID         string   `json:"owner_id"`
+	HostID          string   `json:"host_id"`
+	PostID          string   `json:"post_id"`
+	ThreadID        string   `json:"thread_id"`
+	ScreenSharingID string   `json:"screen_sharing_id"`
+	Participants    []string `json:"participants"`
+}
+
+func newCallInfo(channelID string, call *callState) callInfo {
+	participants := make([]string, 0, len(call.Users))
+	for userID := range call.Users {
+		participants = append(participants, userID)
+	}
+	sort.Strings(participants)
+
+	return callInfo{
+		ID:              call.ID,
+		ChannelID:       channelID,
+		StartAt:         call.StartAt,
+		OwnerID:         call.OwnerID,
+		HostID:          call.HostID,
+		PostID:          call.PostID,
+		ThreadID:        call.ThreadID,
+		ScreenSharingID: call.ScreenSharingID,
+		Participants:    participants,
+	}
+}
+
+type pluginStartCallRequest struct {
+	// The user the call is started on behalf of.
+	UserID   string `json:"user_id"`
+	Title    string `json:"title"`
+	ThreadID string `json:"thread_id"`
+}
+
+type pluginEndCallRequest struct {
+	// The user the call is ended on behalf of.
+	UserID string `json:"user_id"`
+}
+
+// pluginCallback is a plugin endpoint call events get posted to.
+type pluginCallback struct {
+	PluginID string `json:"plugin_id"`
+	// The path, relative to the plugin's root, events are posted to.
+	Path string `json:"path"`
+	// The events to send. If empty all events are sent.
+	Events []string `json:"events,omitempty"`
+}
+
+func (cb pluginCallback) IsValid() error {
+	if cb.PluginID == "" {
+		return fmt.Errorf("invalid plugin id")
+	}
+	if !strings.HasPrefix(cb.Path, "/") {
+		return fmt.Errorf("path should start with a slash")
+	}
+	for _, ev := range cb.Events {
+		if !webhookEvents[ev] {
+			return fmt.Errorf("unknown event %q", ev)
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) isPluginRequest(r *http.Request) bool {
+	// The server strips this header from external requests so it can only be
+	// set by inter-plugin ones.
+	return p.getConfiguration().pluginAPIAllowed(r.Header.Get("Mattermost-Plugin-ID"))
+}
+
+func (p *Plugin) kvGetPluginCallbacks() ([]pluginCallback, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(pluginCallbacksKey)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	var callbacks []pluginCallback
+	if data == nil {
+		return callbacks, nil
+	}
+	if err := json.Unmarshal(data, &callbacks); err != nil {
+		return nil, err
+	}
+	return callbacks, nil
+}
+
+// setPluginCallback registers the callback of a plugin, replacing the
+// previous one if any. A nil callback removes the registration.
+func (p *Plugin) setPluginCallback(pluginID string, cb *pluginCallback) error {
+	return p.kvSetAtomic(pluginCallbacksKey, func(data []byte) ([]byte, error) {
+		var callbacks []pluginCallback
+		if data != nil {
+			if err := json.Unmarshal(data, &callbacks); err != nil {
+				return nil, err
+			}
+		}
+
+		updated := make([]pluginCallback, 0, len(callbacks)+1)
+		for _, existing := range callbacks {
+			if existing.PluginID != pluginID {
+				updated = append(updated, existing)
+			}
+		}
+		if cb != nil {
+			updated = append(updated, *cb)
+		}
+
+		return json.Marshal(updated)
+	})
+}
+
+func (p *Plugin) deliverPluginCallback(cb pluginCallback, payload webhookPayload, body []byte) {
+	req, err := http.NewRequest(http.MethodPost, "/"+cb.PluginID+cb.Path, bytes.NewReader(body))
+	if err != nil {
+		p.LogError("failed to create plugin callback request", "pluginID", cb.PluginID, "err", err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, payload.Event)
+	req.Header.Set(webhookDeliveryHeader, payload.ID)
+
+	resp := p.API.PluginHTTP(req)
+	if resp == nil {
+		p.LogWarn("failed to deliver plugin callback", "pluginID", cb.PluginID, "event", payload.Event)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		p.LogWarn("failed to deliver plugin callback", "pluginID", cb.PluginID, "event", payload.Event, "code", resp.StatusCode)
+	}
+}
+
+// sendPluginCallbacks posts the event to all the allowed plugins that
+// registered a callback for it.
+func (p *Plugin) sendPluginCallbacks(payload webhookPayload, body []byte) {
+	cfg := p.getConfiguration()
+	if cfg.PluginAPIAllowedPlugins == "" {
+		return
+	}
+
+	callbacks, err := p.kvGetPluginCallbacks()
+	if err != nil {
+		p.LogError("failed to get plugin callbacks", "err", err.Error())
+		return
+	}
+
+	for _, cb := range callbacks {
+		if !cfg.pluginAPIAllowed(cb.PluginID) || !eventSubscribed(cb.Events, payload.Event) {
+			continue
+		}
+		cb := cb
+		if !p.queueWebhookDelivery(func() { p.deliverPluginCallback(cb, payload, body) }) {
+			p.LogWarn("webhook queue is full, dropping plugin callback", "pluginID", cb.PluginID, "event", payload.Event)
+		}
+	}
+}
+
+func (p *Plugin) handlePluginGetCall(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handlePluginGetCall", &res, w, r)
+
+	state, err := p.kvGetChannelState(channelID)
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	if state == nil || state.Call == nil {
+		res.Err = "no call ongoing"
+		res.Code = http.StatusNotFound
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newCallInfo(channelID, state.Call)); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+func (p *Plugin) handlePluginStartCall(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handlePluginStartCall", &res, w, r)
+
+	var req pluginStartCallRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&req); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if req.UserID == "" {
+		res.Err = "user_id should not be empty"
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if !p.API.HasPermissionToChannel(req.UserID, channelID, model.PermissionCreatePost) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		res.Err = appErr.Error()
+		res.Code = appErr.StatusCode
+		return
+	}
+
+	call, err := p.startCall(channel, req.UserID, req.Title, req.ThreadID)
+	if errors.Is(err, errCallOngoing) {
+		res.Err = err.Error()
+		res.Code = http.StatusConflict
+		return
+	} else if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(newCallInfo(channelID, call)); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+func (p *Plugin) handlePluginEndCall(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handlePluginEndCall", &res, w, r)
+
+	var req pluginEndCallRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&req); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if req.UserID == "" {
+		res.Err = "user_id should not be empty"
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	isAdmin := p.API.HasPermissionTo(req.UserID, model.PermissionManageSystem)
+
+	state, err := p.kvGetChannelState(channelID)
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	if state == nil || state.Call == nil {
+		res.Err = "no call ongoing"
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if !isAdmin && state.Call.OwnerID != req.UserID {
+		res.Err = "no permissions to end the call"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	if err := p.endCall(channelID, state.Call.ID, req.UserID); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
+
+func (p *Plugin) handlePluginPostCallback(w http.ResponseWriter, r *http.Request) {
+	var res httpResponse
+	defer p.httpAudit("handlePluginPostCallback", &res, w, r)
+
+	var cb pluginCallback
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&cb); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+	cb.PluginID = r.Header.Get("Mattermost-Plugin-ID")
+
+	if err := cb.IsValid(); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if err := p.setPluginCallback(cb.PluginID, &cb); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
+
+func (p *Plugin) handlePluginDeleteCallback(w http.ResponseWriter, r *http.Request) {
+	var res httpResponse
+	defer p.httpAudit("handlePluginDeleteCallback", &res, w, r)
+
+	if err := p.setPluginCallback(r.Header.Get("Mattermost-Plugin-ID"), nil); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusInternalServerError
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
+
+func (p *Plugin) handlePluginAPI(w http.ResponseWriter, r *http.Request) {
+	if !p.isPluginRequest(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if matches := pluginCallRE.FindStringSubmatch(r.URL.Path); len(matches) == 2 {
+			p.handlePluginGetCall(w, r, matches[1])
+			return
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		if r.URL.Path == "/plugin/callbacks" {
+			p.handlePluginPostCallback(w, r)
+			return
+		}
+
+		if matches := pluginCallActionRE.FindStringSubmatch(r.URL.Path); len(matches) == 3 {
+			if matches[2] == "start" {
+				p.handlePluginStartCall(w, r, matches[1])
+			} else {
+				p.handlePluginEndCall(w, r, matches[1])
+			}
+			return
+		}
+	}
+
+	if r.Method == http.MethodDelete {
+		if r.URL.Path == "/plugin/callbacks" {
+			p.handlePluginDeleteCallback(w, r)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
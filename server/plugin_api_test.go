@@ -0,0 +1,178 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCallInfo(t *testing.T) {
+	call := &callState{
+		ID:      "callID",
+		StartAt: 1000,
+		Users: map[string]*userState{
+			"userB": {},
+			"userA": {},
+		},
+		OwnerID:  "userA",
+		HostID:   "userB",
+		PostID:   "postID",
+		ThreadID: "threadID",
+	}
+
+	require.Equal(t, callInfo{
+		ID:           "callID",
+		ChannelID:    "channelID",
+		StartAt:      1000,
+		OwnerID:      "userA",
+		HostID:       "userB",
+		PostID:       "postID",
+		ThreadID:     "threadID",
+		Participants: []string{"userA", "userB"},
+	}, newCallInfo("channelID", call))
+
+	call.Users = nil
+	require.Empty(t, newCallInfo("channelID", call).Participants)
+}
+
+func TestPluginCallbackIsValid(t *testing.T) {
+	tcs := []struct {
+		name string
+		cb   pluginCallback
+		err  string
+	}{
+		{
+			name: "valid",
+			cb:   pluginCallback{PluginID: "playbooks", Path: "/calls/events"},
+		},
+		{
+			name: "valid with events",
+			cb:   pluginCallback{PluginID: "playbooks", Path: "/calls/events", Events: []string{webhookEventCallStarted}},
+		},
+		{
+			name: "missing plugin id",
+			cb:   pluginCallback{Path: "/calls/events"},
+			err:  "invalid plugin id",
+		},
+		{
+			name: "relative path",
+			cb:   pluginCallback{PluginID: "playbooks", Path: "calls/events"},
+			err:  "path should start with a slash",
+		},
+		{
+			name: "unknown event",
+			cb:   pluginCallback{PluginID: "playbooks", Path: "/calls/events", Events: []string{"unknown"}},
+			err:  `unknown event "unknown"`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cb.IsValid()
+			if tc.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+// expectStartCall sets the expectations for starting a call on behalf of
+// the user without ringing.
+func expectStartCall(api *plugintest.API, userID string) {
+	api.On("GetUser", userID).Return(&model.User{Id: userID, Username: "username"}, nil).Once()
+	api.On("GetConfig").Return(&model.Config{}).Once()
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: "postID"}, nil).Once()
+	api.On("PublishWebSocketEvent", wsEventCallStart, mock.Anything, mock.Anything).Once()
+}
+
+func TestHandlePluginAPI(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	p.configuration.PluginAPIAllowedPlugins = "playbooks"
+
+	channel := &model.Channel{Id: model.NewId(), Type: model.ChannelTypeOpen}
+	require.NoError(t, p.kvSetAtomicChannelState(channel.Id, func(_ *channelState) (*channelState, error) {
+		return &channelState{Enabled: model.NewBool(true)}, nil
+	}))
+	api.On("GetChannel", channel.Id).Return(channel, nil).Maybe()
+
+	pluginRequest := func(pluginID, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if pluginID != "" {
+			r.Header.Set("Mattermost-Plugin-ID", pluginID)
+		}
+		// User sessions should not grant access to the API.
+		r.Header.Set("Mattermost-User-Id", "userID")
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		require.Equal(t, http.StatusUnauthorized, pluginRequest("", http.MethodGet, "/plugin/calls/"+channel.Id, "").Code)
+		require.Equal(t, http.StatusUnauthorized, pluginRequest("other", http.MethodGet, "/plugin/calls/"+channel.Id, "").Code)
+		require.Equal(t, http.StatusUnauthorized, pluginRequest("other", http.MethodPost, "/plugin/calls/"+channel.Id+"/start", `{"user_id": "userID"}`).Code)
+		require.Equal(t, http.StatusUnauthorized, pluginRequest("", http.MethodPost, "/plugin/calls/"+channel.Id+"/end", `{"user_id": "userID"}`).Code)
+		require.Equal(t, http.StatusUnauthorized, pluginRequest("", http.MethodPost, "/plugin/callbacks", `{"path": "/events"}`).Code)
+	})
+
+	t.Run("no call", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, pluginRequest("playbooks", http.MethodGet, "/plugin/calls/"+channel.Id, "").Code)
+		api.On("HasPermissionTo", "userID", model.PermissionManageSystem).Return(false).Once()
+		require.Equal(t, http.StatusBadRequest, pluginRequest("playbooks", http.MethodPost, "/plugin/calls/"+channel.Id+"/end", `{"user_id": "userID"}`).Code)
+	})
+
+	t.Run("start call without permission", func(t *testing.T) {
+		api.On("HasPermissionToChannel", "userID", channel.Id, model.PermissionCreatePost).Return(false).Once()
+		require.Equal(t, http.StatusForbidden, pluginRequest("playbooks", http.MethodPost, "/plugin/calls/"+channel.Id+"/start", `{"user_id": "userID"}`).Code)
+		require.Equal(t, http.StatusBadRequest, pluginRequest("playbooks", http.MethodPost, "/plugin/calls/"+channel.Id+"/start", `{}`).Code)
+	})
+
+	t.Run("start call", func(t *testing.T) {
+		api.On("HasPermissionToChannel", "userID", channel.Id, model.PermissionCreatePost).Return(true).Twice()
+		expectStartCall(api, "userID")
+
+		w := pluginRequest("playbooks", http.MethodPost, "/plugin/calls/"+channel.Id+"/start", `{"user_id": "userID"}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var info callInfo
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&info))
+		require.Equal(t, channel.Id, info.ChannelID)
+		require.Equal(t, "userID", info.OwnerID)
+		require.Equal(t, "postID", info.PostID)
+
+		w = pluginRequest("playbooks", http.MethodGet, "/plugin/calls/"+channel.Id, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var got callInfo
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		require.Equal(t, info.ID, got.ID)
+
+		require.Equal(t, http.StatusConflict, pluginRequest("playbooks", http.MethodPost, "/plugin/calls/"+channel.Id+"/start", `{"user_id": "userID"}`).Code)
+	})
+
+	t.Run("end call", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, pluginRequest("playbooks", http.MethodPost, "/plugin/calls/"+channel.Id+"/end", `{}`).Code)
+
+		// Only the owner or an admin can end the call.
+		api.On("HasPermissionTo", "otherID", model.PermissionManageSystem).Return(false).Once()
+		require.Equal(t, http.StatusForbidden, pluginRequest("playbooks", http.MethodPost, "/plugin/calls/"+channel.Id+"/end", `{"user_id": "otherID"}`).Code)
+
+		api.On("HasPermissionTo", "userID", model.PermissionManageSystem).Return(false).Once()
+		api.On("PublishWebSocketEvent", wsEventCallEnd, mock.Anything, mock.Anything).Once()
+		require.Equal(t, http.StatusOK, pluginRequest("playbooks", http.MethodPost, "/plugin/calls/"+channel.Id+"/end", `{"user_id": "userID"}`).Code)
+
+		state, err := p.kvGetChannelState(channel.Id)
+		require.NoError(t, err)
+		require.NotZero(t, state.Call.EndAt)
+	})
+}
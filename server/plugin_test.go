@@ -4,12 +4,23 @@
 package main
 
 import (
+	"bytes"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"sync"
 	"testing"
 
+	"github.com/mattermost/mattermost-plugin-calls/server/performance"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
 )
 
 func TestServeHTTP(t *testing.T) {
@@ -30,3 +41,139 @@ func TestServeHTTP(t *testing.T) {
 	assert.Equal("Unauthorized\n", bodyString)
 	assert.Equal(http.StatusUnauthorized, result.StatusCode)
 }
+
+// testAPI wraps the mocked API to discard logs so that tests only need to set
+// expectations for the calls they care about.
+type testAPI struct {
+	*plugintest.API
+}
+
+func (testAPI) LogDebug(string, ...interface{}) {}
+func (testAPI) LogInfo(string, ...interface{})  {}
+func (testAPI) LogWarn(string, ...interface{})  {}
+func (testAPI) LogError(string, ...interface{}) {}
+
+// testKVStore is an in-memory KV store backing the mocked API.
+type testKVStore struct {
+	mut  sync.Mutex
+	data map[string][]byte
+}
+
+func (s *testKVStore) get(key string) []byte {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.data[key]
+}
+
+func (s *testKVStore) set(key string, value []byte) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if value == nil {
+		delete(s.data, key)
+		return
+	}
+	s.data[key] = value
+}
+
+func (s *testKVStore) compareAndSet(key string, oldValue, newValue []byte) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if !bytes.Equal(s.data[key], oldValue) {
+		return false
+	}
+	s.data[key] = newValue
+	return true
+}
+
+func (s *testKVStore) compareAndDelete(key string, oldValue []byte) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if !bytes.Equal(s.data[key], oldValue) {
+		return false
+	}
+	delete(s.data, key)
+	return true
+}
+
+func (s *testKVStore) list(page, perPage int) []string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	start, end := page*perPage, (page+1)*perPage
+	if start > len(keys) {
+		return []string{}
+	}
+	if end > len(keys) {
+		end = len(keys)
+	}
+	return keys[start:end]
+}
+
+// newTestPlugin returns a plugin using a mocked API with an in-memory KV
+// store.
+func newTestPlugin(t *testing.T) (*Plugin, *plugintest.API, *testKVStore) {
+	t.Helper()
+
+	api := &plugintest.API{}
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	store := &testKVStore{data: map[string][]byte{}}
+	api.On("KVGet", mock.AnythingOfType("string")).Return(store.get, nil).Maybe()
+	api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(func(key string, value []byte) *model.AppError {
+		store.set(key, value)
+		return nil
+	}).Maybe()
+	api.On("KVDelete", mock.AnythingOfType("string")).Return(func(key string) *model.AppError {
+		store.set(key, nil)
+		return nil
+	}).Maybe()
+	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(store.compareAndSet, nil).Maybe()
+	api.On("KVCompareAndDelete", mock.AnythingOfType("string"), mock.Anything).Return(store.compareAndDelete, nil).Maybe()
+	api.On("KVList", mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(store.list, nil).Maybe()
+
+	cfg := &configuration{}
+	cfg.SetDefaults()
+
+	p := &Plugin{
+		metrics:       performance.NewMetrics(),
+		stopCh:        make(chan struct{}),
+		webhookCh:     make(chan func(), webhookQueueSize),
+		sessions:      map[string]*session{},
+		lobbyConns:    map[string]string{},
+		apiLimiters:   map[string]*rate.Limiter{},
+		configuration: cfg,
+	}
+	p.SetAPI(testAPI{api})
+	t.Cleanup(func() { close(p.stopCh) })
+
+	return p, api, store
+}
+
+func TestDecCallsActive(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	p.nodeID = "nodeA"
+
+	p.metrics.IncCallsActive()
+	p.metrics.IncCallsActive()
+
+	p.decCallsActive("channelID", "nodeA")
+	require.Equal(t, float64(1), testutil.ToFloat64(p.metrics.CallsActiveGauge))
+
+	// Calls started on a different node are decremented there.
+	var ev model.PluginClusterEvent
+	api.On("PublishPluginClusterEvent", mock.Anything, model.PluginClusterEventSendOptions{
+		SendType: model.PluginClusterEventSendTypeReliable,
+		TargetId: "nodeB",
+	}).Run(func(args mock.Arguments) {
+		ev = args.Get(0).(model.PluginClusterEvent)
+	}).Return(nil).Once()
+	p.decCallsActive("channelID", "nodeB")
+	require.Equal(t, float64(1), testutil.ToFloat64(p.metrics.CallsActiveGauge))
+
+	require.NoError(t, p.handleEvent(ev))
+	require.Zero(t, testutil.ToFloat64(p.metrics.CallsActiveGauge))
+}
@@ -13,10 +13,18 @@ import (
 	"github.com/mattermost/mattermost-server/v6/model"
 )
 
-var callRecordingActionRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)/recording/(start|stop|publish)$`)
+var callRecordingActionRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)/recording/(start|stop|pause|resume|publish)$`)
 
 const recordingJobStartTimeout = 15 * time.Second
 
+// The statuses recording jobs are counted by in metrics.
+const (
+	recordingJobStatusStarted   = "started"
+	recordingJobStatusRestarted = "restarted"
+	recordingJobStatusFailed    = "failed"
+	recordingJobStatusCompleted = "completed"
+)
+
 func (p *Plugin) recJobTimeoutChecker(callID, jobID string) {
 	time.Sleep(recordingJobStartTimeout)
 
@@ -32,10 +40,11 @@ func (p *Plugin) recJobTimeoutChecker(callID, jobID string) {
 		return
 	}
 
-	// If the recording hasn't started (bot hasn't joined yet) we notify the
-	// client.
+	// If the bot hasn't joined yet, either to start the recording or to resume
+	// it after the job got restarted, we notify the client.
 	var clientState *RecordingStateClient
-	if recState.JobID == jobID && recState.StartAt == 0 {
+	var callStateID string
+	if recState.JobID == jobID && recState.BotConnID == "" {
 		if err := p.kvSetAtomicChannelState(callID, func(state *channelState) (*channelState, error) {
 			recordingState, err := state.getRecording()
 			if err != nil {
@@ -46,6 +55,7 @@ func (p *Plugin) recJobTimeoutChecker(callID, jobID string) {
 			}
 
 			clientState = recordingState.getClientState()
+			callStateID = state.Call.ID
 			state.Call.Recording = nil
 
 			return state, nil
@@ -55,10 +65,18 @@ func (p *Plugin) recJobTimeoutChecker(callID, jobID string) {
 		}
 
 		p.LogError("timed out waiting for recorder bot to join", "callID", callID, "jobID", jobID)
+		p.metrics.IncRecordingJob(recordingJobStatusFailed)
 
 		clientState.Err = "failed to start recording job: timed out waiting for bot to join call"
 		clientState.EndAt = time.Now().UnixMilli()
 
+		p.setCallHistoryRecording(callID, callStateID, &recordingState{
+			ID:                   recState.ID,
+			CreatorID:            recState.CreatorID,
+			JobID:                recState.JobID,
+			RecordingStateClient: *clientState,
+		})
+
 		p.publishWebSocketEvent(wsEventCallRecordingState, map[string]interface{}{
 			"callID":   callID,
 			"recState": clientState.toMap(),
@@ -97,13 +115,13 @@ func (p *Plugin) handleRecordingAction(w http.ResponseWriter, r *http.Request, c
 	}
 
 	if action == "publish" {
-		res.Err = "Not implemented"
-		res.Code = http.StatusNotImplemented
+		p.handlePublishRecording(w, r, callID, &res)
 		return
 	}
 
 	var recState recordingState
 	var postID string
+	var callStateID string
 	if err := p.kvSetAtomicChannelState(callID, func(state *channelState) (*channelState, error) {
 		if state == nil {
 			return nil, fmt.Errorf("channel state is missing from store")
@@ -114,6 +132,9 @@ func (p *Plugin) handleRecordingAction(w http.ResponseWriter, r *http.Request, c
 		if state.Call.HostID != userID {
 			return nil, fmt.Errorf("no permissions to record")
 		}
+		if action == "start" && !state.Policy.recordingsAllowed() {
+			return nil, fmt.Errorf("recordings are not allowed in this channel")
+		}
 		if action == "start" && state.Call.Recording != nil && state.Call.Recording.EndAt == 0 {
 			return nil, fmt.Errorf("recording already in progress")
 		}
@@ -121,6 +142,8 @@ func (p *Plugin) handleRecordingAction(w http.ResponseWriter, r *http.Request, c
 			return nil, fmt.Errorf("no recording in progress")
 		}
 
+		callStateID = state.Call.ID
+
 		if action == "start" {
 			recState.ID = model.NewId()
 			recState.CreatorID = userID
@@ -130,7 +153,27 @@ func (p *Plugin) handleRecordingAction(w http.ResponseWriter, r *http.Request, c
 		} else if action == "stop" {
 			recState = *state.Call.Recording
 			recState.EndAt = time.Now().UnixMilli()
+			if recState.isPaused() {
+				_ = recState.resume(recState.EndAt)
+			}
 			state.Call.Recording = nil
+		} else if action == "pause" || action == "resume" {
+			if state.Call.Recording == nil {
+				return nil, fmt.Errorf("no recording in progress")
+			}
+			// The recorder bot gets the recording state event below and
+			// stops writing media to the file until the recording is
+			// resumed, so a single file is produced.
+			var err error
+			if action == "pause" {
+				err = state.Call.Recording.pause(time.Now().UnixMilli())
+			} else {
+				err = state.Call.Recording.resume(time.Now().UnixMilli())
+			}
+			if err != nil {
+				return nil, err
+			}
+			recState = *state.Call.Recording
 		}
 
 		return state, nil
@@ -172,6 +215,7 @@ func (p *Plugin) handleRecordingAction(w http.ResponseWriter, r *http.Request, c
 			}); err != nil {
 				p.LogError(err.Error())
 			}
+			p.metrics.IncRecordingJob(recordingJobStatusFailed)
 			res.Err = "failed to create recording job: " + err.Error()
 			res.Code = http.StatusInternalServerError
 			return
@@ -195,6 +239,14 @@ func (p *Plugin) handleRecordingAction(w http.ResponseWriter, r *http.Request, c
 		}
 
 		p.LogDebug("recording job started successfully", "jobID", recJobID, "callID", callID)
+		p.metrics.IncRecordingJob(recordingJobStatusStarted)
+		p.audit(auditEventRecordingStarted, callID, callStateID, userID, map[string]interface{}{
+			"recording_id": recState.ID,
+			"job_id":       recJobID,
+		})
+
+		recState.JobID = recJobID
+		p.setCallHistoryRecording(callID, callStateID, &recState)
 
 		p.publishWebSocketEvent(wsEventCallRecordingState, map[string]interface{}{
 			"callID":   callID,
@@ -202,6 +254,7 @@ func (p *Plugin) handleRecordingAction(w http.ResponseWriter, r *http.Request, c
 		}, &model.WebsocketBroadcast{ChannelId: callID, ReliableClusterSend: true})
 
 		go p.recJobTimeoutChecker(callID, recJobID)
+		go p.recJobMonitor(callID, recState.ID, recJobID)
 	} else if action == "stop" {
 		// Sending the event prior to making the API call to the job service
 		// since it could take a few seconds to complete but we want clients
@@ -211,11 +264,25 @@ func (p *Plugin) handleRecordingAction(w http.ResponseWriter, r *http.Request, c
 			"recState": recState.getClientState().toMap(),
 		}, &model.WebsocketBroadcast{ChannelId: callID, ReliableClusterSend: true})
 
+		p.setCallHistoryRecording(callID, callStateID, &recState)
+		p.audit(auditEventRecordingStopped, callID, callStateID, userID, map[string]interface{}{
+			"recording_id": recState.ID,
+			"job_id":       recState.JobID,
+		})
+
 		if err := p.jobService.StopJob(recState.JobID); err != nil {
 			res.Err = "failed to stop recording job: " + err.Error()
 			res.Code = http.StatusInternalServerError
 			return
 		}
+		p.metrics.IncRecordingJob(recordingJobStatusCompleted)
+	} else if action == "pause" || action == "resume" {
+		p.publishWebSocketEvent(wsEventCallRecordingState, map[string]interface{}{
+			"callID":   callID,
+			"recState": recState.getClientState().toMap(),
+		}, &model.WebsocketBroadcast{ChannelId: callID, ReliableClusterSend: true})
+
+		p.setCallHistoryRecording(callID, callStateID, &recState)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,120 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-calls/server/enterprise"
+
+	pluginapi "github.com/mattermost/mattermost-plugin-api"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingPauseResume(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	p.configuration.EnableRecordings = model.NewBool(true)
+	p.jobService = &jobService{}
+	p.botSession = &model.Session{UserId: "botID"}
+	p.licenseChecker = enterprise.NewLicenseChecker(pluginapi.NewClient(p.API, nil))
+
+	cfg := &model.Config{}
+	cfg.SetDefaults()
+	*cfg.ServiceSettings.EnableDeveloper = true
+	*cfg.ServiceSettings.EnableTesting = true
+	api.On("GetConfig").Return(cfg).Maybe()
+	api.On("GetLicense").Return(nil).Maybe()
+
+	channelID := model.NewId()
+	require.NoError(t, p.kvSetAtomicChannelState(channelID, func(_ *channelState) (*channelState, error) {
+		return &channelState{
+			Call: &callState{
+				ID:     "callID",
+				HostID: "hostID",
+				Users: map[string]*userState{
+					"hostID": {},
+					"botID":  {},
+				},
+				Recording: &recordingState{
+					ID:        "recID",
+					CreatorID: "hostID",
+					JobID:     "jobID",
+					BotConnID: "botConnID",
+					RecordingStateClient: RecordingStateClient{
+						InitAt:  100,
+						StartAt: 200,
+					},
+				},
+			},
+		}, nil
+	}))
+
+	recordingAction := func(userID, action string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/calls/"+channelID+"/recording/"+action, nil)
+		r.Header.Set("Mattermost-User-Id", userID)
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	// The recorder bot gets the state changes so that it can skip the
+	// paused media.
+	var botStates []map[string]interface{}
+	api.On("PublishWebSocketEvent", wsEventCallRecordingState, mock.Anything, &model.WebsocketBroadcast{UserId: "botID"}).Run(func(args mock.Arguments) {
+		botStates = append(botStates, args.Get(1).(map[string]interface{})["recState"].(map[string]interface{}))
+	})
+	api.On("PublishWebSocketEvent", wsEventCallRecordingState, mock.Anything, mock.MatchedBy(func(b *model.WebsocketBroadcast) bool {
+		return b.ChannelId == channelID
+	}))
+	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), channelID, model.PermissionReadChannel).Return(true)
+
+	t.Run("not host", func(t *testing.T) {
+		require.Equal(t, http.StatusForbidden, recordingAction("userID", "pause").Code)
+	})
+
+	t.Run("resume not paused", func(t *testing.T) {
+		require.Equal(t, http.StatusForbidden, recordingAction("hostID", "resume").Code)
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		w := recordingAction("hostID", "pause")
+		require.Equal(t, http.StatusOK, w.Code)
+		var recState RecordingStateClient
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&recState))
+		require.NotZero(t, recState.PauseAt)
+		pauseAt := recState.PauseAt
+
+		require.Equal(t, http.StatusForbidden, recordingAction("hostID", "pause").Code)
+
+		w = recordingAction("hostID", "resume")
+		require.Equal(t, http.StatusOK, w.Code)
+		recState = RecordingStateClient{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&recState))
+		require.Zero(t, recState.PauseAt)
+		require.Len(t, recState.Pauses, 1)
+		require.Equal(t, pauseAt, recState.Pauses[0].StartAt)
+
+		require.Len(t, botStates, 2)
+		require.Equal(t, pauseAt, botStates[0]["pause_at"])
+		require.Zero(t, botStates[1]["pause_at"])
+	})
+
+	t.Run("recorder sync", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/bot/calls/"+channelID+"/recording", nil)
+		r.Header.Set("Mattermost-User-Id", "botID")
+		p.ServeHTTP(nil, w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var recState RecordingStateClient
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&recState))
+		require.Equal(t, int64(200), recState.StartAt)
+		require.Len(t, recState.Pauses, 1)
+	})
+}
@@ -0,0 +1,523 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var (
+	errRecordingNotFound   = errors.New("recording not found")
+	errRecordingNotExpired = errors.New("recording not expired")
+)
+
+const (
+	unpublishedRecordingKeyPrefix    = "recordings_unpublished_"
+	unpublishedRecordingsIndexKey    = "recordings_unpublished_idx"
+	recordingsRetentionJobKey        = "recordings_retention_job"
+	recordingsRetentionCheckInterval = time.Hour
+	recordingsHistoryLookupMaxCalls  = 10
+)
+
+// unpublishedRecordingFile is a file of a recording, attached to the direct
+// message sharing it with its creator.
+type unpublishedRecordingFile struct {
+	FileID   string `json:"file_id"`
+	DMPostID string `json:"dm_post_id"`
+	CreateAt int64  `json:"create_at"`
+}
+
+// unpublishedRecording is a recording that has been shared privately with its
+// creator and not yet posted to the call thread. A recording restarted after
+// a failure has multiple files which get published together.
+type unpublishedRecording struct {
+	// ID is the recording id or, if unknown, the id of its only file.
+	ID          string                     `json:"id"`
+	RecordingID string                     `json:"recording_id"`
+	ChannelID   string                     `json:"channel_id"`
+	PostID      string                     `json:"post_id"`
+	CreatorID   string                     `json:"creator_id"`
+	Files       []unpublishedRecordingFile `json:"files"`
+}
+
+// expired returns whether the latest file of the recording is older than the
+// retention period.
+func (r *unpublishedRecording) expired(now time.Time, retentionDays int) bool {
+	if retentionDays <= 0 || len(r.Files) == 0 {
+		return false
+	}
+	return now.Sub(time.UnixMilli(r.Files[len(r.Files)-1].CreateAt)) > time.Duration(retentionDays)*24*time.Hour
+}
+
+func (r *unpublishedRecording) fileIDs() []string {
+	fileIDs := make([]string, 0, len(r.Files))
+	for _, file := range r.Files {
+		fileIDs = append(fileIDs, file.FileID)
+	}
+	return fileIDs
+}
+
+func (p *Plugin) kvGetUnpublishedRecording(id string) (*unpublishedRecording, []byte, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(unpublishedRecordingKeyPrefix + id)
+	if appErr != nil {
+		return nil, nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	if data == nil {
+		return nil, nil, nil
+	}
+	var rec *unpublishedRecording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, nil, err
+	}
+	return rec, data, nil
+}
+
+// kvSetAtomicUnpublishedRecording updates the recording with the given id.
+// The callback gets a nil recording if none is stored yet and returning a
+// nil one skips the update.
+func (p *Plugin) kvSetAtomicUnpublishedRecording(id string, cb func(rec *unpublishedRecording) (*unpublishedRecording, error)) error {
+	return p.kvSetAtomic(unpublishedRecordingKeyPrefix+id, func(data []byte) ([]byte, error) {
+		var rec *unpublishedRecording
+		if data != nil {
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return nil, err
+			}
+		}
+		rec, err := cb(rec)
+		if err != nil || rec == nil {
+			return nil, err
+		}
+		return json.Marshal(rec)
+	})
+}
+
+// kvRemoveUnpublishedRecording atomically removes the recording with the given
+// id if the callback allows it, returning the removed recording.
+func (p *Plugin) kvRemoveUnpublishedRecording(id string, cb func(rec *unpublishedRecording) error) (*unpublishedRecording, error) {
+	for {
+		rec, data, err := p.kvGetUnpublishedRecording(id)
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil {
+			return nil, errRecordingNotFound
+		}
+		if err := cb(rec); err != nil {
+			return nil, err
+		}
+
+		p.metrics.IncStoreOp("KVCompareAndDelete")
+		ok, appErr := p.API.KVCompareAndDelete(unpublishedRecordingKeyPrefix+id, data)
+		if appErr != nil {
+			return nil, fmt.Errorf("KVCompareAndDelete failed: %w", appErr)
+		}
+		if !ok {
+			// pausing a little to avoid excessive lock contention
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+
+		// A stale index entry is dropped by the retention job so this is not
+		// a failure.
+		if err := p.removeUnpublishedRecordingIndexEntry(id); err != nil {
+			p.LogError("failed to remove unpublished recording from index", "error", err.Error(), "id", id)
+		}
+
+		return rec, nil
+	}
+}
+
+// restoreUnpublishedRecording puts back a recording that was removed to be
+// published, merging it with any file shared in the meantime.
+func (p *Plugin) restoreUnpublishedRecording(rec *unpublishedRecording) error {
+	if err := p.kvSetAtomicUnpublishedRecording(rec.ID, func(curr *unpublishedRecording) (*unpublishedRecording, error) {
+		if curr == nil {
+			return rec, nil
+		}
+		curr.Files = append(append([]unpublishedRecordingFile{}, rec.Files...), curr.Files...)
+		return curr, nil
+	}); err != nil {
+		return err
+	}
+
+	return p.addUnpublishedRecordingIndexEntry(rec.ID)
+}
+
+func (p *Plugin) kvGetUnpublishedRecordingIDs() ([]string, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(unpublishedRecordingsIndexKey)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (p *Plugin) addUnpublishedRecordingIndexEntry(id string) error {
+	return p.kvSetAtomic(unpublishedRecordingsIndexKey, func(data []byte) ([]byte, error) {
+		var ids []string
+		if data != nil {
+			if err := json.Unmarshal(data, &ids); err != nil {
+				return nil, err
+			}
+		}
+		for _, e := range ids {
+			if e == id {
+				return nil, nil
+			}
+		}
+		return json.Marshal(append(ids, id))
+	})
+}
+
+func (p *Plugin) removeUnpublishedRecordingIndexEntry(id string) error {
+	return p.kvSetAtomic(unpublishedRecordingsIndexKey, func(data []byte) ([]byte, error) {
+		if data == nil {
+			return nil, nil
+		}
+		var ids []string
+		if err := json.Unmarshal(data, &ids); err != nil {
+			return nil, err
+		}
+		for i, e := range ids {
+			if e == id {
+				return json.Marshal(append(ids[:i], ids[i+1:]...))
+			}
+		}
+		return nil, nil
+	})
+}
+
+// getRecordingCreator looks up the call history to find who started the
+// latest recording of the call attached to the given post. The call and
+// recording ids are returned along with the creator's.
+func (p *Plugin) getRecordingCreator(channelID, postID string) (string, string, string, error) {
+	callIDs, err := p.getCallHistoryIDs(channelID, 0, 0, 0, recordingsHistoryLookupMaxCalls)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	for _, callID := range callIDs {
+		history, err := p.kvGetCallHistory(callID)
+		if err != nil {
+			return "", "", "", err
+		}
+		if history == nil || history.PostID != postID {
+			continue
+		}
+
+		var latest *callHistoryRecording
+		for i := range history.Recordings {
+			if latest == nil || history.Recordings[i].InitAt > latest.InitAt {
+				latest = &history.Recordings[i]
+			}
+		}
+		if latest == nil {
+			return history.ID, "", history.OwnerID, nil
+		}
+		return history.ID, latest.ID, latest.CreatorID, nil
+	}
+
+	return "", "", "", fmt.Errorf("call not found for post %q", postID)
+}
+
+// shareRecordingWithCreator sends the recording file privately to its creator
+// and keeps track of it until it gets published or purged.
+func (p *Plugin) shareRecordingWithCreator(channelID string, post *model.Post, fileID string) error {
+	callID, recordingID, creatorID, err := p.getRecordingCreator(channelID, post.Id)
+	if err != nil {
+		// The call history may be missing, in which case the recording goes
+		// to whoever started the call.
+		p.LogWarn("failed to get recording creator, falling back to call owner", "error", err.Error(), "postID", post.Id)
+		creatorID = post.UserId
+	}
+
+	if recordingID != "" {
+		p.addCallHistoryRecordingFile(channelID, callID, recordingID, fileID)
+	}
+
+	id := recordingID
+	if id == "" {
+		id = fileID
+	}
+
+	dm, appErr := p.API.GetDirectChannel(p.getBotID(), creatorID)
+	if appErr != nil {
+		return fmt.Errorf("failed to get direct channel: %w", appErr)
+	}
+
+	postMsg := "Your call recording is ready"
+	if title, _ := post.GetProp("title").(string); title != "" {
+		postMsg = fmt.Sprintf("Your recording of %s is ready", title)
+	}
+	postMsg += ". It's only visible to you until you publish it to the channel."
+
+	// The uploaded file itself is attached to the direct message so that
+	// deleting the post on purge removes it. Publishing attaches copies of it.
+	dmPost, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.getBotID(),
+		ChannelId: dm.Id,
+		Message:   postMsg,
+		Type:      "custom_calls_recording",
+		FileIds:   []string{fileID},
+		Props: model.StringInterface{
+			"call_channel_id": channelID,
+			"call_post_id":    post.Id,
+			"recording_id":    id,
+			"file_id":         fileID,
+		},
+	})
+	if appErr != nil {
+		return fmt.Errorf("failed to create post: %w", appErr)
+	}
+
+	if err := p.kvSetAtomicUnpublishedRecording(id, func(rec *unpublishedRecording) (*unpublishedRecording, error) {
+		if rec == nil {
+			rec = &unpublishedRecording{
+				ID:          id,
+				RecordingID: recordingID,
+				ChannelID:   channelID,
+				PostID:      post.Id,
+				CreatorID:   creatorID,
+			}
+		}
+		rec.Files = append(rec.Files, unpublishedRecordingFile{
+			FileID:   fileID,
+			DMPostID: dmPost.Id,
+			CreateAt: time.Now().UnixMilli(),
+		})
+		return rec, nil
+	}); err != nil {
+		return err
+	}
+
+	if err := p.addUnpublishedRecordingIndexEntry(id); err != nil {
+		return fmt.Errorf("failed to index unpublished recording: %w", err)
+	}
+
+	p.publishCallEvent(webhookEventRecordingReady, channelID, callID, creatorID, map[string]interface{}{
+		"recording_id": recordingID,
+		"file_id":      fileID,
+		"post_id":      post.Id,
+	})
+
+	return nil
+}
+
+// postRecordingFiles links copies of the recording files to the call post and
+// shares them in its thread. The ids of the copies are returned.
+func (p *Plugin) postRecordingFiles(channelID, postID string, fileIDs []string) ([]string, error) {
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return nil, fmt.Errorf("failed to get call post: %w", appErr)
+	}
+
+	threadID := post.Id
+
+	// Post in thread
+	if post.RootId != "" {
+		threadID = post.RootId
+	}
+
+	// The recording files are attached to the direct messages they were
+	// shared in so the thread gets copies of them.
+	fileIDs, appErr = p.API.CopyFileInfos(p.getBotID(), fileIDs)
+	if appErr != nil {
+		return nil, fmt.Errorf("failed to copy file infos: %w", appErr)
+	}
+
+	recordings, _ := post.GetProp("recording_files").([]interface{})
+	for _, fileID := range fileIDs {
+		recordings = append(recordings, fileID)
+	}
+	post.AddProp("recording_files", recordings)
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		return nil, fmt.Errorf("failed to update call thread: %w", appErr)
+	}
+
+	// Props are JSON decoded so numbers are float64.
+	startAt, _ := post.GetProp("start_at").(float64)
+	postMsg := "Here's the call recording"
+	if title, _ := post.GetProp("title").(string); title != "" {
+		postMsg = fmt.Sprintf("%s of %s at %s UTC", postMsg, title, time.UnixMilli(int64(startAt)).UTC().Format("3:04PM"))
+	}
+
+	if _, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.getBotID(),
+		ChannelId: channelID,
+		Message:   postMsg,
+		Type:      "custom_calls_recording",
+		RootId:    threadID,
+		FileIds:   fileIDs,
+	}); appErr != nil {
+		return nil, fmt.Errorf("failed to create post: %w", appErr)
+	}
+
+	return fileIDs, nil
+}
+
+// publishRecording posts a privately shared recording to the call thread.
+// Only the recording creator or a system admin can publish it.
+func (p *Plugin) publishRecording(userID, channelID, id string) error {
+	// Removing the recording first ensures it's only published once. It's put
+	// back if posting fails so that publishing can be attempted again.
+	rec, err := p.kvRemoveUnpublishedRecording(id, func(rec *unpublishedRecording) error {
+		if rec.ChannelID != channelID {
+			return errRecordingNotFound
+		}
+		if rec.CreatorID != userID && !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+			return errForbidden
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fileIDs, err := p.postRecordingFiles(rec.ChannelID, rec.PostID, rec.fileIDs())
+	if err != nil {
+		if err := p.restoreUnpublishedRecording(rec); err != nil {
+			p.LogError("failed to restore unpublished recording", "error", err.Error(), "id", rec.ID)
+		}
+		return err
+	}
+
+	// Transcriptions are shared in the call thread so they only get
+	// generated once the recording is published.
+	if cfg := p.getConfiguration(); cfg.transcriptionsEnabled() {
+		for _, fileID := range fileIDs {
+			if err := p.startTranscription(rec.ChannelID, rec.PostID, fileID); err != nil {
+				p.LogError("failed to start transcription", "err", err.Error())
+			}
+		}
+	}
+
+	if rec.RecordingID != "" {
+		p.publishWebSocketEvent(wsEventCallRecordingPublished, map[string]interface{}{
+			"callID":      channelID,
+			"recordingID": rec.RecordingID,
+			"fileIDs":     fileIDs,
+		}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+	}
+
+	return nil
+}
+
+func (p *Plugin) handlePublishRecording(w http.ResponseWriter, r *http.Request, channelID string, res *httpResponse) {
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var data struct {
+		RecordingID string `json:"recording_id"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&data); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if data.RecordingID == "" {
+		res.Err = "missing recording_id from request body"
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	if err := p.publishRecording(userID, channelID, data.RecordingID); err != nil {
+		res.Err = err.Error()
+		if errors.Is(err, errForbidden) {
+			res.Code = http.StatusForbidden
+		} else if errors.Is(err, errRecordingNotFound) {
+			res.Code = http.StatusNotFound
+		} else {
+			res.Code = http.StatusInternalServerError
+		}
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
+
+// deleteRecordingFiles removes the given recording files, both the file infos
+// and the stored content.
+func (p *Plugin) deleteRecordingFiles(rec *unpublishedRecording) {
+	backend, err := p.getFileBackend()
+	if err != nil {
+		p.LogError("failed to create file backend", "error", err.Error())
+	}
+
+	for _, file := range rec.Files {
+		info, appErr := p.API.GetFileInfo(file.FileID)
+		if appErr != nil {
+			p.LogError("failed to get file info", "error", appErr.Error(), "fileID", file.FileID)
+		} else if backend != nil {
+			for _, path := range []string{info.Path, info.ThumbnailPath, info.PreviewPath} {
+				if path == "" {
+					continue
+				}
+				if err := backend.RemoveFile(path); err != nil {
+					p.LogError("failed to remove recording file", "error", err.Error(), "fileID", file.FileID)
+				}
+			}
+		}
+
+		// The file is attached to the post so deleting it deletes the file
+		// info as well.
+		if appErr := p.API.DeletePost(file.DMPostID); appErr != nil {
+			p.LogError("failed to delete recording post", "error", appErr.Error(), "postID", file.DMPostID)
+		}
+	}
+}
+
+// purgeExpiredRecordings deletes the unpublished recordings that are older
+// than the configured retention period.
+func (p *Plugin) purgeExpiredRecordings() {
+	cfg := p.getConfiguration()
+	if cfg.RecordingRetentionDays == nil || *cfg.RecordingRetentionDays <= 0 {
+		return
+	}
+
+	ids, err := p.kvGetUnpublishedRecordingIDs()
+	if err != nil {
+		p.LogError("failed to get unpublished recordings", "error", err.Error())
+		return
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		rec, err := p.kvRemoveUnpublishedRecording(id, func(rec *unpublishedRecording) error {
+			if !rec.expired(now, *cfg.RecordingRetentionDays) {
+				return errRecordingNotExpired
+			}
+			return nil
+		})
+		if errors.Is(err, errRecordingNotFound) {
+			// The recording got removed without its index entry.
+			if err := p.removeUnpublishedRecordingIndexEntry(id); err != nil {
+				p.LogError("failed to remove unpublished recording from index", "error", err.Error(), "id", id)
+			}
+			continue
+		} else if errors.Is(err, errRecordingNotExpired) {
+			continue
+		} else if err != nil {
+			p.LogError("failed to remove unpublished recording", "error", err.Error(), "id", id)
+			continue
+		}
+
+		p.LogDebug("purging unpublished recording", "id", id, "channelID", rec.ChannelID)
+		p.deleteRecordingFiles(rec)
+	}
+}
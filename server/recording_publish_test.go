@@ -0,0 +1,210 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnpublishedRecordingExpired(t *testing.T) {
+	now := time.Now()
+	rec := unpublishedRecording{
+		Files: []unpublishedRecordingFile{
+			{FileID: "fileA", CreateAt: now.Add(-72 * time.Hour).UnixMilli()},
+			{FileID: "fileB", CreateAt: now.Add(-48 * time.Hour).UnixMilli()},
+		},
+	}
+
+	require.False(t, rec.expired(now, 0))
+	require.False(t, rec.expired(now, 3))
+	require.True(t, rec.expired(now, 1))
+	require.Equal(t, []string{"fileA", "fileB"}, rec.fileIDs())
+
+	require.False(t, (&unpublishedRecording{}).expired(now, 1))
+}
+
+func TestShareRecordingWithCreator(t *testing.T) {
+	post := &model.Post{
+		Id:     "postID",
+		UserId: "ownerID",
+		Props:  model.StringInterface{"title": "Standup"},
+	}
+
+	t.Run("multiple parts", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t)
+
+		call := &callState{ID: "callID", StartAt: time.Now().UnixMilli(), OwnerID: "ownerID"}
+		require.NoError(t, p.initCallHistory("channelID", call, "postID", "postID"))
+		p.setCallHistoryRecording("channelID", "callID", &recordingState{
+			ID:                   "recID",
+			CreatorID:            "creatorID",
+			RecordingStateClient: RecordingStateClient{InitAt: call.StartAt},
+		})
+
+		api.On("GetDirectChannel", "", "creatorID").Return(&model.Channel{Id: "dmID"}, nil).Twice()
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == "dmID" && post.GetProp("recording_id") == "recID" &&
+				post.Message == "Your recording of Standup is ready. It's only visible to you until you publish it to the channel."
+		})).Return(&model.Post{Id: "dmPostID"}, nil).Twice()
+
+		require.NoError(t, p.shareRecordingWithCreator("channelID", post, "fileA"))
+		require.NoError(t, p.shareRecordingWithCreator("channelID", post, "fileB"))
+
+		rec, _, err := p.kvGetUnpublishedRecording("recID")
+		require.NoError(t, err)
+		require.NotNil(t, rec)
+		require.Equal(t, "creatorID", rec.CreatorID)
+		require.Equal(t, "recID", rec.RecordingID)
+		require.Equal(t, []string{"fileA", "fileB"}, rec.fileIDs())
+
+		history, err := p.kvGetCallHistory("callID")
+		require.NoError(t, err)
+		require.Equal(t, []string{"fileA", "fileB"}, history.Recordings[0].FileIDs)
+	})
+
+	t.Run("missing call history", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t)
+
+		api.On("GetDirectChannel", "", "ownerID").Return(&model.Channel{Id: "dmID"}, nil).Once()
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == "dmID" && post.GetProp("recording_id") == "fileA"
+		})).Return(&model.Post{Id: "dmPostID"}, nil).Once()
+
+		require.NoError(t, p.shareRecordingWithCreator("channelID", post, "fileA"))
+
+		rec, _, err := p.kvGetUnpublishedRecording("fileA")
+		require.NoError(t, err)
+		require.NotNil(t, rec)
+		require.Equal(t, "ownerID", rec.CreatorID)
+		require.Empty(t, rec.RecordingID)
+	})
+}
+
+func TestPublishRecording(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	require.NoError(t, p.kvSetAtomicUnpublishedRecording("recID", func(_ *unpublishedRecording) (*unpublishedRecording, error) {
+		return &unpublishedRecording{
+			ID:          "recID",
+			RecordingID: "recID",
+			ChannelID:   "channelID",
+			PostID:      "postID",
+			CreatorID:   "creatorID",
+			Files: []unpublishedRecordingFile{
+				{FileID: "fileA", DMPostID: "dmPostA"},
+				{FileID: "fileB", DMPostID: "dmPostB"},
+			},
+		}, nil
+	}))
+
+	require.ErrorIs(t, p.publishRecording("creatorID", "otherChannelID", "recID"), errRecordingNotFound)
+
+	api.On("HasPermissionTo", "userID", model.PermissionManageSystem).Return(false).Once()
+	require.ErrorIs(t, p.publishRecording("userID", "channelID", "recID"), errForbidden)
+
+	t.Run("posting failure", func(t *testing.T) {
+		api.On("GetPost", "postID").Return(nil, model.NewAppError("GetPost", "error", nil, "", 500)).Once()
+		require.Error(t, p.publishRecording("creatorID", "channelID", "recID"))
+
+		// The recording is kept so that it can be published again.
+		rec, _, err := p.kvGetUnpublishedRecording("recID")
+		require.NoError(t, err)
+		require.NotNil(t, rec)
+		require.Len(t, rec.Files, 2)
+		ids, err := p.kvGetUnpublishedRecordingIDs()
+		require.NoError(t, err)
+		require.Equal(t, []string{"recID"}, ids)
+	})
+
+	post := &model.Post{Id: "postID"}
+	post.AddProp("title", "Standup")
+	// Props decode as float64 once stored.
+	post.AddProp("start_at", float64(time.Date(2023, 1, 10, 15, 30, 0, 0, time.UTC).UnixMilli()))
+	api.On("GetPost", "postID").Return(post, nil).Once()
+	api.On("CopyFileInfos", "", []string{"fileA", "fileB"}).Return([]string{"copyA", "copyB"}, nil).Once()
+	api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil).Once()
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.RootId == "postID" && len(post.FileIds) == 2 && post.FileIds[0] == "copyA" &&
+			post.Message == "Here's the call recording of Standup at 3:30PM UTC"
+	})).Return(&model.Post{}, nil).Once()
+	api.On("PublishWebSocketEvent", wsEventCallRecordingPublished, mock.Anything, mock.Anything).Once()
+
+	require.NoError(t, p.publishRecording("creatorID", "channelID", "recID"))
+
+	rec, _, err := p.kvGetUnpublishedRecording("recID")
+	require.NoError(t, err)
+	require.Nil(t, rec)
+	ids, err := p.kvGetUnpublishedRecordingIDs()
+	require.NoError(t, err)
+	require.Empty(t, ids)
+
+	require.ErrorIs(t, p.publishRecording("creatorID", "channelID", "recID"), errRecordingNotFound)
+}
+
+func TestPurgeExpiredRecordings(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	p.configuration.RecordingRetentionDays = model.NewInt(1)
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "calls"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "calls", "old.mp4"), []byte("media"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "calls", "new.mp4"), []byte("media"), 0600))
+
+	cfg := &model.Config{}
+	cfg.SetDefaults()
+	cfg.FileSettings.DriverName = model.NewString(model.ImageDriverLocal)
+	cfg.FileSettings.Directory = model.NewString(dir)
+
+	now := time.Now()
+	for id, createAt := range map[string]time.Time{
+		"old": now.Add(-48 * time.Hour),
+		"new": now.Add(-time.Hour),
+	} {
+		rec := &unpublishedRecording{
+			ID:        id,
+			ChannelID: "channelID",
+			Files: []unpublishedRecordingFile{
+				{FileID: id + "FileID", DMPostID: id + "PostID", CreateAt: createAt.UnixMilli()},
+			},
+		}
+		require.NoError(t, p.kvSetAtomicUnpublishedRecording(id, func(_ *unpublishedRecording) (*unpublishedRecording, error) {
+			return rec, nil
+		}))
+		require.NoError(t, p.addUnpublishedRecordingIndexEntry(id))
+	}
+	// An entry left behind by a recording that is gone.
+	require.NoError(t, p.addUnpublishedRecordingIndexEntry("stale"))
+
+	api.On("GetUnsanitizedConfig").Return(cfg)
+	api.On("GetLicense").Return(nil)
+	api.On("GetFileInfo", "oldFileID").Return(&model.FileInfo{Id: "oldFileID", Path: "calls/old.mp4"}, nil).Once()
+	api.On("DeletePost", "oldPostID").Return(nil).Once()
+
+	p.purgeExpiredRecordings()
+
+	// The expired recording is gone along with its stored file.
+	rec, _, err := p.kvGetUnpublishedRecording("old")
+	require.NoError(t, err)
+	require.Nil(t, rec)
+	_, err = os.Stat(filepath.Join(dir, "calls", "old.mp4"))
+	require.True(t, os.IsNotExist(err))
+
+	rec, _, err = p.kvGetUnpublishedRecording("new")
+	require.NoError(t, err)
+	require.NotNil(t, rec)
+	_, err = os.Stat(filepath.Join(dir, "calls", "new.mp4"))
+	require.NoError(t, err)
+
+	ids, err := p.kvGetUnpublishedRecordingIDs()
+	require.NoError(t, err)
+	require.Equal(t, []string{"new"}, ids)
+	api.AssertNotCalled(t, "KVList", mock.Anything, mock.Anything)
+}
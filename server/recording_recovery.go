@@ -0,0 +1,182 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	recordingJobMonitorInterval = 10 * time.Second
+	recordingJobMaxRetries      = 3
+	// The minimum recording time left for a failed job to be worth restarting.
+	recordingJobMinRemainingTime = time.Minute
+)
+
+// recordingShouldRestart returns whether a recording which bot has left the
+// call should have its job restarted. This is not the case if the maximum
+// recording duration was reached or if too many attempts were made already.
+func recordingShouldRestart(rec *recordingState, now time.Time, maxDuration time.Duration) bool {
+	if rec == nil || rec.StartAt == 0 || rec.Err != "" {
+		return false
+	}
+
+	if rec.Retries >= recordingJobMaxRetries {
+		return false
+	}
+
+	return now.Sub(time.UnixMilli(rec.StartAt)) < maxDuration-recordingJobMinRemainingTime
+}
+
+// recJobMonitor checks the status of the recording job for as long as the
+// recording is in progress. If the job stops unexpectedly while the recorder
+// is still in the call, its sessions are closed so that the recording can be
+// recovered.
+func (p *Plugin) recJobMonitor(callID, recID, jobID string) {
+	ticker := time.NewTicker(recordingJobMonitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.stopCh:
+			return
+		}
+
+		state, err := p.kvGetChannelState(callID)
+		if err != nil {
+			p.LogError("failed to get channel state", "error", err.Error())
+			continue
+		}
+
+		recState, err := state.getRecording()
+		if err != nil || recState.ID != recID || recState.JobID != jobID || recState.EndAt > 0 {
+			// Recording was stopped or the job has been replaced.
+			return
+		}
+
+		job, err := p.jobService.GetJob(jobID)
+		if err != nil {
+			p.LogError("failed to get recording job", "error", err.Error(), "jobID", jobID)
+			continue
+		}
+
+		if job.StopAt == 0 {
+			continue
+		}
+
+		p.LogWarn("recording job stopped unexpectedly", "callID", callID, "jobID", jobID)
+
+		if recState.BotConnID != "" {
+			p.closeUserSessions(callID, recState.BotConnID)
+			if err := p.sendClusterMessage(clusterMessage{
+				ConnID:    recState.BotConnID,
+				UserID:    p.getBotID(),
+				ChannelID: callID,
+				SenderID:  p.nodeID,
+			}, clusterMessageTypeHostRemove, ""); err != nil {
+				p.LogError(err.Error())
+			}
+		}
+
+		return
+	}
+}
+
+// restartRecordingJob runs a new recording job for a recording which job
+// has failed. The new job uploads a separate file, resulting in a multi-part
+// recording.
+func (p *Plugin) restartRecordingJob(callID, recID, failedJobID string) {
+	var recState recordingState
+	var postID string
+	var callStateID string
+	if err := p.kvSetAtomicChannelState(callID, func(state *channelState) (*channelState, error) {
+		rec, err := state.getRecording()
+		if err != nil {
+			return nil, err
+		}
+		if rec.ID != recID || rec.JobID != failedJobID {
+			return nil, fmt.Errorf("recording job has changed")
+		}
+
+		// Keeping the recording paused if it was when the job failed.
+		if n := len(rec.Pauses); n > 0 && rec.Pauses[n-1].EndAt == rec.EndAt {
+			rec.PauseAt = rec.Pauses[n-1].StartAt
+			rec.Pauses = rec.Pauses[:n-1]
+		}
+
+		rec.Retries++
+		rec.EndAt = 0
+		rec.BotConnID = ""
+		rec.JobID = ""
+
+		recState = *rec
+		postID = state.Call.PostID
+		callStateID = state.Call.ID
+
+		return state, nil
+	}); err != nil {
+		p.LogError("failed to set channel state", "error", err.Error())
+		return
+	}
+
+	p.LogDebug("restarting recording job", "callID", callID, "failedJobID", failedJobID, "retries", recState.Retries)
+
+	// Making sure the failed job is gone before starting a new one.
+	if err := p.jobService.StopJob(failedJobID); err != nil {
+		p.LogError("failed to stop recording job", "error", err.Error(), "jobID", failedJobID)
+	}
+
+	recJobID, err := p.jobService.RunRecordingJob(callID, postID, p.botSession.Token)
+	if err == nil {
+		err = p.kvSetAtomicChannelState(callID, func(state *channelState) (*channelState, error) {
+			rec, err := state.getRecording()
+			if err != nil {
+				return nil, err
+			}
+			if rec.ID != recID || rec.JobID != "" {
+				return nil, fmt.Errorf("recording job has changed")
+			}
+			rec.JobID = recJobID
+			return state, nil
+		})
+	}
+
+	if err != nil {
+		p.LogError("failed to restart recording job", "error", err.Error(), "callID", callID)
+
+		if err := p.kvSetAtomicChannelState(callID, func(state *channelState) (*channelState, error) {
+			rec, err := state.getRecording()
+			if err != nil {
+				return nil, err
+			}
+			if rec.ID != recID {
+				return nil, fmt.Errorf("recording has changed")
+			}
+			state.Call.Recording = nil
+			return state, nil
+		}); err != nil {
+			p.LogError("failed to set channel state", "error", err.Error())
+		}
+
+		recState.EndAt = time.Now().UnixMilli()
+		recState.Err = "failed to restart recording job: " + err.Error()
+		p.metrics.IncRecordingJob(recordingJobStatusFailed)
+	} else {
+		recState.JobID = recJobID
+		p.metrics.IncRecordingJob(recordingJobStatusRestarted)
+		go p.recJobTimeoutChecker(callID, recJobID)
+		go p.recJobMonitor(callID, recID, recJobID)
+	}
+
+	p.setCallHistoryRecording(callID, callStateID, &recState)
+
+	p.publishWebSocketEvent(wsEventCallRecordingState, map[string]interface{}{
+		"callID":   callID,
+		"recState": recState.getClientState().toMap(),
+	}, &model.WebsocketBroadcast{ChannelId: callID, ReliableClusterSend: true})
+}
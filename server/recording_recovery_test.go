@@ -0,0 +1,64 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingShouldRestart(t *testing.T) {
+	now := time.Now()
+	maxDuration := time.Hour
+
+	t.Run("nil", func(t *testing.T) {
+		require.False(t, recordingShouldRestart(nil, now, maxDuration))
+	})
+
+	t.Run("not started", func(t *testing.T) {
+		rec := &recordingState{}
+		require.False(t, recordingShouldRestart(rec, now, maxDuration))
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		rec := &recordingState{
+			RecordingStateClient: RecordingStateClient{
+				StartAt: now.Add(-time.Minute).UnixMilli(),
+				Err:     "failure",
+			},
+		}
+		require.False(t, recordingShouldRestart(rec, now, maxDuration))
+	})
+
+	t.Run("restartable", func(t *testing.T) {
+		rec := &recordingState{
+			Retries: recordingJobMaxRetries - 1,
+			RecordingStateClient: RecordingStateClient{
+				StartAt: now.Add(-10 * time.Minute).UnixMilli(),
+			},
+		}
+		require.True(t, recordingShouldRestart(rec, now, maxDuration))
+	})
+
+	t.Run("too many retries", func(t *testing.T) {
+		rec := &recordingState{
+			Retries: recordingJobMaxRetries,
+			RecordingStateClient: RecordingStateClient{
+				StartAt: now.Add(-10 * time.Minute).UnixMilli(),
+			},
+		}
+		require.False(t, recordingShouldRestart(rec, now, maxDuration))
+	})
+
+	t.Run("max duration reached", func(t *testing.T) {
+		rec := &recordingState{
+			RecordingStateClient: RecordingStateClient{
+				StartAt: now.Add(-maxDuration).UnixMilli(),
+			},
+		}
+		require.False(t, recordingShouldRestart(rec, now, maxDuration))
+	})
+}
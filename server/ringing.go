@@ -0,0 +1,231 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var callRingingActionRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)\/ringing\/(accept|decline)$`)
+
+// ringingTimeout is how long members are rung for before the call is
+// considered missed.
+const ringingTimeout = 30 * time.Second
+
+const (
+	ringingActionAccept  = "accept"
+	ringingActionDecline = "decline"
+)
+
+type ringingState struct {
+	RingAt int64 `json:"ring_at"`
+}
+
+// shouldRing returns whether starting a call in the channel rings its
+// other members.
+func shouldRing(channel *model.Channel) bool {
+	return channel.Type == model.ChannelTypeDirect || channel.Type == model.ChannelTypeGroup
+}
+
+// getRingingUserIDs returns the sorted IDs of the users still being rung.
+func (cs *callState) getRingingUserIDs() []string {
+	userIDs := make([]string, 0, len(cs.Ringing))
+	for userID := range cs.Ringing {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs
+}
+
+func newMissedCallPost(botID, callerID, channelID, callID string, userIDs []string) *model.Post {
+	return &model.Post{
+		UserId:    botID,
+		ChannelId: channelID,
+		Message:   "Missed call",
+		Type:      "custom_calls_missed",
+		Props: model.StringInterface{
+			"caller_id":       callerID,
+			"call_id":         callID,
+			"missed_user_ids": userIDs,
+		},
+	}
+}
+
+// getChannelUsers returns all the members of the given channel.
+func (p *Plugin) getChannelUsers(channelID string) ([]*model.User, error) {
+	var users []*model.User
+	perPage := 100
+	for page := 0; ; page++ {
+		pageUsers, appErr := p.API.GetUsersInChannel(channelID, model.ChannelSortByUsername, page, perPage)
+		if appErr != nil {
+			return nil, appErr
+		}
+		users = append(users, pageUsers...)
+		if len(pageUsers) < perPage {
+			return users, nil
+		}
+	}
+}
+
+// startRinging rings the other members of the channel the call was started
+// in. The plugin API has no way to send push notifications directly, so
+// mobile clients that aren't connected are only notified through the push
+// notification for the call post, as for any other direct or group message.
+// That notification follows the member's notification preferences.
+func (p *Plugin) startRinging(channel *model.Channel, call *callState, callerID, postID string) {
+	users, err := p.getChannelUsers(channel.Id)
+	if err != nil {
+		p.LogError("failed to get channel members", "err", err.Error(), "channelID", channel.Id)
+		return
+	}
+
+	var ringing []string
+	if err := p.kvSetAtomicChannelState(channel.Id, func(state *channelState) (*channelState, error) {
+		ringing = nil
+
+		if state == nil || state.Call == nil || state.Call.ID != call.ID {
+			return nil, fmt.Errorf("call has ended")
+		}
+
+		if state.Call.Ringing == nil {
+			state.Call.Ringing = make(map[string]*ringingState)
+		}
+
+		for _, user := range users {
+			if user.Id == callerID || user.IsBot {
+				continue
+			}
+			// Members may have joined already.
+			if _, ok := state.Call.Users[user.Id]; ok {
+				continue
+			}
+			state.Call.Ringing[user.Id] = &ringingState{
+				RingAt: time.Now().UnixMilli(),
+			}
+			ringing = append(ringing, user.Id)
+		}
+
+		return state, nil
+	}); err != nil {
+		p.LogError("failed to start ringing", "err", err.Error(), "channelID", channel.Id)
+		return
+	}
+
+	for _, userID := range ringing {
+		p.publishWebSocketEvent(wsEventCallRinging, map[string]interface{}{
+			"channelID": channel.Id,
+			"callID":    call.ID,
+			"callerID":  callerID,
+			"postID":    postID,
+		}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+	}
+
+	if len(ringing) > 0 {
+		go p.stopRingingAfter(channel.Id, call.ID, ringingTimeout)
+	}
+}
+
+// stopRingingAfter stops ringing the members who haven't answered once the
+// timeout expires and lets them know they missed the call.
+func (p *Plugin) stopRingingAfter(channelID, callID string, timeout time.Duration) {
+	select {
+	case <-time.After(timeout):
+	case <-p.stopCh:
+		return
+	}
+
+	var call *callState
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		call = nil
+
+		// If the call has ended in the meantime, missed calls have been
+		// handled already.
+		if state == nil || state.Call == nil || state.Call.ID != callID || len(state.Call.Ringing) == 0 {
+			return nil, nil
+		}
+
+		call = state.Call.Clone()
+		state.Call.Ringing = nil
+
+		return state, nil
+	}); err != nil {
+		p.LogError("failed to stop ringing", "err", err.Error(), "channelID", channelID)
+		return
+	}
+
+	if call != nil {
+		p.missedCall(channelID, call)
+	}
+}
+
+// missedCall stops ringing the members still being rung for the given call
+// and posts a missed call message for them.
+func (p *Plugin) missedCall(channelID string, call *callState) {
+	userIDs := call.getRingingUserIDs()
+	if len(userIDs) == 0 {
+		return
+	}
+
+	for _, userID := range userIDs {
+		p.stopRingingUser(userID, channelID, call.ID)
+	}
+
+	if _, appErr := p.API.CreatePost(newMissedCallPost(p.getBotID(), call.OwnerID, channelID, call.ID, userIDs)); appErr != nil {
+		p.LogError("failed to create missed call post", "err", appErr.Error(), "channelID", channelID)
+	}
+}
+
+// stopRingingUser notifies all the user's clients that they are no longer
+// being rung, e.g. because the call was answered from another device.
+func (p *Plugin) stopRingingUser(userID, channelID, callID string) {
+	p.publishWebSocketEvent(wsEventCallRingingStopped, map[string]interface{}{
+		"channelID": channelID,
+		"callID":    callID,
+	}, &model.WebsocketBroadcast{UserId: userID, ReliableClusterSend: true})
+}
+
+func (p *Plugin) handleRingingAction(w http.ResponseWriter, r *http.Request, channelID, action string) {
+	var res httpResponse
+	defer p.httpAudit("handleRingingAction", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var call *callState
+	if err := p.kvSetAtomicChannelState(channelID, func(state *channelState) (*channelState, error) {
+		if state == nil || state.Call == nil {
+			return nil, fmt.Errorf("no call ongoing")
+		}
+		if _, ok := state.Call.Ringing[userID]; !ok {
+			return nil, fmt.Errorf("user is not being rung")
+		}
+
+		delete(state.Call.Ringing, userID)
+		call = state.Call.Clone()
+
+		return state, nil
+	}); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	p.stopRingingUser(userID, channelID, call.ID)
+
+	if action == ringingActionDecline {
+		p.publishWebSocketEvent(wsEventCallRingingDeclined, map[string]interface{}{
+			"channelID": channelID,
+			"callID":    call.ID,
+			"userID":    userID,
+		}, &model.WebsocketBroadcast{UserId: call.OwnerID, ReliableClusterSend: true})
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
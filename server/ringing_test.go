@@ -0,0 +1,148 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldRing(t *testing.T) {
+	require.True(t, shouldRing(&model.Channel{Type: model.ChannelTypeDirect}))
+	require.True(t, shouldRing(&model.Channel{Type: model.ChannelTypeGroup}))
+	require.False(t, shouldRing(&model.Channel{Type: model.ChannelTypeOpen}))
+	require.False(t, shouldRing(&model.Channel{Type: model.ChannelTypePrivate}))
+}
+
+func TestCallStateGetRingingUserIDs(t *testing.T) {
+	var cs callState
+	require.Empty(t, cs.getRingingUserIDs())
+
+	cs.Ringing = map[string]*ringingState{
+		"userC": {RingAt: 1000},
+		"userA": {RingAt: 1000},
+		"userB": {RingAt: 1000},
+	}
+	require.Equal(t, []string{"userA", "userB", "userC"}, cs.getRingingUserIDs())
+}
+
+func TestNewMissedCallPost(t *testing.T) {
+	post := newMissedCallPost("botID", "callerID", "channelID", "callID", []string{"userA", "userB"})
+	require.Equal(t, "botID", post.UserId)
+	require.Equal(t, "channelID", post.ChannelId)
+	require.Equal(t, "Missed call", post.Message)
+	require.Equal(t, "custom_calls_missed", post.Type)
+	require.Equal(t, "callerID", post.GetProp("caller_id"))
+	require.Equal(t, "callID", post.GetProp("call_id"))
+	require.Equal(t, []string{"userA", "userB"}, post.GetProp("missed_user_ids"))
+}
+
+func TestGetChannelUsers(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	firstPage := make([]*model.User, 100)
+	for i := range firstPage {
+		firstPage[i] = &model.User{Id: model.NewId()}
+	}
+	api.On("GetUsersInChannel", "channelID", model.ChannelSortByUsername, 0, 100).Return(firstPage, nil).Once()
+	api.On("GetUsersInChannel", "channelID", model.ChannelSortByUsername, 1, 100).Return([]*model.User{{Id: "userID"}}, nil).Once()
+
+	users, err := p.getChannelUsers("channelID")
+	require.NoError(t, err)
+	require.Len(t, users, 101)
+	require.Equal(t, "userID", users[100].Id)
+}
+
+func TestStartCallRinging(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	p.configuration.EnableRinging = model.NewBool(true)
+
+	channel := &model.Channel{Id: "channelID", Type: model.ChannelTypeDirect}
+	require.NoError(t, p.kvSetAtomicChannelState(channel.Id, func(_ *channelState) (*channelState, error) {
+		return &channelState{Enabled: model.NewBool(true)}, nil
+	}))
+
+	api.On("GetUser", "callerID").Return(&model.User{Id: "callerID", Username: "caller"}, nil).Once()
+	api.On("GetConfig").Return(&model.Config{}).Once()
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: "postID"}, nil).Once()
+	api.On("PublishWebSocketEvent", wsEventCallStart, mock.Anything, mock.Anything).Once()
+	api.On("GetUsersInChannel", channel.Id, model.ChannelSortByUsername, 0, 100).Return([]*model.User{
+		{Id: "callerID"},
+		{Id: "userID"},
+		{Id: "botID", IsBot: true},
+	}, nil).Once()
+	api.On("PublishWebSocketEvent", wsEventCallRinging, mock.Anything, &model.WebsocketBroadcast{UserId: "userID", ReliableClusterSend: true}).Once()
+
+	call, err := p.startCall(channel, "callerID", "", "")
+	require.NoError(t, err)
+
+	state, err := p.kvGetChannelState(channel.Id)
+	require.NoError(t, err)
+	require.Equal(t, call.ID, state.Call.ID)
+	require.Equal(t, []string{"userID"}, state.Call.getRingingUserIDs())
+}
+
+func TestHandleRingingAction(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	channelID := model.NewId()
+	require.NoError(t, p.kvSetAtomicChannelState(channelID, func(_ *channelState) (*channelState, error) {
+		return &channelState{
+			Call: &callState{
+				ID:      "callID",
+				OwnerID: "callerID",
+				Users: map[string]*userState{
+					"callerID": {},
+				},
+				Ringing: map[string]*ringingState{
+					"userA": {RingAt: 1000},
+					"userB": {RingAt: 1000},
+				},
+			},
+		}, nil
+	}))
+
+	ringingAction := func(userID, action string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/calls/"+channelID+"/ringing/"+action, nil)
+		r.Header.Set("Mattermost-User-Id", userID)
+		p.ServeHTTP(nil, w, r)
+		return w.Code
+	}
+
+	t.Run("invalid action", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, ringingAction("userA", "ignore"))
+	})
+
+	t.Run("not rung", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, ringingAction("userC", ringingActionAccept))
+	})
+
+	t.Run("decline", func(t *testing.T) {
+		api.On("PublishWebSocketEvent", wsEventCallRingingStopped, mock.Anything, &model.WebsocketBroadcast{UserId: "userA", ReliableClusterSend: true}).Once()
+		api.On("PublishWebSocketEvent", wsEventCallRingingDeclined, map[string]interface{}{
+			"channelID": channelID,
+			"callID":    "callID",
+			"userID":    "userA",
+		}, &model.WebsocketBroadcast{UserId: "callerID", ReliableClusterSend: true}).Once()
+		require.Equal(t, http.StatusOK, ringingAction("userA", ringingActionDecline))
+
+		// Declining twice fails since the user is no longer being rung.
+		require.Equal(t, http.StatusBadRequest, ringingAction("userA", ringingActionDecline))
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		api.On("PublishWebSocketEvent", wsEventCallRingingStopped, mock.Anything, &model.WebsocketBroadcast{UserId: "userB", ReliableClusterSend: true}).Once()
+		require.Equal(t, http.StatusOK, ringingAction("userB", ringingActionAccept))
+	})
+
+	state, err := p.kvGetChannelState(channelID)
+	require.NoError(t, err)
+	require.Empty(t, state.Call.Ringing)
+}
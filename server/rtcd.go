@@ -42,27 +42,47 @@ type rtcdHost struct {
 	client       *rtcd.Client
 	callsCounter uint64
 	flagged      bool
-	mut          sync.RWMutex
+	disconnected bool
+	// The value of callsCounter when the load was last updated. Used to
+	// account for the calls started since then.
+	loadCallsCounter uint64
+	mut              sync.RWMutex
 }
 
 type rtcdClientManager struct {
 	ctx *Plugin
 
-	rtcdURL  string
-	rtcdPort string
+	// The name of the pool this manager is handling. Empty for the default one.
+	pool         string
+	rtcdURL      string
+	rtcdPort     string
+	rtcdClientID string
+	rtcdAuthKey  string
 
 	hosts map[string]*rtcdHost
 
+	// The load on the hosts as reported by all the plugin nodes.
+	load    map[string]rtcdGlobalLoad
+	loadMut sync.RWMutex
+
+	// The hosts state as set by system admins.
+	hostsAdmin map[string]*rtcdHostAdminState
+	adminMut   sync.RWMutex
+
 	mut     sync.RWMutex
 	closeCh chan (struct{})
 }
 
-func (p *Plugin) newRTCDClientManager(rtcdURL string) (m *rtcdClientManager, err error) {
+func (p *Plugin) newRTCDClientManager(poolCfg rtcdPoolConfig) (m *rtcdClientManager, err error) {
+	rtcdURL := poolCfg.URL
 	m = &rtcdClientManager{
-		ctx:     p,
-		rtcdURL: rtcdURL,
-		closeCh: make(chan struct{}),
-		hosts:   map[string]*rtcdHost{},
+		ctx:          p,
+		pool:         poolCfg.Name,
+		rtcdURL:      rtcdURL,
+		rtcdClientID: poolCfg.ClientID,
+		rtcdAuthKey:  poolCfg.AuthKey,
+		closeCh:      make(chan struct{}),
+		hosts:        map[string]*rtcdHost{},
 	}
 
 	ips, port, err := resolveURL(rtcdURL, resolveTimeout)
@@ -71,6 +91,10 @@ func (p *Plugin) newRTCDClientManager(rtcdURL string) (m *rtcdClientManager, err
 	}
 	m.rtcdPort = port
 
+	if _, err := m.loadHostsAdminState(); err != nil {
+		return nil, err
+	}
+
 	hosts := m.hosts
 
 	defer func() {
@@ -83,6 +107,11 @@ func (p *Plugin) newRTCDClientManager(rtcdURL string) (m *rtcdClientManager, err
 	}()
 
 	for _, ip := range ips {
+		if m.isRemoved(ip.String()) {
+			m.ctx.LogDebug("skipping removed rtcd host", "host", ip.String())
+			continue
+		}
+
 		client, err := m.newRTCDClient(rtcdURL, ip.String(), getDialFn(ip.String(), port))
 		if err != nil {
 			return nil, err
@@ -95,6 +124,7 @@ func (p *Plugin) newRTCDClientManager(rtcdURL string) (m *rtcdClientManager, err
 	}
 
 	go m.hostsChecker()
+	go m.loadReporter()
 
 	return m, nil
 }
@@ -115,6 +145,10 @@ func (m *rtcdClientManager) hostsChecker() {
 				continue
 			}
 
+			if _, err := m.loadHostsAdminState(); err != nil {
+				m.ctx.LogError(err.Error())
+			}
+
 			ipsMap := map[string]bool{}
 			for _, ip := range ips {
 				ipsMap[ip.String()] = true
@@ -128,6 +162,7 @@ func (m *rtcdClientManager) hostsChecker() {
 					// flag host
 					m.ctx.LogDebug("flagging host", "host", ip)
 					host.flagged = true
+					go m.migrateCalls(ip)
 				} else if ok && host.flagged {
 					// unflag host in the rare case a new host came up with the same ip.
 					m.ctx.LogDebug("unflagging host", "host", ip)
@@ -139,7 +174,7 @@ func (m *rtcdClientManager) hostsChecker() {
 
 			// we look for newly advertised hosts we may not have a client for yet.
 			for ip := range ipsMap {
-				if h := m.getHost(ip); h == nil {
+				if h := m.getHost(ip); h == nil && !m.isRemoved(ip) {
 					// create new client
 
 					// We add some jitter to try and avoid multiple clients to attempt
@@ -203,7 +238,7 @@ func (m *rtcdClientManager) addHost(host string, client *rtcd.Client) (err error
 		client: client,
 	}
 
-	go m.clientReader(client)
+	go m.clientReader(host, client)
 
 	return nil
 }
@@ -215,29 +250,41 @@ func (m *rtcdClientManager) getHost(ip string) *rtcdHost {
 }
 
 // GetHostForNewCall returns the host to which a new call should be routed.
-// It performs a simple round-robin strategy based on number of calls.
-// New calls are routed to the non-flagged host with the smaller count.
+// Flagged and cordoned hosts are excluded and the choice among the remaining ones is
+// delegated to the configured placement strategy.
 func (m *rtcdClientManager) GetHostForNewCall() (string, error) {
 	m.mut.RLock()
 	defer m.mut.RUnlock()
 
-	var h *rtcdHost
-	var minCounter uint64
+	m.loadMut.RLock()
+	var hosts []*rtcdHost
+	var stats []rtcdHostStats
 	for _, host := range m.hosts {
+		if m.isCordoned(host.ip) {
+			continue
+		}
 		host.mut.RLock()
-		// TODO: this only takes into consideration the calls started from this
-		// instance. A better strategy would be to ask rtcd for a global count (coming soon).
-		// TODO: consider also checking if the client is currently connected.
-		if !host.flagged && (h == nil || host.callsCounter < minCounter) {
-			h = host
-			minCounter = host.callsCounter
+		if !host.flagged {
+			load := m.load[host.ip]
+			hosts = append(hosts, host)
+			stats = append(stats, rtcdHostStats{
+				IP:           host.ip,
+				Connected:    !host.disconnected,
+				CallsCounter: host.callsCounter,
+				// Calls started since the last load update are not reported yet.
+				Calls:    load.Calls + int(host.callsCounter-host.loadCallsCounter),
+				Sessions: load.Sessions,
+			})
 		}
 		host.mut.RUnlock()
 	}
+	m.loadMut.RUnlock()
 
-	if h == nil {
+	idx := m.getPlacementStrategy().PickHost(stats)
+	if idx < 0 || idx >= len(hosts) {
 		return "", fmt.Errorf("no host available")
 	}
+	h := hosts[idx]
 
 	h.mut.Lock()
 	h.callsCounter++
@@ -247,7 +294,7 @@ func (m *rtcdClientManager) GetHostForNewCall() (string, error) {
 }
 
 // Send routes the message to the appropriate host that's handling the given
-// call. If this is missing a new client is created and added to the mapping.
+// call. Calls belonging to a different pool are routed through its manager.
 func (m *rtcdClientManager) Send(msg rtcd.ClientMessage, callID string) error {
 	state, err := m.ctx.kvGetChannelState(callID)
 	if err != nil {
@@ -256,16 +303,30 @@ func (m *rtcdClientManager) Send(msg rtcd.ClientMessage, callID string) error {
 	if state.Call == nil {
 		return fmt.Errorf("state.Call should not be nil")
 	}
-	host := state.Call.RTCDHost
 
+	if state.Call.RTCDPool != m.pool {
+		pm := m.ctx.getRTCDManager(state.Call.RTCDPool)
+		if pm == nil {
+			return fmt.Errorf("rtcd pool %q is missing", state.Call.RTCDPool)
+		}
+		return pm.sendToHost(msg, state.Call.RTCDHost)
+	}
+
+	return m.sendToHost(msg, state.Call.RTCDHost)
+}
+
+// sendToHost sends the message to the given host. If this is missing a new
+// client is created and added to the mapping.
+func (m *rtcdClientManager) sendToHost(msg rtcd.ClientMessage, host string) error {
 	var client *rtcd.Client
+	var err error
 	if h := m.getHost(host); h == nil {
 		m.ctx.LogDebug("creating client for missing host on send", "host", host)
 		client, err = m.newRTCDClient(m.rtcdURL, host, getDialFn(host, m.rtcdPort))
 		if err != nil {
 			return fmt.Errorf("failed to create new client: %w", err)
 		}
-		if err := m.addHost(state.Call.RTCDHost, client); err != nil {
+		if err := m.addHost(host, client); err != nil {
 			return fmt.Errorf("failed to add host: %w", err)
 		}
 	} else {
@@ -369,6 +430,8 @@ func (m *rtcdClientManager) newRTCDClient(rtcdURL, host string, dialFn rtcd.Dial
 			return fmt.Errorf("host was flagged")
 		}
 
+		h.setConnected(false)
+
 		// On disconnect, it's possible the rtcd server restarted
 		// and cleared its stored credentials, so we attempt to connect and
 		// register again if that fails.
@@ -416,7 +479,7 @@ func (m *rtcdClientManager) newRTCDClient(rtcdURL, host string, dialFn rtcd.Dial
 func (m *rtcdClientManager) getStoredRTCDConfig() (rtcd.ClientConfig, error) {
 	var cfg rtcd.ClientConfig
 	m.ctx.metrics.IncStoreOp("KVGet")
-	data, appErr := m.ctx.API.KVGet(rtcdConfigKey)
+	data, appErr := m.ctx.API.KVGet(m.poolKey(rtcdConfigKey))
 	if appErr != nil {
 		return cfg, fmt.Errorf("failed to get rtcd config: %w", appErr)
 	}
@@ -449,6 +512,14 @@ func (m *rtcdClientManager) getRTCDClientConfig(rtcdURL string) (rtcd.ClientConf
 	cfg.AuthKey = os.Getenv("MM_CALLS_RTCD_AUTH_KEY")
 	cfg.URL = rtcdURL
 
+	// Pools can be configured with their own credentials.
+	if m.rtcdClientID != "" {
+		cfg.ClientID = m.rtcdClientID
+	}
+	if m.rtcdAuthKey != "" {
+		cfg.AuthKey = m.rtcdAuthKey
+	}
+
 	// Parsing the URL in case it's already containing credentials.
 	u, clientID, authKey, err := parseURL(cfg.URL)
 	if err != nil {
@@ -506,7 +577,7 @@ func (m *rtcdClientManager) storeConfig(cfg rtcd.ClientConfig) error {
 		return fmt.Errorf("failed to marshal rtcd client config: %w", err)
 	}
 	m.ctx.metrics.IncStoreOp("KVSet")
-	if err := m.ctx.API.KVSet(rtcdConfigKey, cfgData); err != nil {
+	if err := m.ctx.API.KVSet(m.poolKey(rtcdConfigKey), cfgData); err != nil {
 		return fmt.Errorf("failed to store rtcd client config: %w", err)
 	}
 	return nil
@@ -564,13 +635,16 @@ func (m *rtcdClientManager) registerRTCDClient(cfg rtcd.ClientConfig, reconnectC
 	return cfg, client, client.Connect()
 }
 
-func (m *rtcdClientManager) handleClientMsg(msg rtcd.ClientMessage) error {
+func (m *rtcdClientManager) handleClientMsg(host string, msg rtcd.ClientMessage) error {
 	if msg.Type == rtcd.ClientMessageHello {
 		msgData, ok := msg.Data.(map[string]string)
 		if !ok {
 			return fmt.Errorf("unexpected data type %T", msg.Data)
 		}
-		m.ctx.LogDebug("received hello message from rtcd", "connID", msgData["connID"])
+		m.ctx.LogDebug("received hello message from rtcd", "connID", msgData["connID"], "host", host)
+		if h := m.getHost(host); h != nil {
+			h.setConnected(true)
+		}
 		return nil
 	} else if msg.Type == rtcd.ClientMessageClose {
 		msgData, ok := msg.Data.(map[string]string)
@@ -585,6 +659,15 @@ func (m *rtcdClientManager) handleClientMsg(msg rtcd.ClientMessage) error {
 		m.ctx.mut.RLock()
 		us := m.ctx.sessions[sessionID]
 		m.ctx.mut.RUnlock()
+		if us != nil {
+			// Sessions that got migrated to a new host are expected to be
+			// closed by the previous one.
+			if state, err := m.ctx.kvGetChannelState(us.channelID); err == nil && state != nil &&
+				state.Call != nil && state.Call.RTCDHost != host {
+				m.ctx.LogDebug("ignoring close message from previous host", "sessionID", sessionID, "host", host)
+				return nil
+			}
+		}
 		if us != nil && atomic.CompareAndSwapInt32(&us.rtcClosed, 0, 1) {
 			m.ctx.LogDebug("closing rtc close channel", "sessionID", sessionID)
 			close(us.rtcCloseCh)
@@ -627,7 +710,7 @@ func getDialFn(host, port string) rtcd.DialContextFn {
 	}
 }
 
-func (m *rtcdClientManager) clientReader(client *rtcd.Client) {
+func (m *rtcdClientManager) clientReader(host string, client *rtcd.Client) {
 	for {
 		select {
 		case err, ok := <-client.ErrorCh():
@@ -646,7 +729,7 @@ func (m *rtcdClientManager) clientReader(client *rtcd.Client) {
 			if !ok {
 				return
 			}
-			if err := m.handleClientMsg(msg); err != nil {
+			if err := m.handleClientMsg(host, msg); err != nil {
 				m.ctx.LogError(err.Error())
 			}
 		}
@@ -658,3 +741,17 @@ func (h *rtcdHost) isFlagged() bool {
 	defer h.mut.RUnlock()
 	return h.flagged
 }
+
+func (h *rtcdHost) setConnected(connected bool) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.disconnected = !connected
+}
+
+// poolKey returns the given KV store key scoped to the manager's pool.
+func (m *rtcdClientManager) poolKey(key string) string {
+	if m.pool == "" {
+		return key
+	}
+	return key + "_" + m.pool
+}
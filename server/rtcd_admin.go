@@ -0,0 +1,271 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	rtcdHostsAdminKey = "rtcd_hosts_admin"
+
+	rtcdHostActionCordon   = "cordon"
+	rtcdHostActionUncordon = "uncordon"
+	rtcdHostActionDrain    = "drain"
+	rtcdHostActionRemove   = "remove"
+	rtcdHostActionRestore  = "restore"
+)
+
+var (
+	errRTCDHostNotFound = errors.New("rtcd host not found")
+	errRTCDHostRemoved  = errors.New("rtcd host was removed, it needs to be restored instead")
+)
+
+// rtcdHostAdminState is the state of a host as set by system admins. It's
+// shared across all the plugin nodes.
+type rtcdHostAdminState struct {
+	// No new calls are routed to a cordoned host.
+	Cordoned bool `json:"cordoned"`
+	// The active calls are migrated off a draining host.
+	Draining bool `json:"draining"`
+	// A removed host is drained and disconnected from.
+	Removed   bool   `json:"removed"`
+	Pool      string `json:"pool,omitempty"`
+	UpdateAt  int64  `json:"update_at"`
+	UpdatedBy string `json:"updated_by"`
+}
+
+// rtcdHostInfo is the information about a host exposed to system admins.
+type rtcdHostInfo struct {
+	IP           string `json:"ip"`
+	Pool         string `json:"pool"`
+	Flagged      bool   `json:"flagged"`
+	Cordoned     bool   `json:"cordoned"`
+	Draining     bool   `json:"draining"`
+	Removed      bool   `json:"removed"`
+	Connected    bool   `json:"connected"`
+	CallsCounter uint64 `json:"calls_counter"`
+	Calls        int    `json:"calls"`
+	Sessions     int    `json:"sessions"`
+}
+
+func (p *Plugin) kvGetRTCDHostsAdminState() (map[string]*rtcdHostAdminState, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(rtcdHostsAdminKey)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	states := map[string]*rtcdHostAdminState{}
+	if data == nil {
+		return states, nil
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (p *Plugin) kvSetAtomicRTCDHostsAdminState(cb func(states map[string]*rtcdHostAdminState) (bool, error)) error {
+	return p.kvSetAtomic(rtcdHostsAdminKey, func(data []byte) ([]byte, error) {
+		states := map[string]*rtcdHostAdminState{}
+		if data != nil {
+			if err := json.Unmarshal(data, &states); err != nil {
+				return nil, err
+			}
+		}
+		changed, err := cb(states)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return nil, nil
+		}
+		return json.Marshal(states)
+	})
+}
+
+// isCordoned returns whether new calls should not be routed to the given host.
+func (m *rtcdClientManager) isCordoned(host string) bool {
+	m.adminMut.RLock()
+	defer m.adminMut.RUnlock()
+	st := m.hostsAdmin[host]
+	return st != nil && (st.Cordoned || st.Removed)
+}
+
+func (m *rtcdClientManager) isRemoved(host string) bool {
+	m.adminMut.RLock()
+	defer m.adminMut.RUnlock()
+	st := m.hostsAdmin[host]
+	return st != nil && st.Removed
+}
+
+// loadHostsAdminState refreshes the local copy of the hosts admin state.
+func (m *rtcdClientManager) loadHostsAdminState() (map[string]*rtcdHostAdminState, error) {
+	states, err := m.ctx.kvGetRTCDHostsAdminState()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rtcd hosts admin state: %w", err)
+	}
+
+	m.adminMut.Lock()
+	m.hostsAdmin = states
+	m.adminMut.Unlock()
+
+	return states, nil
+}
+
+// applyHostAdminState reloads the hosts admin state and acts on the given
+// host accordingly.
+func (m *rtcdClientManager) applyHostAdminState(host string) error {
+	states, err := m.loadHostsAdminState()
+	if err != nil {
+		return err
+	}
+
+	st := states[host]
+	if st == nil {
+		return nil
+	}
+
+	if st.Draining || st.Removed {
+		m.migrateCalls(host)
+	}
+
+	if st.Removed && m.getHost(host) != nil {
+		if err := m.removeHost(host); err != nil {
+			return fmt.Errorf("failed to remove host: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// hasHost returns whether the given host is part of the manager's pool.
+func (m *rtcdClientManager) hasHost(host string) bool {
+	if m.getHost(host) != nil {
+		return true
+	}
+	m.adminMut.RLock()
+	defer m.adminMut.RUnlock()
+	st := m.hostsAdmin[host]
+	return st != nil && st.Pool == m.pool
+}
+
+// setHostAdminState performs the given admin action on the host and
+// propagates the change to all the plugin nodes.
+func (m *rtcdClientManager) setHostAdminState(host, action, userID string) error {
+	if !m.hasHost(host) {
+		return errRTCDHostNotFound
+	}
+
+	if err := m.ctx.kvSetAtomicRTCDHostsAdminState(func(states map[string]*rtcdHostAdminState) (bool, error) {
+		if action == rtcdHostActionUncordon || action == rtcdHostActionRestore {
+			st, ok := states[host]
+			if !ok {
+				return false, nil
+			}
+			// Bringing back a removed host has to be explicit. Once its
+			// entry is gone, the host gets a client again the next time it
+			// resolves.
+			if st.Removed && action == rtcdHostActionUncordon {
+				return false, errRTCDHostRemoved
+			}
+			delete(states, host)
+			return true, nil
+		}
+
+		st := states[host]
+		if st == nil {
+			st = &rtcdHostAdminState{}
+			states[host] = st
+		}
+		st.Cordoned = true
+		st.Pool = m.pool
+		switch action {
+		case rtcdHostActionDrain:
+			st.Draining = true
+		case rtcdHostActionRemove:
+			st.Draining = true
+			st.Removed = true
+		}
+		st.UpdateAt = time.Now().UnixMilli()
+		st.UpdatedBy = userID
+
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("failed to set rtcd hosts admin state: %w", err)
+	}
+
+	m.ctx.LogInfo("rtcd host admin state updated", "host", host, "action", action, "userID", userID)
+
+	if err := m.ctx.sendClusterMessage(clusterMessage{
+		SenderID: m.ctx.nodeID,
+		RTCDHost: host,
+	}, clusterMessageTypeRTCDHostUpdate, ""); err != nil {
+		m.ctx.LogError(err.Error())
+	}
+
+	return m.applyHostAdminState(host)
+}
+
+// getHostsInfo returns the information about all the known hosts, including
+// the ones that have been removed.
+func (m *rtcdClientManager) getHostsInfo() []rtcdHostInfo {
+	m.adminMut.RLock()
+	hostsAdmin := make(map[string]rtcdHostAdminState, len(m.hostsAdmin))
+	for ip, st := range m.hostsAdmin {
+		hostsAdmin[ip] = *st
+	}
+	m.adminMut.RUnlock()
+
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	m.loadMut.RLock()
+	defer m.loadMut.RUnlock()
+
+	hosts := make([]rtcdHostInfo, 0, len(m.hosts))
+	for ip, host := range m.hosts {
+		host.mut.RLock()
+		info := rtcdHostInfo{
+			IP:           ip,
+			Pool:         m.pool,
+			Flagged:      host.flagged,
+			Connected:    !host.disconnected,
+			CallsCounter: host.callsCounter,
+			Calls:        m.load[ip].Calls,
+			Sessions:     m.load[ip].Sessions,
+		}
+		host.mut.RUnlock()
+		if st, ok := hostsAdmin[ip]; ok {
+			info.Cordoned = st.Cordoned
+			info.Draining = st.Draining
+			info.Removed = st.Removed
+		}
+		hosts = append(hosts, info)
+	}
+
+	for ip, st := range hostsAdmin {
+		if _, ok := m.hosts[ip]; ok || st.Pool != m.pool {
+			continue
+		}
+		hosts = append(hosts, rtcdHostInfo{
+			IP:       ip,
+			Pool:     m.pool,
+			Cordoned: st.Cordoned,
+			Draining: st.Draining,
+			Removed:  st.Removed,
+			Calls:    m.load[ip].Calls,
+			Sessions: m.load[ip].Sessions,
+		})
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].IP < hosts[j].IP
+	})
+
+	return hosts
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var rtcdHostActionRE = regexp.MustCompile(`^\/rtcd\/hosts\/([^/]+)\/(cordon|uncordon|drain|remove|restore)$`)
+
+func (p *Plugin) handleGetRTCDHosts(w http.ResponseWriter, r *http.Request) {
+	var res httpResponse
+	defer p.httpAudit("handleGetRTCDHosts", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	if p.rtcdManager == nil {
+		res.Err = "rtcd is not enabled"
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	var hosts []rtcdHostInfo
+	for _, m := range p.getRTCDManagers() {
+		hosts = append(hosts, m.getHostsInfo()...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(hosts); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+func (p *Plugin) handleRTCDHostAction(w http.ResponseWriter, r *http.Request, host, action string) {
+	var res httpResponse
+	defer p.httpAudit("handleRTCDHostAction", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	if p.rtcdManager == nil {
+		res.Err = "rtcd is not enabled"
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	// Hosts are tracked by their resolved IP address, in its canonical form.
+	ip := net.ParseIP(host)
+	if ip == nil {
+		res.Err = "invalid host"
+		res.Code = http.StatusBadRequest
+		return
+	}
+	host = ip.String()
+
+	var m *rtcdClientManager
+	for _, pm := range p.getRTCDManagers() {
+		if pm.hasHost(host) {
+			m = pm
+			break
+		}
+	}
+	if m == nil {
+		res.Err = errRTCDHostNotFound.Error()
+		res.Code = http.StatusNotFound
+		return
+	}
+
+	if err := m.setHostAdminState(host, action, userID); err != nil {
+		res.Err = err.Error()
+		if errors.Is(err, errRTCDHostNotFound) {
+			res.Code = http.StatusNotFound
+		} else if errors.Is(err, errRTCDHostRemoved) {
+			res.Code = http.StatusConflict
+		} else {
+			res.Code = http.StatusInternalServerError
+		}
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
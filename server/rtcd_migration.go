@@ -0,0 +1,139 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+
+	rtcd "github.com/mattermost/rtcd/service"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// migrateCalls moves the calls this node has sessions for off the given
+// host. Calls with no local sessions are migrated by the other nodes once
+// they flag the host as well.
+func (m *rtcdClientManager) migrateCalls(host string) {
+	callIDs := map[string]struct{}{}
+	m.ctx.mut.RLock()
+	for _, us := range m.ctx.sessions {
+		callIDs[us.channelID] = struct{}{}
+	}
+	m.ctx.mut.RUnlock()
+
+	for callID := range callIDs {
+		if err := m.migrateCall(callID, host); err != nil {
+			m.ctx.LogError("failed to migrate call", "error", err.Error(), "callID", callID, "host", host)
+		}
+	}
+}
+
+// migrateCall routes the call to a new host if it's currently served by the
+// given one. All the nodes are then notified so that they can move the
+// sessions they are handling.
+func (m *rtcdClientManager) migrateCall(callID, fromHost string) error {
+	state, err := m.ctx.kvGetChannelState(callID)
+	if err != nil {
+		return fmt.Errorf("failed to get channel state: %w", err)
+	}
+	if !m.isCallOnHost(state, fromHost) {
+		// Call has ended, is served by a different host or was migrated already.
+		return nil
+	}
+
+	// Picking the host once so that retries of the atomic update below don't
+	// go through the placement again.
+	host, err := m.GetHostForNewCall()
+	if err != nil {
+		return fmt.Errorf("failed to get rtcd host: %w", err)
+	}
+
+	var toHost string
+	if err := m.ctx.kvSetAtomicChannelState(callID, func(state *channelState) (*channelState, error) {
+		toHost = ""
+		if !m.isCallOnHost(state, fromHost) {
+			return nil, nil
+		}
+
+		state.Call.RTCDHost = host
+		toHost = host
+
+		return state, nil
+	}); err != nil {
+		return fmt.Errorf("failed to set channel state: %w", err)
+	}
+
+	if toHost == "" {
+		// Call has ended or was migrated already.
+		return nil
+	}
+
+	m.ctx.LogInfo("migrating call to new rtcd host", "callID", callID, "from", fromHost, "to", toHost)
+
+	if err := m.ctx.sendClusterMessage(clusterMessage{
+		ChannelID: callID,
+		SenderID:  m.ctx.nodeID,
+		RTCDHost:  fromHost,
+	}, clusterMessageTypeMigrate, ""); err != nil {
+		m.ctx.LogError(err.Error())
+	}
+
+	m.migrateSessions(callID, fromHost)
+
+	return nil
+}
+
+// isCallOnHost returns whether the call in the given state is served by
+// the given host of this manager's pool.
+func (m *rtcdClientManager) isCallOnHost(state *channelState, host string) bool {
+	return state != nil && state.Call != nil && state.Call.RTCDPool == m.pool && state.Call.RTCDHost == host
+}
+
+// migrateSessions moves the local sessions for the given call from the
+// previous host to the one currently set in the call state. Clients are
+// then asked to renegotiate their connection.
+func (m *rtcdClientManager) migrateSessions(callID, fromHost string) {
+	var sessions []*session
+	m.ctx.mut.RLock()
+	for _, us := range m.ctx.sessions {
+		if us.channelID == callID {
+			sessions = append(sessions, us)
+		}
+	}
+	m.ctx.mut.RUnlock()
+
+	h := m.getHost(fromHost)
+
+	for _, us := range sessions {
+		// The previous host may be unreachable already, in which case the
+		// session is gone anyway.
+		if h != nil {
+			if err := h.client.Send(rtcd.ClientMessage{
+				Type: rtcd.ClientMessageLeave,
+				Data: map[string]string{
+					"sessionID": us.originalConnID,
+				},
+			}); err != nil {
+				m.ctx.LogWarn("failed to send client leave message", "error", err.Error(), "host", fromHost)
+			}
+		}
+
+		if err := m.Send(rtcd.ClientMessage{
+			Type: rtcd.ClientMessageJoin,
+			Data: map[string]string{
+				"callID":    callID,
+				"userID":    us.userID,
+				"sessionID": us.originalConnID,
+			},
+		}, callID); err != nil {
+			m.ctx.LogError("failed to send client join message", "error", err.Error(), "callID", callID)
+			continue
+		}
+
+		m.ctx.publishWebSocketEvent(wsEventCallRTCMigrated, map[string]interface{}{
+			"callID": callID,
+			"connID": us.connID,
+		}, &model.WebsocketBroadcast{UserId: us.userID, ReliableClusterSend: true})
+	}
+}
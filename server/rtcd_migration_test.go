@@ -0,0 +1,50 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateCall(t *testing.T) {
+	p, _, _ := newTestPlugin(t)
+	host := &rtcdHost{ip: "10.0.0.2"}
+	m := &rtcdClientManager{
+		ctx:   p,
+		hosts: map[string]*rtcdHost{host.ip: host},
+	}
+
+	t.Run("no call", func(t *testing.T) {
+		require.NoError(t, m.migrateCall("callID", "10.0.0.1"))
+		require.Zero(t, host.callsCounter)
+	})
+
+	t.Run("call on a different host", func(t *testing.T) {
+		require.NoError(t, p.kvSetAtomicChannelState("callID", func(_ *channelState) (*channelState, error) {
+			return &channelState{Call: &callState{ID: "callID", RTCDHost: "10.0.0.3"}}, nil
+		}))
+
+		require.NoError(t, m.migrateCall("callID", "10.0.0.1"))
+		require.Zero(t, host.callsCounter)
+
+		state, err := p.kvGetChannelState("callID")
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.3", state.Call.RTCDHost)
+	})
+
+	t.Run("call in a different pool", func(t *testing.T) {
+		require.NoError(t, p.kvSetAtomicChannelState("callID", func(_ *channelState) (*channelState, error) {
+			return &channelState{Call: &callState{ID: "callID", RTCDHost: "10.0.0.1", RTCDPool: "eu"}}, nil
+		}))
+
+		require.NoError(t, m.migrateCall("callID", "10.0.0.1"))
+		require.Zero(t, host.callsCounter)
+
+		state, err := p.kvGetChannelState("callID")
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.1", state.Call.RTCDHost)
+	})
+}
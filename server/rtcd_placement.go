@@ -0,0 +1,242 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	rtcdPlacementLeastCalls = "least_calls"
+	rtcdPlacementLoadAware  = "load_aware"
+
+	rtcdLoadKey = "rtcd_load"
+	// Reports older than this are considered stale and ignored as the node
+	// that generated them is likely gone.
+	rtcdLoadMaxAge = 3 * hostCheckInterval
+)
+
+// rtcdHostStats is a snapshot of the information available about a host at
+// the time a new call needs to be placed.
+type rtcdHostStats struct {
+	IP        string
+	Connected bool
+	// The number of calls started from this node on the host.
+	CallsCounter uint64
+	// The number of active calls and sessions on the host across all nodes.
+	Calls    int
+	Sessions int
+}
+
+// rtcdPlacementStrategy decides which rtcd host a new call should be routed to.
+type rtcdPlacementStrategy interface {
+	// PickHost returns the index of the chosen host or -1 if none of the
+	// given hosts is suitable.
+	PickHost(hosts []rtcdHostStats) int
+}
+
+// leastCallsStrategy picks the host with the smaller number of calls started
+// from this node.
+type leastCallsStrategy struct{}
+
+func (leastCallsStrategy) PickHost(hosts []rtcdHostStats) int {
+	idx := -1
+	for i, h := range hosts {
+		if idx == -1 || h.CallsCounter < hosts[idx].CallsCounter {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// loadAwareStrategy picks the connected host with the lowest load as
+// reported by all the plugin nodes.
+type loadAwareStrategy struct{}
+
+func (loadAwareStrategy) PickHost(hosts []rtcdHostStats) int {
+	idx := -1
+	for i, h := range hosts {
+		if !h.Connected {
+			continue
+		}
+		if idx == -1 {
+			idx = i
+			continue
+		}
+		load, minLoad := h.Calls+h.Sessions, hosts[idx].Calls+hosts[idx].Sessions
+		if load < minLoad || (load == minLoad && h.CallsCounter < hosts[idx].CallsCounter) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+func newRTCDPlacementStrategy(name string) rtcdPlacementStrategy {
+	if name == rtcdPlacementLoadAware {
+		return loadAwareStrategy{}
+	}
+	return leastCallsStrategy{}
+}
+
+// rtcdHostLoad is the load a plugin node is generating on a host.
+type rtcdHostLoad struct {
+	// The IDs of the active calls. These are needed to avoid counting
+	// the same call more than once when sessions are spread across nodes.
+	CallIDs  []string `json:"call_ids"`
+	Sessions int      `json:"sessions"`
+}
+
+// rtcdNodeLoad is the report periodically stored by every plugin node.
+type rtcdNodeLoad struct {
+	UpdateAt int64                    `json:"update_at"`
+	Hosts    map[string]*rtcdHostLoad `json:"hosts"`
+}
+
+// rtcdGlobalLoad is the load on a host aggregated from all the node reports.
+type rtcdGlobalLoad struct {
+	Calls    int
+	Sessions int
+}
+
+func aggregateRTCDLoad(reports map[string]*rtcdNodeLoad, now time.Time) map[string]rtcdGlobalLoad {
+	calls := map[string]map[string]struct{}{}
+	sessions := map[string]int{}
+	for _, report := range reports {
+		if now.Sub(time.UnixMilli(report.UpdateAt)) > rtcdLoadMaxAge {
+			continue
+		}
+		for ip, load := range report.Hosts {
+			if calls[ip] == nil {
+				calls[ip] = map[string]struct{}{}
+			}
+			for _, callID := range load.CallIDs {
+				calls[ip][callID] = struct{}{}
+			}
+			sessions[ip] += load.Sessions
+		}
+	}
+
+	global := make(map[string]rtcdGlobalLoad, len(calls))
+	for ip := range calls {
+		global[ip] = rtcdGlobalLoad{
+			Calls:    len(calls[ip]),
+			Sessions: sessions[ip],
+		}
+	}
+	return global
+}
+
+// getLocalLoad computes the load this node is generating on the rtcd hosts
+// based on its active sessions.
+func (m *rtcdClientManager) getLocalLoad() *rtcdNodeLoad {
+	sessions := map[string]int{}
+	m.ctx.mut.RLock()
+	for _, us := range m.ctx.sessions {
+		sessions[us.channelID]++
+	}
+	m.ctx.mut.RUnlock()
+
+	load := &rtcdNodeLoad{
+		UpdateAt: time.Now().UnixMilli(),
+		Hosts:    map[string]*rtcdHostLoad{},
+	}
+	for callID, cnt := range sessions {
+		state, err := m.ctx.kvGetChannelState(callID)
+		if err != nil {
+			m.ctx.LogError("failed to get channel state", "error", err.Error())
+			continue
+		}
+		if state == nil || state.Call == nil || state.Call.RTCDHost == "" || state.Call.RTCDPool != m.pool {
+			continue
+		}
+		hostLoad := load.Hosts[state.Call.RTCDHost]
+		if hostLoad == nil {
+			hostLoad = &rtcdHostLoad{}
+			load.Hosts[state.Call.RTCDHost] = hostLoad
+		}
+		hostLoad.CallIDs = append(hostLoad.CallIDs, callID)
+		hostLoad.Sessions += cnt
+	}
+
+	return load
+}
+
+// updateLoad shares the load generated by this node with the other nodes
+// and refreshes the global view used to place new calls.
+func (m *rtcdClientManager) updateLoad() error {
+	localLoad := m.getLocalLoad()
+
+	var reports map[string]*rtcdNodeLoad
+	if err := m.ctx.kvSetAtomic(m.poolKey(rtcdLoadKey), func(data []byte) ([]byte, error) {
+		reports = map[string]*rtcdNodeLoad{}
+		if data != nil {
+			if err := json.Unmarshal(data, &reports); err != nil {
+				return nil, err
+			}
+		}
+
+		now := time.Now()
+		for nodeID, report := range reports {
+			if now.Sub(time.UnixMilli(report.UpdateAt)) > rtcdLoadMaxAge {
+				delete(reports, nodeID)
+			}
+		}
+		reports[m.ctx.nodeID] = localLoad
+
+		return json.Marshal(reports)
+	}); err != nil {
+		return fmt.Errorf("failed to store rtcd load: %w", err)
+	}
+
+	globalLoad := aggregateRTCDLoad(reports, time.Now())
+
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	m.loadMut.Lock()
+	defer m.loadMut.Unlock()
+	m.load = globalLoad
+	for _, host := range m.hosts {
+		host.mut.Lock()
+		host.loadCallsCounter = host.callsCounter
+		host.mut.Unlock()
+	}
+
+	return nil
+}
+
+// reportLoad updates the shared load information when the configured
+// placement strategy makes use of it. Other strategies don't need the load
+// so we avoid writing to the KV store on every tick.
+func (m *rtcdClientManager) reportLoad() error {
+	if _, ok := m.getPlacementStrategy().(loadAwareStrategy); !ok {
+		return nil
+	}
+	return m.updateLoad()
+}
+
+// loadReporter runs in a dedicated goroutine that routinely updates the
+// load information shared across plugin nodes.
+func (m *rtcdClientManager) loadReporter() {
+	ticker := time.NewTicker(hostCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.reportLoad(); err != nil {
+				m.ctx.LogError(err.Error())
+			}
+		case <-m.closeCh:
+			return
+		}
+	}
+}
+
+func (m *rtcdClientManager) getPlacementStrategy() rtcdPlacementStrategy {
+	if m.ctx == nil {
+		return leastCallsStrategy{}
+	}
+	return newRTCDPlacementStrategy(m.ctx.getConfiguration().RTCDPlacementStrategy)
+}
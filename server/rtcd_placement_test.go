@@ -0,0 +1,104 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeastCallsStrategy(t *testing.T) {
+	var s leastCallsStrategy
+	require.Equal(t, -1, s.PickHost(nil))
+
+	idx := s.PickHost([]rtcdHostStats{
+		{IP: "127.0.0.1", CallsCounter: 2, Connected: true},
+		{IP: "127.0.0.2", CallsCounter: 1},
+		{IP: "127.0.0.3", CallsCounter: 3, Connected: true},
+	})
+	require.Equal(t, 1, idx)
+}
+
+func TestLoadAwareStrategy(t *testing.T) {
+	var s loadAwareStrategy
+	require.Equal(t, -1, s.PickHost(nil))
+
+	t.Run("no connected hosts", func(t *testing.T) {
+		idx := s.PickHost([]rtcdHostStats{
+			{IP: "127.0.0.1"},
+			{IP: "127.0.0.2"},
+		})
+		require.Equal(t, -1, idx)
+	})
+
+	t.Run("lowest load", func(t *testing.T) {
+		idx := s.PickHost([]rtcdHostStats{
+			{IP: "127.0.0.1", Connected: true, Calls: 2, Sessions: 10},
+			{IP: "127.0.0.2", Connected: true, Calls: 4, Sessions: 4},
+			{IP: "127.0.0.3", Connected: false},
+		})
+		require.Equal(t, 1, idx)
+	})
+
+	t.Run("ties broken by local counter", func(t *testing.T) {
+		idx := s.PickHost([]rtcdHostStats{
+			{IP: "127.0.0.1", Connected: true, Calls: 1, Sessions: 2, CallsCounter: 5},
+			{IP: "127.0.0.2", Connected: true, Calls: 2, Sessions: 1, CallsCounter: 3},
+		})
+		require.Equal(t, 1, idx)
+	})
+}
+
+func TestAggregateRTCDLoad(t *testing.T) {
+	now := time.Now()
+
+	reports := map[string]*rtcdNodeLoad{
+		"nodeA": {
+			UpdateAt: now.UnixMilli(),
+			Hosts: map[string]*rtcdHostLoad{
+				"127.0.0.1": {CallIDs: []string{"callA", "callB"}, Sessions: 3},
+				"127.0.0.2": {CallIDs: []string{"callC"}, Sessions: 1},
+			},
+		},
+		"nodeB": {
+			UpdateAt: now.UnixMilli(),
+			Hosts: map[string]*rtcdHostLoad{
+				"127.0.0.1": {CallIDs: []string{"callA"}, Sessions: 2},
+			},
+		},
+		"nodeC": {
+			UpdateAt: now.Add(-2 * rtcdLoadMaxAge).UnixMilli(),
+			Hosts: map[string]*rtcdHostLoad{
+				"127.0.0.2": {CallIDs: []string{"callD"}, Sessions: 5},
+			},
+		},
+	}
+
+	require.Equal(t, map[string]rtcdGlobalLoad{
+		"127.0.0.1": {Calls: 2, Sessions: 5},
+		"127.0.0.2": {Calls: 1, Sessions: 1},
+	}, aggregateRTCDLoad(reports, now))
+}
+
+func TestReportLoad(t *testing.T) {
+	p, _, store := newTestPlugin(t)
+	m := &rtcdClientManager{
+		ctx:   p,
+		hosts: map[string]*rtcdHost{},
+	}
+
+	t.Run("least calls", func(t *testing.T) {
+		p.configuration.RTCDPlacementStrategy = rtcdPlacementLeastCalls
+		require.NoError(t, m.reportLoad())
+		require.Nil(t, store.get(rtcdLoadKey))
+	})
+
+	t.Run("load aware", func(t *testing.T) {
+		p.configuration.RTCDPlacementStrategy = rtcdPlacementLoadAware
+		require.NoError(t, m.reportLoad())
+		require.NotNil(t, store.get(rtcdLoadKey))
+	})
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var rtcdPoolNameRE = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// rtcdPoolConfig is the configuration of a named pool of RTCD hosts. Calls
+// started in the listed teams or channels get routed to the pool.
+type rtcdPoolConfig struct {
+	Name string `json:"name"`
+	// The URL to the RTCD service handling the pool.
+	URL string `json:"url"`
+	// Optional credentials. If not set the ones used for the default
+	// service apply.
+	ClientID   string   `json:"client_id,omitempty"`
+	AuthKey    string   `json:"auth_key,omitempty"`
+	TeamIDs    []string `json:"team_ids,omitempty"`
+	ChannelIDs []string `json:"channel_ids,omitempty"`
+}
+
+type RTCDPoolsConfigs []rtcdPoolConfig
+
+func (cfgs *RTCDPoolsConfigs) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	unquoted, err := strconv.Unquote(string(data))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(unquoted) == "" {
+		return nil
+	}
+
+	var dst []rtcdPoolConfig
+	err = json.Unmarshal([]byte(unquoted), &dst)
+	*cfgs = dst
+
+	return err
+}
+
+func (cfgs RTCDPoolsConfigs) IsValid() error {
+	names := map[string]bool{}
+	for i, cfg := range cfgs {
+		if !rtcdPoolNameRE.MatchString(cfg.Name) {
+			return fmt.Errorf("invalid pool %d: name is not valid", i)
+		}
+		if names[cfg.Name] {
+			return fmt.Errorf("invalid pool %d: duplicate name %q", i, cfg.Name)
+		}
+		names[cfg.Name] = true
+		if cfg.URL == "" {
+			return fmt.Errorf("invalid pool %d: URL should not be empty", i)
+		}
+		if u, err := url.Parse(cfg.URL); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid pool %d: URL is not valid", i)
+		}
+	}
+	return nil
+}
+
+// getPoolForChannel returns the name of the pool the calls in the given
+// channel should be routed to. Channel rules take precedence over team
+// ones. An empty string means the default pool.
+func (cfgs RTCDPoolsConfigs) getPoolForChannel(teamID, channelID string) string {
+	for _, cfg := range cfgs {
+		for _, id := range cfg.ChannelIDs {
+			if id == channelID {
+				return cfg.Name
+			}
+		}
+	}
+
+	if teamID == "" {
+		return ""
+	}
+
+	for _, cfg := range cfgs {
+		for _, id := range cfg.TeamIDs {
+			if id == teamID {
+				return cfg.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+// getRTCDManager returns the manager for the given pool or nil if the pool
+// doesn't exist. An empty name refers to the default pool.
+func (p *Plugin) getRTCDManager(pool string) *rtcdClientManager {
+	if pool == "" {
+		return p.rtcdManager
+	}
+	return p.rtcdPools[pool]
+}
+
+// getRTCDManagers returns the managers for all the pools, starting with the
+// default one.
+func (p *Plugin) getRTCDManagers() []*rtcdClientManager {
+	if p.rtcdManager == nil {
+		return nil
+	}
+	pools := make([]string, 0, len(p.rtcdPools))
+	for pool := range p.rtcdPools {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+
+	managers := []*rtcdClientManager{p.rtcdManager}
+	for _, pool := range pools {
+		managers = append(managers, p.rtcdPools[pool])
+	}
+	return managers
+}
+
+// getRTCDManagerForChannel returns the manager that new calls in the given
+// channel should be routed through.
+func (p *Plugin) getRTCDManagerForChannel(channel *model.Channel) *rtcdClientManager {
+	pool := p.getConfiguration().RTCDPools.getPoolForChannel(channel.TeamId, channel.Id)
+	if m := p.getRTCDManager(pool); m != nil {
+		return m
+	}
+	if pool != "" {
+		p.LogWarn("rtcd pool is not available, using default", "pool", pool, "channelID", channel.Id)
+	}
+	return p.rtcdManager
+}
+
+// getRTCDManagerForCall returns the manager that's handling the given call.
+func (p *Plugin) getRTCDManagerForCall(callID string) (*rtcdClientManager, error) {
+	state, err := p.kvGetChannelState(callID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel state: %w", err)
+	}
+	if state == nil || state.Call == nil {
+		return nil, fmt.Errorf("no call ongoing")
+	}
+	m := p.getRTCDManager(state.Call.RTCDPool)
+	if m == nil {
+		return nil, fmt.Errorf("rtcd pool %q is missing", state.Call.RTCDPool)
+	}
+	return m, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTCDPoolsConfigsUnmarshal(t *testing.T) {
+	var cfgs RTCDPoolsConfigs
+	require.NoError(t, json.Unmarshal([]byte(`""`), &cfgs))
+	require.Empty(t, cfgs)
+
+	data, err := json.Marshal(`[{"name": "eu", "url": "https://rtcd-eu.example.com", "team_ids": ["teamA"]}]`)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &cfgs))
+	require.Equal(t, RTCDPoolsConfigs{
+		{
+			Name:    "eu",
+			URL:     "https://rtcd-eu.example.com",
+			TeamIDs: []string{"teamA"},
+		},
+	}, cfgs)
+}
+
+func TestRTCDPoolsConfigsIsValid(t *testing.T) {
+	var cfgs RTCDPoolsConfigs
+	require.NoError(t, cfgs.IsValid())
+
+	cfgs = RTCDPoolsConfigs{
+		{Name: "eu", URL: "https://rtcd-eu.example.com"},
+		{Name: "us", URL: "https://rtcd-us.example.com"},
+	}
+	require.NoError(t, cfgs.IsValid())
+
+	cfgs[1].Name = "EU West"
+	require.EqualError(t, cfgs.IsValid(), "invalid pool 1: name is not valid")
+
+	cfgs[1].Name = "eu"
+	require.EqualError(t, cfgs.IsValid(), `invalid pool 1: duplicate name "eu"`)
+
+	cfgs[1].Name = "us"
+	cfgs[1].URL = ""
+	require.EqualError(t, cfgs.IsValid(), "invalid pool 1: URL should not be empty")
+
+	cfgs[1].URL = "rtcd-us"
+	require.EqualError(t, cfgs.IsValid(), "invalid pool 1: URL is not valid")
+}
+
+func TestRTCDPoolsConfigsGetPoolForChannel(t *testing.T) {
+	cfgs := RTCDPoolsConfigs{
+		{Name: "eu", URL: "https://rtcd-eu.example.com", TeamIDs: []string{"teamA"}},
+		{Name: "us", URL: "https://rtcd-us.example.com", TeamIDs: []string{"teamB"}, ChannelIDs: []string{"channelA"}},
+	}
+
+	require.Equal(t, "eu", cfgs.getPoolForChannel("teamA", "channelB"))
+	require.Equal(t, "us", cfgs.getPoolForChannel("teamB", "channelB"))
+
+	// Channel rules take precedence.
+	require.Equal(t, "us", cfgs.getPoolForChannel("teamA", "channelA"))
+
+	// DMs and GMs have no team.
+	require.Equal(t, "us", cfgs.getPoolForChannel("", "channelA"))
+	require.Equal(t, "", cfgs.getPoolForChannel("", "channelB"))
+
+	require.Equal(t, "", cfgs.getPoolForChannel("teamC", "channelC"))
+}
@@ -4,9 +4,13 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -159,6 +163,34 @@ func TestGetHostForNewCall(t *testing.T) {
 		require.Equal(t, uint64(100), m.hosts["127.0.0.2"].callsCounter)
 		require.Equal(t, uint64(0), m.hosts["127.0.0.1"].callsCounter)
 	})
+
+	t.Run("load balancing - one cordoned", func(t *testing.T) {
+		m := &rtcdClientManager{
+			hosts: map[string]*rtcdHost{
+				"127.0.0.1": {
+					ip: "127.0.0.1",
+				},
+				"127.0.0.2": {
+					ip: "127.0.0.2",
+				},
+			},
+			hostsAdmin: map[string]*rtcdHostAdminState{
+				"127.0.0.1": {
+					Cordoned: true,
+				},
+			},
+		}
+
+		for i := 0; i < 10; i++ {
+			host, err := m.GetHostForNewCall()
+			require.NoError(t, err)
+			require.Equal(t, "127.0.0.2", host)
+		}
+
+		m.hostsAdmin["127.0.0.2"] = &rtcdHostAdminState{Removed: true}
+		_, err := m.GetHostForNewCall()
+		require.EqualError(t, err, "no host available")
+	})
 }
 
 func TestResolveURL(t *testing.T) {
@@ -174,3 +206,48 @@ func TestResolveURL(t *testing.T) {
 	require.Equal(t, "127.0.0.1", ips[0].String())
 	require.Equal(t, "8055", port)
 }
+
+func TestSetHostAdminState(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	m := &rtcdClientManager{
+		ctx:   p,
+		hosts: map[string]*rtcdHost{},
+	}
+	p.rtcdManager = m
+
+	require.NoError(t, p.kvSetAtomicRTCDHostsAdminState(func(states map[string]*rtcdHostAdminState) (bool, error) {
+		states["fd00::1"] = &rtcdHostAdminState{Cordoned: true, Draining: true, Removed: true}
+		return true, nil
+	}))
+	_, err := m.loadHostsAdminState()
+	require.NoError(t, err)
+
+	t.Run("invalid host", func(t *testing.T) {
+		api.On("HasPermissionTo", "adminID", model.PermissionManageSystem).Return(true).Once()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/rtcd/hosts/rtcd.local/uncordon", nil)
+		r.Header.Set("Mattermost-User-Id", "adminID")
+		p.handleRTCDHostAction(w, r, "rtcd.local", rtcdHostActionUncordon)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("uncordon removed host", func(t *testing.T) {
+		matches := rtcdHostActionRE.FindStringSubmatch("/rtcd/hosts/fd00:0::1/uncordon")
+		require.Len(t, matches, 3)
+
+		api.On("HasPermissionTo", "adminID", model.PermissionManageSystem).Return(true).Once()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/rtcd/hosts/fd00:0::1/uncordon", nil)
+		r.Header.Set("Mattermost-User-Id", "adminID")
+		p.handleRTCDHostAction(w, r, matches[1], matches[2])
+		require.Equal(t, http.StatusConflict, w.Code)
+		require.True(t, m.isRemoved("fd00::1"))
+	})
+
+	t.Run("restore removed host", func(t *testing.T) {
+		api.On("PublishPluginClusterEvent", mock.Anything, mock.Anything).Return(nil).Once()
+		require.NoError(t, m.setHostAdminState("fd00::1", rtcdHostActionRestore, "adminID"))
+		require.False(t, m.isRemoved("fd00::1"))
+		require.False(t, m.isCordoned("fd00::1"))
+	})
+}
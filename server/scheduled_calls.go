@@ -0,0 +1,782 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+var callScheduledRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)\/scheduled$`)
+var callScheduledIDRE = regexp.MustCompile(`^\/calls\/([a-z0-9]+)\/scheduled\/([a-z0-9]+)$`)
+
+var errForbidden = errors.New("forbidden")
+var errScheduledCallNotFound = errors.New("scheduled call not found")
+
+const (
+	// Scheduled calls are stored per channel. The job finds the ones to process
+	// through an index sharded by the UTC day they start on.
+	scheduledCallsKeyPrefix         = "scheduledcalls_"
+	scheduledCallsDueIndexKey       = "scheduledcalls_due_idx"
+	scheduledCallsDueShardKeyPrefix = "scheduledcalls_due_"
+	scheduledCallsDueShardLayout    = "20060102"
+	scheduledCallsJobKey            = "scheduled_calls_job"
+	scheduledCallsCheckInterval     = 30 * time.Second
+	scheduledCallExpiration         = time.Hour
+	// scheduledCallEarlyStart is how long before its start time a scheduled
+	// call can be started.
+	scheduledCallEarlyStart             = 15 * time.Minute
+	scheduledCallDefaultReminderMinutes = 10
+	scheduledCallMaxReminderMinutes     = 24 * 60
+	scheduledCallMaxTitleLength         = 256
+)
+
+type scheduledCall struct {
+	ID              string `json:"id"`
+	ChannelID       string `json:"channel_id"`
+	CreatorID       string `json:"creator_id"`
+	Title           string `json:"title"`
+	StartAt         int64  `json:"start_at"`
+	ReminderMinutes int    `json:"reminder_minutes"`
+	CreateAt        int64  `json:"create_at"`
+	// PostID is the id of the call post created alongside the reminder. It
+	// becomes the call thread when the first user joins.
+	PostID string `json:"post_id"`
+}
+
+type scheduledCallDueEntry struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	StartAt   int64  `json:"start_at"`
+}
+
+func (sc *scheduledCall) dueEntry() scheduledCallDueEntry {
+	return scheduledCallDueEntry{
+		ID:        sc.ID,
+		ChannelID: sc.ChannelID,
+		StartAt:   sc.StartAt,
+	}
+}
+
+func (sc *scheduledCall) IsValid(now time.Time) error {
+	if sc.StartAt <= now.UnixMilli() {
+		return fmt.Errorf("start time should be in the future")
+	}
+	if sc.ReminderMinutes < 0 || sc.ReminderMinutes > scheduledCallMaxReminderMinutes {
+		return fmt.Errorf("reminder minutes should be in the range [0, %d]", scheduledCallMaxReminderMinutes)
+	}
+	if len(sc.Title) > scheduledCallMaxTitleLength {
+		return fmt.Errorf("title is too long")
+	}
+	return nil
+}
+
+func (sc *scheduledCall) reminderDue(now time.Time) bool {
+	return sc.PostID == "" && now.UnixMilli() >= sc.StartAt-int64(sc.ReminderMinutes)*time.Minute.Milliseconds()
+}
+
+func (sc *scheduledCall) expired(now time.Time) bool {
+	return now.UnixMilli() > sc.StartAt+scheduledCallExpiration.Milliseconds()
+}
+
+// claimable returns whether a call started at the given time is the
+// scheduled one.
+func (sc *scheduledCall) claimable(now time.Time) bool {
+	return sc.PostID != "" && !sc.expired(now) &&
+		now.UnixMilli() >= sc.StartAt-scheduledCallEarlyStart.Milliseconds()
+}
+
+// scheduledCallReminderMessage returns the message of the reminder post with
+// the start time in the given location.
+func scheduledCallReminderMessage(displayName, title string, startAt int64, loc *time.Location) string {
+	startTime := time.UnixMilli(startAt).In(loc).Format("3:04PM MST")
+	if title != "" {
+		return fmt.Sprintf("%s scheduled %s starting at %s", displayName, title, startTime)
+	}
+	return fmt.Sprintf("%s scheduled a call starting at %s", displayName, startTime)
+}
+
+// parseScheduledCallTime parses the start time of a scheduled call. Supported
+// formats are a duration relative to now (e.g. 30m), a time of the day (e.g. 15:04)
+// which refers to its next occurrence, a local date and time (e.g. 2006-01-02T15:04)
+// and RFC3339.
+func parseScheduledCallTime(value string, now time.Time, loc *time.Location) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("duration should be positive")
+		}
+		return now.Add(d), nil
+	}
+
+	if t, err := time.ParseInLocation("15:04", value, loc); err == nil {
+		localNow := now.In(loc)
+		t = time.Date(localNow.Year(), localNow.Month(), localNow.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02T15:04", value, loc); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("failed to parse time %q", value)
+}
+
+func (p *Plugin) kvGetScheduledCalls(channelID string) (map[string]*scheduledCall, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(scheduledCallsKeyPrefix + channelID)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	calls := map[string]*scheduledCall{}
+	if data == nil {
+		return calls, nil
+	}
+	if err := json.Unmarshal(data, &calls); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+func (p *Plugin) kvSetAtomicScheduledCalls(channelID string, cb func(calls map[string]*scheduledCall) (bool, error)) error {
+	return p.kvSetAtomic(scheduledCallsKeyPrefix+channelID, func(data []byte) ([]byte, error) {
+		calls := map[string]*scheduledCall{}
+		if data != nil {
+			if err := json.Unmarshal(data, &calls); err != nil {
+				return nil, err
+			}
+		}
+		changed, err := cb(calls)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return nil, nil
+		}
+		return json.Marshal(calls)
+	})
+}
+
+func scheduledCallsDueShard(startAt int64) string {
+	return time.UnixMilli(startAt).UTC().Format(scheduledCallsDueShardLayout)
+}
+
+// filterScheduledCallsDueShards returns the shards that can hold calls
+// starting up to the given time, oldest first.
+func filterScheduledCallsDueShards(shards []string, until int64) []string {
+	filtered := make([]string, 0, len(shards))
+	for _, shard := range shards {
+		start, err := time.Parse(scheduledCallsDueShardLayout, shard)
+		if err != nil {
+			continue
+		}
+		if start.UnixMilli() > until {
+			continue
+		}
+		filtered = append(filtered, shard)
+	}
+
+	sort.Strings(filtered)
+
+	return filtered
+}
+
+func (p *Plugin) kvGetScheduledCallsDueShards() ([]string, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(scheduledCallsDueIndexKey)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var shards []string
+	if err := json.Unmarshal(data, &shards); err != nil {
+		return nil, err
+	}
+	return shards, nil
+}
+
+func (p *Plugin) kvGetScheduledCallsDueShard(shard string) ([]scheduledCallDueEntry, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(scheduledCallsDueShardKeyPrefix + shard)
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var entries []scheduledCallDueEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (p *Plugin) addScheduledCallDueEntry(entry scheduledCallDueEntry) error {
+	shard := scheduledCallsDueShard(entry.StartAt)
+
+	if err := p.kvSetAtomic(scheduledCallsDueShardKeyPrefix+shard, func(data []byte) ([]byte, error) {
+		var entries []scheduledCallDueEntry
+		if data != nil {
+			if err := json.Unmarshal(data, &entries); err != nil {
+				return nil, err
+			}
+		}
+		for _, e := range entries {
+			if e.ID == entry.ID {
+				return nil, nil
+			}
+		}
+		return json.Marshal(append(entries, entry))
+	}); err != nil {
+		return err
+	}
+
+	return p.kvSetAtomic(scheduledCallsDueIndexKey, func(data []byte) ([]byte, error) {
+		var shards []string
+		if data != nil {
+			if err := json.Unmarshal(data, &shards); err != nil {
+				return nil, err
+			}
+		}
+		for _, s := range shards {
+			if s == shard {
+				return nil, nil
+			}
+		}
+		return json.Marshal(append(shards, shard))
+	})
+}
+
+// removeScheduledCallDueEntry removes the entry from its shard. Emptied shards
+// are left in place and pruned by the job once their day is over, since new
+// calls can still be scheduled on them until then.
+func (p *Plugin) removeScheduledCallDueEntry(entry scheduledCallDueEntry) error {
+	return p.kvSetAtomic(scheduledCallsDueShardKeyPrefix+scheduledCallsDueShard(entry.StartAt), func(data []byte) ([]byte, error) {
+		if data == nil {
+			return nil, nil
+		}
+		var entries []scheduledCallDueEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+		for i, e := range entries {
+			if e.ID == entry.ID {
+				return json.Marshal(append(entries[:i], entries[i+1:]...))
+			}
+		}
+		return nil, nil
+	})
+}
+
+// pruneScheduledCallsDueShard drops the given shard if it's empty and its
+// calls can no longer be started.
+func (p *Plugin) pruneScheduledCallsDueShard(shard string, now time.Time) error {
+	start, err := time.Parse(scheduledCallsDueShardLayout, shard)
+	if err != nil || !now.After(start.AddDate(0, 0, 1).Add(scheduledCallExpiration)) {
+		return err
+	}
+
+	entries, err := p.kvGetScheduledCallsDueShard(shard)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+
+	if err := p.kvSetAtomic(scheduledCallsDueIndexKey, func(data []byte) ([]byte, error) {
+		if data == nil {
+			return nil, nil
+		}
+		var shards []string
+		if err := json.Unmarshal(data, &shards); err != nil {
+			return nil, err
+		}
+		for i, s := range shards {
+			if s == shard {
+				return json.Marshal(append(shards[:i], shards[i+1:]...))
+			}
+		}
+		return nil, nil
+	}); err != nil {
+		return err
+	}
+
+	p.metrics.IncStoreOp("KVDelete")
+	if appErr := p.API.KVDelete(scheduledCallsDueShardKeyPrefix + shard); appErr != nil {
+		return fmt.Errorf("KVDelete failed: %w", appErr)
+	}
+
+	return nil
+}
+
+func (p *Plugin) getScheduledCalls(channelID string) ([]*scheduledCall, error) {
+	calls, err := p.kvGetScheduledCalls(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*scheduledCall, 0, len(calls))
+	for _, sc := range calls {
+		list = append(list, sc)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartAt < list[j].StartAt
+	})
+
+	return list, nil
+}
+
+func (p *Plugin) canScheduleCall(userID, channelID string) (bool, error) {
+	if !p.API.HasPermissionToChannel(userID, channelID, model.PermissionCreatePost) {
+		return false, nil
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return false, appErr
+	}
+	if channel.DeleteAt > 0 {
+		return false, fmt.Errorf("cannot schedule call in archived channel")
+	}
+
+	state, err := p.kvGetChannelState(channelID)
+	if err != nil {
+		return false, err
+	}
+	if state == nil {
+		state = &channelState{}
+	}
+
+	return p.userCanStartOrJoin(userID, channelID, state), nil
+}
+
+func (p *Plugin) scheduleCall(userID, channelID, title string, startAt time.Time, reminderMinutes int) (*scheduledCall, error) {
+	if ok, err := p.canScheduleCall(userID, channelID); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errForbidden
+	}
+
+	sc := &scheduledCall{
+		ID:              model.NewId(),
+		ChannelID:       channelID,
+		CreatorID:       userID,
+		Title:           title,
+		StartAt:         startAt.UnixMilli(),
+		ReminderMinutes: reminderMinutes,
+		CreateAt:        time.Now().UnixMilli(),
+	}
+	if err := sc.IsValid(time.Now()); err != nil {
+		return nil, err
+	}
+
+	// The call is indexed first so that it can't be missed by the job. An entry
+	// left behind by a failed store is dropped when processed.
+	if err := p.addScheduledCallDueEntry(sc.dueEntry()); err != nil {
+		return nil, fmt.Errorf("failed to index scheduled call: %w", err)
+	}
+
+	if err := p.kvSetAtomicScheduledCalls(channelID, func(calls map[string]*scheduledCall) (bool, error) {
+		calls[sc.ID] = sc
+		return true, nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store scheduled call: %w", err)
+	}
+
+	return sc, nil
+}
+
+func (p *Plugin) cancelScheduledCall(userID, channelID, scheduledCallID string) (*scheduledCall, error) {
+	calls, err := p.kvGetScheduledCalls(channelID)
+	if err != nil {
+		return nil, err
+	}
+	sc := calls[scheduledCallID]
+	if sc == nil {
+		return nil, errScheduledCallNotFound
+	}
+
+	// The creator of a scheduled call never changes so permissions can be
+	// checked ahead of the update.
+	if sc.CreatorID != userID && !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		cm, appErr := p.API.GetChannelMember(channelID, userID)
+		if appErr != nil || !cm.SchemeAdmin {
+			return nil, errForbidden
+		}
+	}
+
+	var canceled *scheduledCall
+	if err := p.kvSetAtomicScheduledCalls(channelID, func(calls map[string]*scheduledCall) (bool, error) {
+		canceled = calls[scheduledCallID]
+		if canceled == nil {
+			return false, errScheduledCallNotFound
+		}
+		delete(calls, scheduledCallID)
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := p.removeScheduledCallDueEntry(canceled.dueEntry()); err != nil {
+		p.LogError("failed to remove scheduled call from index", "error", err.Error(), "scheduledCallID", canceled.ID)
+	}
+
+	if canceled.PostID != "" {
+		if appErr := p.API.DeletePost(canceled.PostID); appErr != nil {
+			p.LogError("failed to delete scheduled call post", "error", appErr.Error(), "postID", canceled.PostID)
+		}
+	}
+
+	return canceled, nil
+}
+
+// findScheduledCall returns the scheduled call for the given channel that a
+// call started at the given time corresponds to, if any.
+func (p *Plugin) findScheduledCall(channelID string, now time.Time) (*scheduledCall, error) {
+	calls, err := p.kvGetScheduledCalls(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *scheduledCall
+	for _, sc := range calls {
+		if !sc.claimable(now) {
+			continue
+		}
+		if found == nil || sc.StartAt < found.StartAt {
+			found = sc
+		}
+	}
+
+	return found, nil
+}
+
+// removeScheduledCall removes the scheduled call from the store, returning
+// whether it was still there.
+func (p *Plugin) removeScheduledCall(sc *scheduledCall) (bool, error) {
+	var removed bool
+	if err := p.kvSetAtomicScheduledCalls(sc.ChannelID, func(calls map[string]*scheduledCall) (bool, error) {
+		removed = calls[sc.ID] != nil
+		delete(calls, sc.ID)
+		return removed, nil
+	}); err != nil {
+		return false, err
+	}
+
+	if err := p.removeScheduledCallDueEntry(sc.dueEntry()); err != nil {
+		return removed, fmt.Errorf("failed to remove scheduled call from index: %w", err)
+	}
+
+	return removed, nil
+}
+
+// startScheduledCallPost turns the post pre-created for a scheduled call into
+// the post of the call that has just started. An empty post id is returned if
+// no scheduled call is pending in the channel.
+func (p *Plugin) startScheduledCallPost(userID, channelID string, startAt int64, title string) (string, string, error) {
+	sc, err := p.findScheduledCall(channelID, time.UnixMilli(startAt))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find scheduled call: %w", err)
+	}
+	if sc == nil {
+		return "", "", nil
+	}
+
+	post, appErr := p.API.GetPost(sc.PostID)
+	if appErr != nil {
+		return "", "", appErr
+	}
+
+	displayName, err := p.getUserDisplayName(userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if title == "" {
+		title = sc.Title
+	}
+
+	callPost := newCallPost(post.UserId, channelID, fmt.Sprintf("%s started a call", displayName), startAt, title, "")
+	post.Message = callPost.Message
+	for key, value := range callPost.Props {
+		post.AddProp(key, value)
+	}
+	post.AddProp("scheduled_call_id", sc.ID)
+	post.DelProp("scheduled_call_pending")
+
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		return "", "", appErr
+	}
+
+	// The scheduled call is only consumed once its post has been turned into
+	// the call's so that a failure leaves it available for the next attempt.
+	if _, err := p.removeScheduledCall(sc); err != nil {
+		return "", "", fmt.Errorf("failed to remove scheduled call: %w", err)
+	}
+
+	if err := p.setCallPost(channelID, post.Id, post.Id); err != nil {
+		return "", "", err
+	}
+
+	return post.Id, post.Id, nil
+}
+
+func (p *Plugin) sendScheduledCallReminder(sc *scheduledCall) error {
+	creator, appErr := p.API.GetUser(sc.CreatorID)
+	if appErr != nil {
+		return appErr
+	}
+
+	displayName, err := p.getUserDisplayName(sc.CreatorID)
+	if err != nil {
+		return err
+	}
+
+	// The start time is shown in the timezone of the user who scheduled the
+	// call, falling back to UTC.
+	loc, err := time.LoadLocation(model.GetPreferredTimezone(creator.Timezone))
+	if err != nil {
+		loc = time.UTC
+	}
+
+	postMsg := scheduledCallReminderMessage(displayName, sc.Title, sc.StartAt, loc)
+	post := newCallPost(p.getBotID(), sc.ChannelID, postMsg, sc.StartAt, sc.Title, "")
+	post.AddProp("scheduled_call_id", sc.ID)
+	// Lets clients render the post as a call that hasn't started yet.
+	post.AddProp("scheduled_call_pending", true)
+
+	createdPost, appErr := p.API.CreatePost(post)
+	if appErr != nil {
+		return appErr
+	}
+
+	var found bool
+	if err := p.kvSetAtomicScheduledCalls(sc.ChannelID, func(calls map[string]*scheduledCall) (bool, error) {
+		found = false
+		if calls[sc.ID] == nil {
+			return false, nil
+		}
+		found = true
+		calls[sc.ID].PostID = createdPost.Id
+		return true, nil
+	}); err != nil {
+		return err
+	}
+
+	// The scheduled call got canceled in the meantime.
+	if !found {
+		if appErr := p.API.DeletePost(createdPost.Id); appErr != nil {
+			return appErr
+		}
+	}
+
+	return nil
+}
+
+// updateScheduledCallPostExpired marks the post of a scheduled call nobody
+// joined as expired.
+func (p *Plugin) updateScheduledCallPostExpired(postID string) error {
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return appErr
+	}
+
+	postMsg := "Scheduled call was not started"
+	slackAttachment := model.SlackAttachment{
+		Fallback: postMsg,
+		Title:    postMsg,
+		Text:     postMsg,
+	}
+
+	post.Message = postMsg
+	post.DelProp("attachments")
+	post.AddProp("attachments", []*model.SlackAttachment{&slackAttachment})
+	post.AddProp("end_at", time.Now().UnixMilli())
+	post.AddProp("scheduled_call_expired", true)
+	post.DelProp("scheduled_call_pending")
+
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		return appErr
+	}
+
+	return nil
+}
+
+func (p *Plugin) expireScheduledCall(sc *scheduledCall) error {
+	removed, err := p.removeScheduledCall(sc)
+	if err != nil {
+		return err
+	}
+
+	if removed && sc.PostID != "" {
+		return p.updateScheduledCallPostExpired(sc.PostID)
+	}
+
+	return nil
+}
+
+// processScheduledCalls is periodically run by a cluster job to send reminders
+// for upcoming calls and expire the ones nobody joined.
+func (p *Plugin) processScheduledCalls() {
+	shards, err := p.kvGetScheduledCallsDueShards()
+	if err != nil {
+		p.LogError("failed to get scheduled calls shards", "error", err.Error())
+		return
+	}
+
+	now := time.Now()
+	// Reminders can't be sent earlier than this before the start of a call.
+	until := now.Add(scheduledCallMaxReminderMinutes * time.Minute)
+	channelCalls := map[string]map[string]*scheduledCall{}
+	for _, shard := range filterScheduledCallsDueShards(shards, until.UnixMilli()) {
+		entries, err := p.kvGetScheduledCallsDueShard(shard)
+		if err != nil {
+			p.LogError("failed to get scheduled calls shard", "error", err.Error(), "shard", shard)
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.StartAt > until.UnixMilli() {
+				continue
+			}
+
+			calls := channelCalls[entry.ChannelID]
+			if calls == nil {
+				calls, err = p.kvGetScheduledCalls(entry.ChannelID)
+				if err != nil {
+					p.LogError("failed to get scheduled calls", "error", err.Error(), "channelID", entry.ChannelID)
+					continue
+				}
+				channelCalls[entry.ChannelID] = calls
+			}
+
+			sc := calls[entry.ID]
+			if sc == nil {
+				// The call was consumed without its entry being removed.
+				if err := p.removeScheduledCallDueEntry(entry); err != nil {
+					p.LogError("failed to remove scheduled call from index", "error", err.Error(), "scheduledCallID", entry.ID)
+				}
+				continue
+			}
+
+			p.processScheduledCall(sc, now)
+		}
+
+		if err := p.pruneScheduledCallsDueShard(shard, now); err != nil {
+			p.LogError("failed to prune scheduled calls shard", "error", err.Error(), "shard", shard)
+		}
+	}
+}
+
+func (p *Plugin) processScheduledCall(sc *scheduledCall, now time.Time) {
+	if sc.expired(now) {
+		p.LogDebug("scheduled call expired", "scheduledCallID", sc.ID, "channelID", sc.ChannelID)
+		if err := p.expireScheduledCall(sc); err != nil {
+			p.LogError("failed to expire scheduled call", "error", err.Error(), "scheduledCallID", sc.ID)
+		}
+		return
+	}
+
+	if sc.reminderDue(now) {
+		p.LogDebug("sending scheduled call reminder", "scheduledCallID", sc.ID, "channelID", sc.ChannelID)
+		if err := p.sendScheduledCallReminder(sc); err != nil {
+			p.LogError("failed to send scheduled call reminder", "error", err.Error(), "scheduledCallID", sc.ID)
+		}
+	}
+}
+
+func (p *Plugin) handleGetScheduledCalls(w http.ResponseWriter, r *http.Request, channelID string) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if !p.API.HasPermissionToChannel(userID, channelID, model.PermissionReadChannel) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	calls, err := p.getScheduledCalls(channelID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(calls); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+func (p *Plugin) handlePostScheduledCall(w http.ResponseWriter, r *http.Request, channelID string) {
+	var res httpResponse
+	defer p.httpAudit("handlePostScheduledCall", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	var info struct {
+		Title           string `json:"title"`
+		StartAt         int64  `json:"start_at"`
+		ReminderMinutes *int   `json:"reminder_minutes"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, requestBodyMaxSizeBytes)).Decode(&info); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		return
+	}
+
+	reminderMinutes := scheduledCallDefaultReminderMinutes
+	if info.ReminderMinutes != nil {
+		reminderMinutes = *info.ReminderMinutes
+	}
+
+	sc, err := p.scheduleCall(userID, channelID, info.Title, time.UnixMilli(info.StartAt), reminderMinutes)
+	if err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		if errors.Is(err, errForbidden) {
+			res.Code = http.StatusForbidden
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(sc); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+func (p *Plugin) handleDeleteScheduledCall(w http.ResponseWriter, r *http.Request, channelID, scheduledCallID string) {
+	var res httpResponse
+	defer p.httpAudit("handleDeleteScheduledCall", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	if _, err := p.cancelScheduledCall(userID, channelID, scheduledCallID); err != nil {
+		res.Err = err.Error()
+		res.Code = http.StatusBadRequest
+		if errors.Is(err, errForbidden) {
+			res.Code = http.StatusForbidden
+		} else if errors.Is(err, errScheduledCallNotFound) {
+			res.Code = http.StatusNotFound
+		}
+		return
+	}
+
+	res.Code = http.StatusOK
+	res.Msg = "success"
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScheduledCallTime(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Rome")
+	require.NoError(t, err)
+	now := time.Date(2023, 1, 10, 14, 30, 0, 0, loc)
+
+	tcs := []struct {
+		name     string
+		input    string
+		expected time.Time
+		err      string
+	}{
+		{
+			name:     "duration",
+			input:    "45m",
+			expected: now.Add(45 * time.Minute),
+		},
+		{
+			name:  "negative duration",
+			input: "-45m",
+			err:   "duration should be positive",
+		},
+		{
+			name:     "time of the day, later today",
+			input:    "16:00",
+			expected: time.Date(2023, 1, 10, 16, 0, 0, 0, loc),
+		},
+		{
+			name:     "time of the day, tomorrow",
+			input:    "09:15",
+			expected: time.Date(2023, 1, 11, 9, 15, 0, 0, loc),
+		},
+		{
+			name:     "local date",
+			input:    "2023-02-01T10:00",
+			expected: time.Date(2023, 2, 1, 10, 0, 0, 0, loc),
+		},
+		{
+			name:     "RFC3339",
+			input:    "2023-02-01T10:00:00Z",
+			expected: time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "invalid",
+			input: "tomorrow",
+			err:   `failed to parse time "tomorrow"`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, err := parseScheduledCallTime(tc.input, now, loc)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, tc.expected.Equal(ts), "expected %s, got %s", tc.expected, ts)
+		})
+	}
+}
+
+func TestScheduledCallIsValid(t *testing.T) {
+	now := time.Now()
+
+	sc := scheduledCall{
+		StartAt:         now.Add(time.Hour).UnixMilli(),
+		ReminderMinutes: scheduledCallDefaultReminderMinutes,
+	}
+	require.NoError(t, sc.IsValid(now))
+
+	sc.StartAt = now.Add(-time.Minute).UnixMilli()
+	require.EqualError(t, sc.IsValid(now), "start time should be in the future")
+
+	sc.StartAt = now.Add(time.Hour).UnixMilli()
+	sc.ReminderMinutes = -1
+	require.Error(t, sc.IsValid(now))
+}
+
+func TestScheduledCallReminderDue(t *testing.T) {
+	startAt := time.Now().Add(time.Hour)
+	sc := scheduledCall{
+		StartAt:         startAt.UnixMilli(),
+		ReminderMinutes: 10,
+	}
+
+	require.False(t, sc.reminderDue(startAt.Add(-11*time.Minute)))
+	require.True(t, sc.reminderDue(startAt.Add(-10*time.Minute)))
+	require.True(t, sc.reminderDue(startAt))
+
+	sc.PostID = "postID"
+	require.False(t, sc.reminderDue(startAt))
+
+	require.False(t, sc.expired(startAt))
+	require.True(t, sc.expired(startAt.Add(scheduledCallExpiration+time.Second)))
+}
+
+func TestScheduledCallClaimable(t *testing.T) {
+	startAt := time.Now().Add(time.Hour)
+	sc := scheduledCall{
+		StartAt:         startAt.UnixMilli(),
+		ReminderMinutes: 30,
+	}
+
+	// The reminder post has not been created yet.
+	require.False(t, sc.claimable(startAt))
+
+	sc.PostID = "postID"
+	require.False(t, sc.claimable(startAt.Add(-scheduledCallEarlyStart-time.Second)))
+	require.True(t, sc.claimable(startAt.Add(-scheduledCallEarlyStart)))
+	require.True(t, sc.claimable(startAt))
+	require.True(t, sc.claimable(startAt.Add(scheduledCallExpiration)))
+	require.False(t, sc.claimable(startAt.Add(scheduledCallExpiration+time.Second)))
+}
+
+func TestScheduledCallReminderMessage(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Rome")
+	require.NoError(t, err)
+	startAt := time.Date(2026, time.October, 17, 15, 30, 0, 0, loc).UnixMilli()
+
+	require.Equal(t, "alice scheduled a call starting at 3:30PM CEST", scheduledCallReminderMessage("alice", "", startAt, loc))
+	require.Equal(t, "alice scheduled Standup starting at 1:30PM UTC", scheduledCallReminderMessage("alice", "Standup", startAt, time.UTC))
+}
+
+func TestStartScheduledCallPost(t *testing.T) {
+	startAt := time.Now().Add(2 * time.Hour)
+	sc := &scheduledCall{
+		ID:              "scID",
+		ChannelID:       "channelID",
+		CreatorID:       "creatorID",
+		StartAt:         startAt.UnixMilli(),
+		ReminderMinutes: 24 * 60,
+		PostID:          "postID",
+	}
+
+	setup := func(t *testing.T) (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t)
+		require.NoError(t, p.kvSetAtomicScheduledCalls(sc.ChannelID, func(calls map[string]*scheduledCall) (bool, error) {
+			calls[sc.ID] = sc
+			return true, nil
+		}))
+		return p, api
+	}
+
+	t.Run("unrelated call", func(t *testing.T) {
+		p, _ := setup(t)
+
+		// A call started long before the scheduled time doesn't claim its post.
+		postID, threadID, err := p.startScheduledCallPost("userID", "channelID", time.Now().UnixMilli(), "")
+		require.NoError(t, err)
+		require.Empty(t, postID)
+		require.Empty(t, threadID)
+
+		calls, err := p.kvGetScheduledCalls(sc.ChannelID)
+		require.NoError(t, err)
+		require.Contains(t, calls, sc.ID)
+	})
+
+	t.Run("update failure", func(t *testing.T) {
+		p, api := setup(t)
+
+		api.On("GetPost", "postID").Return(&model.Post{Id: "postID", ChannelId: "channelID"}, nil)
+		api.On("GetUser", "userID").Return(&model.User{Id: "userID", Username: "alice"}, nil)
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(nil, model.NewAppError("UpdatePost", "error", nil, "", 500))
+
+		_, _, err := p.startScheduledCallPost("userID", "channelID", startAt.UnixMilli(), "")
+		require.Error(t, err)
+
+		// The scheduled call is kept so that it can be claimed again.
+		calls, err := p.kvGetScheduledCalls(sc.ChannelID)
+		require.NoError(t, err)
+		require.Contains(t, calls, sc.ID)
+	})
+}
+
+func TestExpireScheduledCall(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	sc := &scheduledCall{
+		ID:        "scID",
+		ChannelID: "channelID",
+		PostID:    "postID",
+	}
+	require.NoError(t, p.kvSetAtomicScheduledCalls(sc.ChannelID, func(calls map[string]*scheduledCall) (bool, error) {
+		calls[sc.ID] = sc
+		return true, nil
+	}))
+
+	api.On("GetPost", "postID").Return(&model.Post{Id: "postID", ChannelId: "channelID"}, nil)
+	api.On("UpdatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.Message == "Scheduled call was not started" &&
+			post.GetProp("scheduled_call_expired") == true &&
+			post.GetProp("end_at") != nil
+	})).Return(&model.Post{}, nil).Once()
+
+	require.NoError(t, p.expireScheduledCall(sc))
+
+	calls, err := p.kvGetScheduledCalls(sc.ChannelID)
+	require.NoError(t, err)
+	require.Empty(t, calls)
+
+	// Expiring again is a no-op.
+	require.NoError(t, p.expireScheduledCall(sc))
+}
+
+func TestFilterScheduledCallsDueShards(t *testing.T) {
+	until := time.Date(2023, 1, 10, 14, 30, 0, 0, time.UTC).UnixMilli()
+	shards := []string{"20230111", "20230110", "20230109", "invalid"}
+	require.Equal(t, []string{"20230109", "20230110"}, filterScheduledCallsDueShards(shards, until))
+}
+
+func TestProcessScheduledCalls(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	now := time.Now()
+	expired := &scheduledCall{
+		ID:        "expiredID",
+		ChannelID: "channelA",
+		StartAt:   now.Add(-48 * time.Hour).UnixMilli(),
+		PostID:    "postID",
+	}
+	upcoming := &scheduledCall{
+		ID:              "upcomingID",
+		ChannelID:       "channelB",
+		StartAt:         now.Add(72 * time.Hour).UnixMilli(),
+		ReminderMinutes: scheduledCallDefaultReminderMinutes,
+	}
+	for _, sc := range []*scheduledCall{expired, upcoming} {
+		sc := sc
+		require.NoError(t, p.addScheduledCallDueEntry(sc.dueEntry()))
+		require.NoError(t, p.kvSetAtomicScheduledCalls(sc.ChannelID, func(calls map[string]*scheduledCall) (bool, error) {
+			calls[sc.ID] = sc
+			return true, nil
+		}))
+	}
+	// An entry for a call that is no longer stored.
+	stale := scheduledCallDueEntry{ID: "staleID", ChannelID: "channelA", StartAt: now.Add(-time.Minute).UnixMilli()}
+	require.NoError(t, p.addScheduledCallDueEntry(stale))
+
+	api.On("GetPost", "postID").Return(&model.Post{Id: "postID", ChannelId: "channelA"}, nil)
+	api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil).Once()
+
+	p.processScheduledCalls()
+	api.AssertExpectations(t)
+
+	calls, err := p.kvGetScheduledCalls("channelA")
+	require.NoError(t, err)
+	require.Empty(t, calls)
+
+	entries, err := p.kvGetScheduledCallsDueShard(scheduledCallsDueShard(stale.StartAt))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// The shard of the expired call is gone, the upcoming one is left untouched.
+	shards, err := p.kvGetScheduledCallsDueShards()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{scheduledCallsDueShard(stale.StartAt), scheduledCallsDueShard(upcoming.StartAt)}, shards)
+
+	calls, err = p.kvGetScheduledCalls("channelB")
+	require.NoError(t, err)
+	require.Contains(t, calls, upcoming.ID)
+}
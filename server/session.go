@@ -6,6 +6,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -42,12 +43,20 @@ type session struct {
 	// rtc indicates whether or not the session is also handling the WebRTC
 	// connection.
 	rtc bool
+	// rtcd indicates whether the media of the call is hosted on rtcd. It's
+	// set when joining so that signaling doesn't need to look up the call state.
+	rtcd bool
 
 	// to notify of session leaving a call.
 	leaveCh chan struct{}
 	left    int32
 
 	limiter *rate.Limiter
+
+	// mut protects the fields below.
+	mut sync.Mutex
+	// quality aggregates the stats sent by the client.
+	quality callQualitySummary
 }
 
 func newUserSession(userID, channelID, connID string, rtc bool) *session {
@@ -70,37 +79,32 @@ func newUserSession(userID, channelID, connID string, rtc bool) *session {
 func (p *Plugin) addUserSession(userID, connID string, channel *model.Channel) (channelState, channelState, error) {
 	var currState channelState
 	var prevState channelState
+	var inLobby bool
+	var rtc rtcAssignment
 
 	botID := p.getBotID()
 
-	err := p.kvSetAtomicChannelState(channel.Id, func(state *channelState) (*channelState, error) {
+	// Whether the user is an admin only matters when lobby mode is on. It's
+	// then resolved outside of the atomic update, which is attempted again.
+	var isAdmin *bool
+
+	update := func(state *channelState) (*channelState, error) {
+		rtc = rtcAssignment{}
+
 		if state == nil {
 			state = &channelState{}
 		}
 
-		if !p.userCanStartOrJoin(userID, state) {
+		if !p.userCanStartOrJoin(userID, channel.Id, state) {
 			return nil, fmt.Errorf("calls are not enabled")
 		}
 
 		prevState = *state.Clone()
 
 		if state.Call == nil {
-			state.Call = &callState{
-				ID:       model.NewId(),
-				StartAt:  time.Now().UnixMilli(),
-				Users:    make(map[string]*userState),
-				Sessions: make(map[string]struct{}),
-				OwnerID:  userID,
-			}
-			state.NodeID = p.nodeID
-
-			if p.rtcdManager != nil {
-				host, err := p.rtcdManager.GetHostForNewCall()
-				if err != nil {
-					return nil, fmt.Errorf("failed to get rtcd host: %w", err)
-				}
-				p.LogDebug("rtcd host has been assigned to call", "host", host)
-				state.Call.RTCDHost = host
+			var err error
+			if rtc, err = p.initCall(state, channel, userID); err != nil {
+				return nil, err
 			}
 		}
 
@@ -112,6 +116,28 @@ func (p *Plugin) addUserSession(userID, connID string, channel *model.Channel) (
 			return nil, fmt.Errorf("user is already connected")
 		}
 
+		if _, ok := state.Call.Removed[userID]; ok {
+			return nil, errUserRemoved
+		}
+
+		// Users waiting to be admitted are parked in the pending state until
+		// the host lets them in.
+		inLobby = false
+		if p.mustWaitInLobby(userID, state) {
+			if isAdmin == nil {
+				return nil, errLobbyAdminUnresolved
+			}
+			inLobby = !*isAdmin
+		}
+		if inLobby {
+			if state.Call.Pending == nil {
+				state.Call.Pending = make(map[string]*lobbyUserState)
+			}
+			state.Call.Pending[userID] = newLobbyUserState(connID)
+			currState = *state
+			return state, nil
+		}
+
 		// Check for cloud limits -- needs to be done here to prevent a race condition
 		if allowed, err := p.joinAllowed(state); !allowed {
 			if err != nil {
@@ -125,7 +151,10 @@ func (p *Plugin) addUserSession(userID, connID string, channel *model.Channel) (
 			if state.Call.Recording != nil && state.Call.Recording.StartAt == 0 {
 				state.Call.Recording.StartAt = time.Now().UnixMilli()
 				state.Call.Recording.BotConnID = connID
-			} else if state.Call.Recording == nil || state.Call.Recording.StartAt > 0 {
+			} else if rec := state.Call.Recording; rec != nil && rec.Retries > 0 && rec.BotConnID == "" && rec.EndAt == 0 {
+				// The recorder is joining again after its job got restarted.
+				rec.BotConnID = connID
+			} else {
 				// In this case we should fail to prevent the bot from recording
 				// without consent.
 				return nil, fmt.Errorf("recording not in progress or already started")
@@ -136,22 +165,97 @@ func (p *Plugin) addUserSession(userID, connID string, channel *model.Channel) (
 			state.Call.HostID = userID
 		}
 
+		// An explicitly assigned host gets the role back when rejoining.
+		if state.Call.AssignedHostID != "" && state.Call.AssignedHostID == userID {
+			state.Call.HostID = userID
+		}
+
 		state.Call.Users[userID] = &userState{
 			JoinAt: time.Now().UnixMilli(),
+			ConnID: connID,
 		}
 		state.Call.Sessions[connID] = struct{}{}
+		delete(state.Call.Pending, userID)
+		delete(state.Call.Ringing, userID)
 		if len(state.Call.Users) > state.Call.Stats.Participants {
 			state.Call.Stats.Participants = len(state.Call.Users)
 		}
 
 		currState = *state
 		return state, nil
-	})
+	}
+
+	err := p.kvSetAtomicChannelState(channel.Id, update)
+	if errors.Is(err, errLobbyAdminUnresolved) {
+		admin := p.isChannelAdmin(userID, channel.Id)
+		isAdmin = &admin
+		err = p.kvSetAtomicChannelState(channel.Id, update)
+	}
+
+	if err == nil {
+		p.recordRTCAssignment(rtc)
+	}
+
+	if err == nil && inLobby {
+		return currState, prevState, errUserInLobby
+	}
 
 	return currState, prevState, err
 }
 
-func (p *Plugin) userCanStartOrJoin(userID string, state *channelState) bool {
+// rtcAssignment describes how the RTC backend for a new call was picked.
+type rtcAssignment struct {
+	rtcdHost string
+	rtcdPool string
+	fellBack bool
+}
+
+// initCall creates a new call in the given channel state, assigning it an RTC
+// backend.
+func (p *Plugin) initCall(state *channelState, channel *model.Channel, ownerID string) (rtcAssignment, error) {
+	var rtc rtcAssignment
+
+	state.Call = &callState{
+		ID:       model.NewId(),
+		StartAt:  time.Now().UnixMilli(),
+		Users:    make(map[string]*userState),
+		Sessions: make(map[string]struct{}),
+		OwnerID:  ownerID,
+	}
+	state.NodeID = p.nodeID
+
+	state.Call.RTCBackend = rtcBackendEmbedded
+
+	if p.rtcdManager != nil {
+		m := p.getRTCDManagerForChannel(channel)
+		host, err := m.GetHostForNewCall()
+		if err == nil {
+			p.LogDebug("rtcd host has been assigned to call", "host", host, "pool", m.pool)
+			state.Call.RTCDHost = host
+			state.Call.RTCDPool = m.pool
+			state.Call.RTCBackend = rtcBackendRTCD
+			rtc.rtcdHost, rtc.rtcdPool = host, m.pool
+		} else if p.getConfiguration().rtcdFallbackEnabled() && p.rtcServer != nil {
+			p.LogWarn("no rtcd host available, falling back to embedded RTC server", "pool", m.pool, "err", err.Error())
+			rtc.fellBack = true
+		} else {
+			return rtc, fmt.Errorf("failed to get rtcd host: %w", err)
+		}
+	}
+
+	return rtc, nil
+}
+
+func (p *Plugin) recordRTCAssignment(rtc rtcAssignment) {
+	if rtc.fellBack {
+		p.metrics.IncRTCDFallback()
+	}
+	if rtc.rtcdHost != "" {
+		p.metrics.IncRTCDHostSelection(rtc.rtcdPool, rtc.rtcdHost)
+	}
+}
+
+func (p *Plugin) userCanStartOrJoin(userID, channelID string, state *channelState) bool {
 	// If there is an ongoing call, we can let anyone join.
 	// If calls are disabled, no-one can start or join.
 	// If explicitly enabled, everyone can start or join.
@@ -170,6 +274,10 @@ func (p *Plugin) userCanStartOrJoin(userID string, state *channelState) bool {
 	if explicitlyDisabled {
 		return false
 	}
+	// The channel policy can restrict starting calls to channel admins.
+	if !p.canStartCall(userID, channelID, state.Policy) {
+		return false
+	}
 	if explicitlyEnabled {
 		return true
 	}
@@ -222,6 +330,9 @@ func (p *Plugin) removeUserSession(userID, connID, channelID string) (channelSta
 		// something has failed or the max duration timeout triggered.
 		if state.Call.Recording != nil && state.Call.Recording.EndAt == 0 && connID == state.Call.Recording.BotConnID {
 			state.Call.Recording.EndAt = time.Now().UnixMilli()
+			if state.Call.Recording.isPaused() {
+				_ = state.Call.Recording.resume(state.Call.Recording.EndAt)
+			}
 		}
 
 		if len(state.Call.Users) == 0 {
@@ -260,8 +371,12 @@ func (p *Plugin) joinAllowed(state *channelState) (bool, error) {
 	// On-prem, Cloud Professional & Cloud Enterprise (incl. trial): DMs 1-1, GMs and Channel calls
 	// limited to cfg.cloudPaidMaxParticipantsDefault people.
 	// This is set in the override defaults, so MaxCallParticipants will be accurate for the current license.
-	if cfg := p.getConfiguration(); cfg != nil && cfg.MaxCallParticipants != nil &&
-		*cfg.MaxCallParticipants != 0 && len(state.Call.Users) >= *cfg.MaxCallParticipants {
+	// The channel policy can lower this limit further.
+	var globalMax int
+	if cfg := p.getConfiguration(); cfg != nil && cfg.MaxCallParticipants != nil {
+		globalMax = *cfg.MaxCallParticipants
+	}
+	if maxParticipants := state.Policy.maxParticipants(globalMax); maxParticipants != 0 && len(state.Call.Users) >= maxParticipants {
 		return false, nil
 	}
 	return true, nil
@@ -283,6 +398,16 @@ func (p *Plugin) removeSession(us *session) error {
 	// multiple times but we should send out the ws event only once.
 	if prevState.Call != nil && prevState.Call.Users[us.userID] != nil && (currState.Call == nil || currState.Call.Users[us.userID] == nil) {
 		p.LogDebug("session was removed from state", "userID", us.userID, "connID", us.connID, "originalConnID", us.originalConnID)
+		us.mut.Lock()
+		quality := us.quality
+		us.mut.Unlock()
+		p.setCallHistoryParticipantLeft(us.channelID, prevState.Call.ID, us.userID, us.originalConnID, quality)
+		p.audit(auditEventParticipantLeft, us.channelID, prevState.Call.ID, us.userID, map[string]interface{}{
+			"session_id": us.originalConnID,
+		})
+		p.publishCallEvent(webhookEventParticipantLeft, us.channelID, prevState.Call.ID, us.userID, map[string]interface{}{
+			"session_id": us.originalConnID,
+		})
 		p.publishWebSocketEvent(wsEventUserDisconnected, map[string]interface{}{
 			"userID": us.userID,
 		}, &model.WebsocketBroadcast{ChannelId: us.channelID, ReliableClusterSend: true})
@@ -299,24 +424,51 @@ func (p *Plugin) removeSession(us *session) error {
 		p.publishWebSocketEvent(wsEventCallHostChanged, map[string]interface{}{
 			"hostID": currState.Call.HostID,
 		}, &model.WebsocketBroadcast{ChannelId: us.channelID, ReliableClusterSend: true})
+		p.addCallHistoryHostChange(us.channelID, currState.Call.ID, currState.Call.HostID)
+		p.notifyLobbyHost(us.channelID, currState.Call)
+		p.audit(auditEventHostChanged, us.channelID, currState.Call.ID, us.userID, map[string]interface{}{
+			"host_id":      currState.Call.HostID,
+			"prev_host_id": prevState.Call.HostID,
+		})
 	}
 
 	// Checking if the recording has ended due to the bot leaving.
 	if prevState.Call != nil && prevState.Call.Recording != nil && currState.Call != nil && currState.Call.Recording != nil &&
 		currState.Call.Recording.EndAt > prevState.Call.Recording.EndAt {
 
-		p.LogDebug("recording bot left the call, attempting to stop job", "channelID", us.channelID, "jobID", currState.Call.Recording.JobID)
+		rec := currState.Call.Recording
+		maxDuration := time.Duration(*p.getConfiguration().MaxRecordingDuration) * time.Minute
+		if recordingShouldRestart(rec, time.Now(), maxDuration) {
+			p.LogWarn("recording bot left the call unexpectedly, restarting job", "channelID", us.channelID, "jobID", rec.JobID)
+			p.metrics.IncRecordingJob(recordingJobStatusFailed)
+			go p.restartRecordingJob(us.channelID, rec.ID, rec.JobID)
+		} else {
+			// Not restarting means either the maximum duration was reached or
+			// the job kept failing.
+			if rec.StartAt > 0 && rec.Err == "" && rec.Retries < recordingJobMaxRetries {
+				p.metrics.IncRecordingJob(recordingJobStatusCompleted)
+			} else {
+				p.metrics.IncRecordingJob(recordingJobStatusFailed)
+			}
 
-		// We still want to try to stop the recording in case the bot session disconnected without
-		// actually exiting the job.
-		if err := p.jobService.StopJob(currState.Call.Recording.JobID); err != nil {
-			p.LogError("failed to stop recording job", "error", err.Error(), "channelID", us.channelID, "jobID", currState.Call.Recording.JobID)
-		}
+			p.LogDebug("recording bot left the call, attempting to stop job", "channelID", us.channelID, "jobID", rec.JobID)
 
-		p.publishWebSocketEvent(wsEventCallRecordingState, map[string]interface{}{
-			"callID":   us.channelID,
-			"recState": currState.Call.Recording.getClientState().toMap(),
-		}, &model.WebsocketBroadcast{ChannelId: us.channelID, ReliableClusterSend: true})
+			// We still want to try to stop the recording in case the bot session disconnected without
+			// actually exiting the job.
+			if err := p.jobService.StopJob(rec.JobID); err != nil {
+				p.LogError("failed to stop recording job", "error", err.Error(), "channelID", us.channelID, "jobID", rec.JobID)
+			}
+
+			p.publishWebSocketEvent(wsEventCallRecordingState, map[string]interface{}{
+				"callID":   us.channelID,
+				"recState": rec.getClientState().toMap(),
+			}, &model.WebsocketBroadcast{ChannelId: us.channelID, ReliableClusterSend: true})
+			p.setCallHistoryRecording(us.channelID, currState.Call.ID, rec)
+			p.audit(auditEventRecordingStopped, us.channelID, currState.Call.ID, "", map[string]interface{}{
+				"recording_id": rec.ID,
+				"job_id":       rec.JobID,
+			})
+		}
 	}
 
 	// If the bot is the only user left in the call we automatically stop the recording.
@@ -329,17 +481,7 @@ func (p *Plugin) removeSession(us *session) error {
 
 	// Check if call has ended.
 	if prevState.Call != nil && currState.Call == nil {
-		dur, err := p.updateCallPostEnded(prevState.Call.PostID)
-		if err != nil {
-			return err
-		}
-		p.track(evCallEnded, map[string]interface{}{
-			"ChannelID":      us.channelID,
-			"CallID":         prevState.Call.ID,
-			"Duration":       dur,
-			"Participants":   prevState.Call.Stats.Participants,
-			"ScreenDuration": prevState.Call.Stats.ScreenDuration,
-		})
+		p.onCallEnded(us.channelID, prevState.Call, prevState.NodeID, us.userID, callEndReasonLeft)
 	}
 	return nil
 }
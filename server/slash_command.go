@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/mattermost/mattermost-server/v6/plugin"
@@ -24,6 +25,9 @@ const (
 	statsCommandTrigger        = "stats"
 	endCommandTrigger          = "end"
 	recordingCommandTrigger    = "recording"
+	scheduleCommandTrigger     = "schedule"
+	hostCommandTrigger         = "host"
+	inviteCommandTrigger       = "invite"
 )
 
 var subCommands = []string{
@@ -35,6 +39,9 @@ var subCommands = []string{
 	endCommandTrigger,
 	statsCommandTrigger,
 	recordingCommandTrigger,
+	scheduleCommandTrigger,
+	hostCommandTrigger,
+	inviteCommandTrigger,
 }
 
 func getAutocompleteData() *model.AutocompleteData {
@@ -57,6 +64,19 @@ func getAutocompleteData() *model.AutocompleteData {
 	recordingCmdData.AddTextArgument("Available options: start, stop", "", "start|stop")
 	data.AddCommand(recordingCmdData)
 
+	scheduleCmdData := model.NewAutocompleteData(scheduleCommandTrigger, "", "Schedule a call in the current channel")
+	scheduleCmdData.AddTextArgument("Start time: a duration (30m), a time of the day (15:04) or a date (2006-01-02T15:04)", "[time]", "")
+	scheduleCmdData.AddTextArgument("Title for the call", "[title]", "")
+	data.AddCommand(scheduleCmdData)
+
+	hostCmdData := model.NewAutocompleteData(hostCommandTrigger, "", "Make another participant the host of the call")
+	hostCmdData.AddTextArgument("Participant to assign as host", "[@username]", "")
+	data.AddCommand(hostCmdData)
+
+	inviteCmdData := model.NewAutocompleteData(inviteCommandTrigger, "", "Invite users to join the call in the current channel")
+	inviteCmdData.AddTextArgument("Users to invite", "[@username...]", "")
+	data.AddCommand(inviteCmdData)
+
 	return data
 }
 
@@ -93,7 +113,7 @@ func (p *Plugin) handleLinkCommand(args *model.CommandArgs) (*model.CommandRespo
 		return nil, appErr
 	}
 
-	link := fmt.Sprintf("%s/%s/channels/%s?join_call=true", args.SiteURL, team.Name, channel.Id)
+	link := callLink(args.SiteURL, team.Name, channel.Id)
 
 	return &model.CommandResponse{
 		ResponseType: model.CommandResponseTypeEphemeral,
@@ -165,6 +185,90 @@ func (p *Plugin) handleRecordingCommand(args *model.CommandArgs, fields []string
 	return &model.CommandResponse{}, nil
 }
 
+func (p *Plugin) handleScheduleCommand(args *model.CommandArgs, fields []string) (*model.CommandResponse, error) {
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("Invalid number of arguments provided")
+	}
+
+	user, appErr := p.API.GetUser(args.UserId)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	loc, err := time.LoadLocation(model.GetPreferredTimezone(user.Timezone))
+	if err != nil {
+		loc = time.UTC
+	}
+
+	startAt, err := parseScheduledCallTime(fields[2], time.Now(), loc)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid start time: %w", err)
+	}
+
+	title := strings.Join(fields[3:], " ")
+
+	sc, err := p.scheduleCall(args.UserId, args.ChannelId, title, startAt, scheduledCallDefaultReminderMinutes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to schedule call: %w", err)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text: fmt.Sprintf("Call scheduled for %s. A reminder will be posted %d minutes before it starts.",
+			time.UnixMilli(sc.StartAt).In(loc).Format("Mon Jan 2 3:04PM MST"), sc.ReminderMinutes),
+	}, nil
+}
+
+func (p *Plugin) handleHostCommand(args *model.CommandArgs, fields []string) (*model.CommandResponse, error) {
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("Invalid number of arguments provided")
+	}
+
+	user, appErr := p.API.GetUserByUsername(strings.TrimPrefix(fields[2], "@"))
+	if appErr != nil {
+		return nil, fmt.Errorf("User %s not found", fields[2])
+	}
+
+	if err := p.assignCallHost(args.UserId, args.ChannelId, user.Id); err != nil {
+		return nil, fmt.Errorf("Failed to assign host: %w", err)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         fmt.Sprintf("@%s is now the host of the call.", user.Username),
+	}, nil
+}
+
+func (p *Plugin) handleInviteCommand(args *model.CommandArgs, fields []string) (*model.CommandResponse, error) {
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("Invalid number of arguments provided")
+	}
+
+	userIDs := make([]string, 0, len(fields)-2)
+	usernames := make(map[string]string, len(fields)-2)
+	for _, field := range fields[2:] {
+		user, appErr := p.API.GetUserByUsername(strings.TrimPrefix(field, "@"))
+		if appErr != nil {
+			return nil, fmt.Errorf("User %s not found", field)
+		}
+		if _, ok := usernames[user.Id]; ok {
+			continue
+		}
+		userIDs = append(userIDs, user.Id)
+		usernames[user.Id] = user.Username
+	}
+
+	result, err := p.inviteUsers(args.UserId, args.ChannelId, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to invite: %w", err)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         getInviteCommandText(result, usernames),
+	}, nil
+}
+
 func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
 	fields := strings.Fields(args.Command)
 
@@ -240,6 +344,39 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		return resp, nil
 	}
 
+	if subCmd == scheduleCommandTrigger {
+		resp, err := p.handleScheduleCommand(args, fields)
+		if err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         fmt.Sprintf("Error: %s", err.Error()),
+			}, nil
+		}
+		return resp, nil
+	}
+
+	if subCmd == hostCommandTrigger {
+		resp, err := p.handleHostCommand(args, fields)
+		if err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         fmt.Sprintf("Error: %s", err.Error()),
+			}, nil
+		}
+		return resp, nil
+	}
+
+	if subCmd == inviteCommandTrigger {
+		resp, err := p.handleInviteCommand(args, fields)
+		if err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         fmt.Sprintf("Error: %s", err.Error()),
+			}, nil
+		}
+		return resp, nil
+	}
+
 	for _, cmd := range subCommands {
 		if cmd == subCmd {
 			return &model.CommandResponse{}, nil
@@ -0,0 +1,170 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	// transcriptionTimeout is how long a transcription job can run for.
+	transcriptionTimeout = time.Hour
+	// transcriptionMaxSizeBytes caps the size of the segments sent back by a
+	// transcription job.
+	transcriptionMaxSizeBytes = 16 * 1024 * 1024 // 16MB
+)
+
+// transcriptSegment is a chunk of transcribed speech. Timestamps are relative
+// to the beginning of the recording.
+type transcriptSegment struct {
+	StartMS int64  `json:"start_ms"`
+	EndMS   int64  `json:"end_ms"`
+	Text    string `json:"text"`
+}
+
+func formatTranscriptTimestamp(ms int64, sep string) string {
+	d := time.Duration(ms) * time.Millisecond
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	s := d / time.Second
+	d -= s * time.Second
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, sep, d/time.Millisecond)
+}
+
+func formatWebVTT(segments []transcriptSegment) []byte {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, seg := range segments {
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n", i+1,
+			formatTranscriptTimestamp(seg.StartMS, "."), formatTranscriptTimestamp(seg.EndMS, "."), seg.Text)
+	}
+	return []byte(b.String())
+}
+
+func formatSRT(segments []transcriptSegment) []byte {
+	var b strings.Builder
+	for i, seg := range segments {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n", i+1,
+			formatTranscriptTimestamp(seg.StartMS, ","), formatTranscriptTimestamp(seg.EndMS, ","), seg.Text)
+	}
+	return []byte(b.String())
+}
+
+// generateTranscriptionFiles returns the WebVTT and SRT encoded transcription
+// out of the segments produced by the transcription job.
+func generateTranscriptionFiles(segments []transcriptSegment) ([]byte, []byte, error) {
+	for i, seg := range segments {
+		if seg.EndMS < seg.StartMS {
+			return nil, nil, fmt.Errorf("invalid segment %d: end should not come before start", i)
+		}
+		segments[i].Text = strings.TrimSpace(seg.Text)
+	}
+
+	return formatWebVTT(segments), formatSRT(segments), nil
+}
+
+// startTranscription runs a job to transcribe the given recording file. The
+// job fetches the recording and sends back the transcribed segments through
+// the bot API.
+func (p *Plugin) startTranscription(callID, postID, recordingFileID string) error {
+	if p.jobService == nil {
+		return fmt.Errorf("job service is not initialized")
+	}
+
+	jobID, err := p.jobService.RunTranscriptionJob(callID, postID, recordingFileID, p.botSession.Token)
+	if err != nil {
+		return fmt.Errorf("failed to run transcription job: %w", err)
+	}
+
+	p.LogDebug("transcription job started", "callID", callID, "fileID", recordingFileID, "jobID", jobID)
+
+	return nil
+}
+
+// saveTranscription stores the transcription of the given recording file and
+// shares it in the call thread.
+func (p *Plugin) saveTranscription(callID, postID, recordingFileID string, segments []transcriptSegment) error {
+	info, appErr := p.API.GetFileInfo(recordingFileID)
+	if appErr != nil {
+		return fmt.Errorf("failed to get recording file info: %w", appErr)
+	}
+	if info.ChannelId != callID {
+		return fmt.Errorf("recording file does not belong to the call")
+	}
+
+	vtt, srt, err := generateTranscriptionFiles(segments)
+	if err != nil {
+		return fmt.Errorf("failed to generate transcription files: %w", err)
+	}
+
+	baseName := strings.TrimSuffix(info.Name, filepath.Ext(info.Name))
+	var fileIDs []string
+	for _, file := range []struct {
+		ext  string
+		data []byte
+	}{{".vtt", vtt}, {".srt", srt}} {
+		fi, appErr := p.API.UploadFile(file.data, callID, baseName+file.ext)
+		if appErr != nil {
+			return fmt.Errorf("failed to upload transcription file: %w", appErr)
+		}
+		fileIDs = append(fileIDs, fi.Id)
+	}
+
+	return p.postTranscriptionFiles(callID, postID, fileIDs)
+}
+
+// postTranscriptionFiles links the transcription files to the call post and
+// shares them in its thread.
+func (p *Plugin) postTranscriptionFiles(callID, postID string, fileIDs []string) error {
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return fmt.Errorf("failed to get call post: %w", appErr)
+	}
+
+	threadID := post.Id
+
+	// Post in thread
+	if post.RootId != "" {
+		threadID = post.RootId
+	}
+
+	transcriptions, _ := post.GetProp("transcription_files").([]interface{})
+	for _, fileID := range fileIDs {
+		transcriptions = append(transcriptions, fileID)
+	}
+	post.AddProp("transcription_files", transcriptions)
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		return fmt.Errorf("failed to update call thread: %w", appErr)
+	}
+
+	// Props are JSON decoded so numbers are float64.
+	startAt, _ := post.GetProp("start_at").(float64)
+	postMsg := "Here's the call transcription"
+	if title, _ := post.GetProp("title").(string); title != "" {
+		postMsg = fmt.Sprintf("%s of %s at %s UTC", postMsg, title, time.UnixMilli(int64(startAt)).UTC().Format("3:04PM"))
+	}
+
+	if _, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.getBotID(),
+		ChannelId: callID,
+		Message:   postMsg,
+		Type:      "custom_calls_transcription",
+		RootId:    threadID,
+		FileIds:   fileIDs,
+	}); appErr != nil {
+		return fmt.Errorf("failed to create post: %w", appErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-calls/server/enterprise"
+
+	pluginapi "github.com/mattermost/mattermost-plugin-api"
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatTranscriptTimestamp(t *testing.T) {
+	require.Equal(t, "00:00:00.000", formatTranscriptTimestamp(0, "."))
+	require.Equal(t, "00:00:01,500", formatTranscriptTimestamp(1500, ","))
+	require.Equal(t, "01:02:03.004", formatTranscriptTimestamp(3723004, "."))
+}
+
+func TestGenerateTranscriptionFiles(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		vtt, srt, err := generateTranscriptionFiles([]transcriptSegment{
+			{StartMS: 0, EndMS: 2500, Text: " Hello everyone "},
+			{StartMS: 3000, EndMS: 65000, Text: "Let's get started"},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, `WEBVTT
+
+1
+00:00:00.000 --> 00:00:02.500
+Hello everyone
+
+2
+00:00:03.000 --> 00:01:05.000
+Let's get started
+`, string(vtt))
+
+		require.Equal(t, `1
+00:00:00,000 --> 00:00:02,500
+Hello everyone
+
+2
+00:00:03,000 --> 00:01:05,000
+Let's get started
+`, string(srt))
+	})
+
+	t.Run("invalid segment", func(t *testing.T) {
+		_, _, err := generateTranscriptionFiles([]transcriptSegment{
+			{StartMS: 2000, EndMS: 1000, Text: "backwards"},
+		})
+		require.EqualError(t, err, "invalid segment 0: end should not come before start")
+	})
+}
+
+func TestBotTranscriptionAPI(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+
+	p.botSession = &model.Session{UserId: "botID"}
+	p.licenseChecker = enterprise.NewLicenseChecker(pluginapi.NewClient(p.API, nil))
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{
+		EnableDeveloper: model.NewBool(true),
+		EnableTesting:   model.NewBool(true),
+	}})
+	api.On("GetLicense").Return(nil)
+
+	callID := model.NewId()
+	botRequest := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Mattermost-User-Id", "botID")
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "calls"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "calls", "rec.mp4"), []byte("media"), 0600))
+
+	cfg := &model.Config{}
+	cfg.SetDefaults()
+	cfg.FileSettings.DriverName = model.NewString(model.ImageDriverLocal)
+	cfg.FileSettings.Directory = model.NewString(dir)
+	api.On("GetUnsanitizedConfig").Return(cfg)
+
+	api.On("GetFileInfo", "recfileid").Return(&model.FileInfo{Id: "recfileid", ChannelId: callID, Name: "rec.mp4", Path: "calls/rec.mp4", MimeType: "video/mp4"}, nil)
+	api.On("GetFileInfo", "otherfileid").Return(&model.FileInfo{Id: "otherfileid", ChannelId: "otherChannelID"}, nil)
+
+	t.Run("recording file", func(t *testing.T) {
+		w := botRequest(http.MethodGet, "/bot/calls/"+callID+"/recordings/recfileid", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "media", w.Body.String())
+
+		// Files of other channels are not served.
+		require.Equal(t, http.StatusNotFound, botRequest(http.MethodGet, "/bot/calls/"+callID+"/recordings/otherfileid", "").Code)
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, botRequest(http.MethodPost, "/bot/calls/"+callID+"/transcriptions", `{"recording_file_id": "recfileid"}`).Code)
+		require.Equal(t, http.StatusBadRequest, botRequest(http.MethodPost, "/bot/calls/"+callID+"/transcriptions", `{"post_id": "postID"}`).Code)
+	})
+
+	t.Run("save", func(t *testing.T) {
+		api.On("UploadFile", mock.Anything, callID, "rec.vtt").Return(&model.FileInfo{Id: "vttID"}, nil).Once()
+		api.On("UploadFile", mock.Anything, callID, "rec.srt").Return(&model.FileInfo{Id: "srtID"}, nil).Once()
+		api.On("GetPost", "postID").Return(&model.Post{
+			Id:    "postID",
+			Props: model.StringInterface{"start_at": float64(0), "title": "Standup"},
+		}, nil)
+		api.On("UpdatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return fmt.Sprint(post.GetProp("transcription_files")) == "[vttID srtID]"
+		})).Return(&model.Post{}, nil).Once()
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.RootId == "postID" && post.Type == "custom_calls_transcription" &&
+				post.Message == "Here's the call transcription of Standup at 12:00AM UTC" &&
+				fmt.Sprint(post.FileIds) == "[vttID srtID]"
+		})).Return(&model.Post{}, nil).Once()
+
+		w := botRequest(http.MethodPost, "/bot/calls/"+callID+"/transcriptions",
+			`{"post_id": "postID", "recording_file_id": "recfileid", "segments": [{"start_ms": 0, "end_ms": 1000, "text": "hello"}]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("file of another call", func(t *testing.T) {
+		w := botRequest(http.MethodPost, "/bot/calls/"+callID+"/transcriptions",
+			`{"post_id": "postID", "recording_file_id": "otherfileid", "segments": []}`)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
@@ -16,6 +16,8 @@ import (
 	"time"
 
 	"github.com/Masterminds/semver"
+
+	"github.com/mattermost/mattermost-server/v6/shared/filestore"
 )
 
 const (
@@ -32,6 +34,31 @@ func (p *Plugin) getHandlerID() (string, error) {
 	return string(data), nil
 }
 
+// isRTCDCall returns whether the media of the given call is hosted on rtcd.
+func (p *Plugin) isRTCDCall(state *channelState) bool {
+	if p.rtcdManager == nil {
+		return false
+	}
+	return state == nil || state.Call == nil || state.Call.RTCBackend != rtcBackendEmbedded
+}
+
+// getCallHandlerID returns the ID of the node handling the RTC sessions
+// of the given call. Calls hosted on rtcd can be handled by any node.
+func (p *Plugin) getCallHandlerID(state *channelState) string {
+	if p.isRTCDCall(state) {
+		return p.nodeID
+	}
+
+	handlerID, err := p.getHandlerID()
+	if err != nil {
+		p.LogError(err.Error())
+	}
+	if handlerID == "" && state != nil {
+		handlerID = state.NodeID
+	}
+	return handlerID
+}
+
 func (p *Plugin) setHandlerID(nodeID string) error {
 	p.metrics.IncStoreOp("KVSetWithExpiry")
 	if appErr := p.API.KVSetWithExpiry(handlerKey, []byte(nodeID), int64(handlerKeyCheckInterval.Seconds()*2)); appErr != nil {
@@ -152,3 +179,30 @@ func checkMinVersion(minVersion, currVersion string) error {
 
 	return nil
 }
+
+// getFileBackend returns a client to the file store the server is configured
+// to use.
+func (p *Plugin) getFileBackend() (filestore.FileBackend, error) {
+	cfg := p.API.GetUnsanitizedConfig()
+	if cfg == nil {
+		return nil, fmt.Errorf("failed to get configuration")
+	}
+
+	license := p.API.GetLicense()
+	complianceEnabled := license != nil && license.Features != nil &&
+		license.Features.Compliance != nil && *license.Features.Compliance
+	skipVerify := cfg.ServiceSettings.EnableInsecureOutgoingConnections != nil &&
+		*cfg.ServiceSettings.EnableInsecureOutgoingConnections
+
+	return filestore.NewFileBackend(cfg.FileSettings.ToFileBackendSettings(complianceEnabled, skipVerify))
+}
+
+// openFile returns a reader for the file stored at the given path. Contrary
+// to API.GetFile the content is streamed rather than loaded in memory.
+func (p *Plugin) openFile(path string) (io.ReadCloser, error) {
+	backend, err := p.getFileBackend()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file backend: %w", err)
+	}
+	return backend.Reader(path)
+}
@@ -138,3 +138,22 @@ func TestCheckMinVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestIsRTCDCall(t *testing.T) {
+	p := &Plugin{}
+
+	t.Run("rtcd disabled", func(t *testing.T) {
+		assert.False(t, p.isRTCDCall(nil))
+		assert.False(t, p.isRTCDCall(&channelState{Call: &callState{RTCBackend: rtcBackendRTCD}}))
+	})
+
+	p.rtcdManager = &rtcdClientManager{}
+
+	t.Run("rtcd enabled", func(t *testing.T) {
+		assert.True(t, p.isRTCDCall(nil))
+		assert.True(t, p.isRTCDCall(&channelState{}))
+		assert.True(t, p.isRTCDCall(&channelState{Call: &callState{}}))
+		assert.True(t, p.isRTCDCall(&channelState{Call: &callState{RTCBackend: rtcBackendRTCD}}))
+		assert.False(t, p.isRTCDCall(&channelState{Call: &callState{RTCBackend: rtcBackendEmbedded}}))
+	})
+}
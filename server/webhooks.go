@@ -0,0 +1,361 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// The call events outgoing webhooks can subscribe to.
+const (
+	webhookEventCallStarted        = "call_started"
+	webhookEventCallEnded          = "call_ended"
+	webhookEventParticipantJoined  = "participant_joined"
+	webhookEventParticipantLeft    = "participant_left"
+	webhookEventRecordingReady     = "recording_ready"
+	webhookEventScreenShareStarted = "screen_share_started"
+)
+
+var webhookEvents = map[string]bool{
+	webhookEventCallStarted:        true,
+	webhookEventCallEnded:          true,
+	webhookEventParticipantJoined:  true,
+	webhookEventParticipantLeft:    true,
+	webhookEventRecordingReady:     true,
+	webhookEventScreenShareStarted: true,
+}
+
+const (
+	webhookDeliveriesKeyPrefix = "webhook_deliveries_"
+	webhookDeliveriesMaxLen    = 100
+	// The number of deliveries running at the same time. Further ones wait
+	// in the queue, up to webhookQueueSize, and are dropped past that.
+	webhookWorkers             = 4
+	webhookQueueSize           = 1024
+	webhookRequestTimeout      = 10 * time.Second
+	webhookMaxAttempts         = 5
+	webhookRetryBaseDelay      = time.Second
+	webhookSignatureHeader     = "X-Calls-Signature"
+	webhookTimestampHeader     = "X-Calls-Timestamp"
+	webhookEventHeader         = "X-Calls-Event"
+	webhookDeliveryHeader      = "X-Calls-Delivery"
+	webhookDeliveryStatusOK    = "success"
+	webhookDeliveryStatusError = "fail"
+)
+
+// outgoingWebhookConfig is the configuration of an endpoint call events get
+// posted to.
+type outgoingWebhookConfig struct {
+	URL string `json:"url"`
+	// The secret used to sign payloads.
+	Secret string `json:"secret"`
+	// The events to send. If empty all events are sent.
+	Events []string `json:"events,omitempty"`
+}
+
+func (cfg outgoingWebhookConfig) subscribed(event string) bool {
+	return eventSubscribed(cfg.Events, event)
+}
+
+// eventSubscribed returns whether the event is part of the given list. An
+// empty list subscribes to all events.
+func eventSubscribed(events []string, event string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, ev := range events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+type OutgoingWebhooksConfigs []outgoingWebhookConfig
+
+func (cfgs *OutgoingWebhooksConfigs) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	unquoted, err := strconv.Unquote(string(data))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(unquoted) == "" {
+		return nil
+	}
+
+	var dst []outgoingWebhookConfig
+	err = json.Unmarshal([]byte(unquoted), &dst)
+	*cfgs = dst
+
+	return err
+}
+
+func (cfgs OutgoingWebhooksConfigs) IsValid() error {
+	for i, cfg := range cfgs {
+		if u, err := url.Parse(cfg.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid webhook %d: URL is not valid", i)
+		}
+		if cfg.Secret == "" {
+			return fmt.Errorf("invalid webhook %d: secret should not be empty", i)
+		}
+		for _, ev := range cfg.Events {
+			if !webhookEvents[ev] {
+				return fmt.Errorf("invalid webhook %d: unknown event %q", i, ev)
+			}
+		}
+	}
+	return nil
+}
+
+type webhookPayload struct {
+	ID        string                 `json:"id"`
+	Event     string                 `json:"event"`
+	Timestamp int64                  `json:"timestamp"`
+	ChannelID string                 `json:"channel_id"`
+	CallID    string                 `json:"call_id,omitempty"`
+	UserID    string                 `json:"user_id,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// webhookDelivery is the outcome of sending a payload to a webhook.
+type webhookDelivery struct {
+	ID         string `json:"id"`
+	Event      string `json:"event"`
+	URL        string `json:"url"`
+	CreateAt   int64  `json:"create_at"`
+	DoneAt     int64  `json:"done_at"`
+	Attempts   int    `json:"attempts"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Status     string `json:"status"`
+	Err        string `json:"err,omitempty"`
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of the timestamp
+// and body, separated by a dot.
+func signWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay returns how long to wait before the given attempt.
+func webhookRetryDelay(attempt int) time.Duration {
+	return webhookRetryBaseDelay * time.Duration(1<<(attempt-1))
+}
+
+func sendWebhook(client *http.Client, cfg outgoingWebhookConfig, payload webhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().UnixMilli()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, payload.Event)
+	req.Header.Set(webhookDeliveryHeader, payload.ID)
+	req.Header.Set(webhookTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhookPayload(cfg.Secret, ts, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// webhookDeliveriesKey returns the key the deliveries to the webhook with
+// the given URL are recorded under. Keeping a log per webhook avoids all the
+// deliveries contending on the same key.
+func webhookDeliveriesKey(webhookURL string) string {
+	sum := sha256.Sum256([]byte(webhookURL))
+	return webhookDeliveriesKeyPrefix + hex.EncodeToString(sum[:16])
+}
+
+func (p *Plugin) kvGetWebhookDeliveries(webhookURL string) ([]webhookDelivery, error) {
+	p.metrics.IncStoreOp("KVGet")
+	data, appErr := p.API.KVGet(webhookDeliveriesKey(webhookURL))
+	if appErr != nil {
+		return nil, fmt.Errorf("KVGet failed: %w", appErr)
+	}
+	deliveries := []webhookDelivery{}
+	if data == nil {
+		return deliveries, nil
+	}
+	if err := json.Unmarshal(data, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// addWebhookDelivery records a delivery, keeping only the most recent ones
+// for each webhook.
+func (p *Plugin) addWebhookDelivery(delivery webhookDelivery) error {
+	return p.kvSetAtomic(webhookDeliveriesKey(delivery.URL), func(data []byte) ([]byte, error) {
+		var deliveries []webhookDelivery
+		if data != nil {
+			if err := json.Unmarshal(data, &deliveries); err != nil {
+				return nil, err
+			}
+		}
+		deliveries = append([]webhookDelivery{delivery}, deliveries...)
+		if len(deliveries) > webhookDeliveriesMaxLen {
+			deliveries = deliveries[:webhookDeliveriesMaxLen]
+		}
+		return json.Marshal(deliveries)
+	})
+}
+
+// deliverWebhook sends the payload to the webhook, retrying with exponential
+// backoff on failure.
+func (p *Plugin) deliverWebhook(cfg outgoingWebhookConfig, payload webhookPayload, body []byte) {
+	client := &http.Client{Timeout: webhookRequestTimeout}
+	delivery := webhookDelivery{
+		ID:       payload.ID,
+		Event:    payload.Event,
+		URL:      cfg.URL,
+		CreateAt: payload.Timestamp,
+	}
+
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(webhookRetryDelay(attempt - 1)):
+			case <-p.stopCh:
+				return
+			}
+		}
+
+		delivery.Attempts = attempt
+		code, err := sendWebhook(client, cfg, payload, body)
+		delivery.StatusCode = code
+		if err == nil {
+			delivery.Status = webhookDeliveryStatusOK
+			delivery.Err = ""
+			break
+		}
+		delivery.Status = webhookDeliveryStatusError
+		delivery.Err = err.Error()
+		p.LogWarn("failed to deliver webhook", "url", cfg.URL, "event", payload.Event, "attempt", attempt, "err", err.Error())
+	}
+
+	delivery.DoneAt = time.Now().UnixMilli()
+	if err := p.addWebhookDelivery(delivery); err != nil {
+		p.LogError("failed to record webhook delivery", "err", err.Error())
+	}
+}
+
+// queueWebhookDelivery schedules the delivery on the webhook workers. The
+// delivery is dropped if the queue is full.
+func (p *Plugin) queueWebhookDelivery(deliver func()) bool {
+	select {
+	case p.webhookCh <- deliver:
+		return true
+	default:
+		return false
+	}
+}
+
+// webhookWorker runs the queued deliveries until the plugin is deactivated.
+func (p *Plugin) webhookWorker() {
+	for {
+		select {
+		case deliver := <-p.webhookCh:
+			deliver()
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// publishCallEvent posts the event to all the webhooks and plugins subscribed
+// to it. Deliveries happen in the background.
+func (p *Plugin) publishCallEvent(event, channelID, callID, userID string, data map[string]interface{}) {
+	cfg := p.getConfiguration()
+	if len(cfg.OutgoingWebhooks) == 0 && cfg.PluginAPIAllowedPlugins == "" {
+		return
+	}
+
+	payload := webhookPayload{
+		ID:        model.NewId(),
+		Event:     event,
+		Timestamp: time.Now().UnixMilli(),
+		ChannelID: channelID,
+		CallID:    callID,
+		UserID:    userID,
+		Data:      data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		p.LogError("failed to marshal webhook payload", "err", err.Error())
+		return
+	}
+
+	for _, hook := range cfg.OutgoingWebhooks {
+		if !hook.subscribed(event) {
+			continue
+		}
+		hook := hook
+		if !p.queueWebhookDelivery(func() { p.deliverWebhook(hook, payload, body) }) {
+			p.LogWarn("webhook queue is full, dropping delivery", "url", hook.URL, "event", event)
+		}
+	}
+
+	p.sendPluginCallbacks(payload, body)
+}
+
+func (p *Plugin) handleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	var res httpResponse
+	defer p.httpAudit("handleGetWebhookDeliveries", &res, w, r)
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		res.Err = "Forbidden"
+		res.Code = http.StatusForbidden
+		return
+	}
+
+	deliveries := []webhookDelivery{}
+	for _, hook := range p.getConfiguration().OutgoingWebhooks {
+		hookDeliveries, err := p.kvGetWebhookDeliveries(hook.URL)
+		if err != nil {
+			res.Err = err.Error()
+			res.Code = http.StatusInternalServerError
+			return
+		}
+		deliveries = append(deliveries, hookDeliveries...)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].DoneAt > deliveries[j].DoneAt
+	})
+	if len(deliveries) > webhookDeliveriesMaxLen {
+		deliveries = deliveries[:webhookDeliveriesMaxLen]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		p.LogError(err.Error())
+	}
+}
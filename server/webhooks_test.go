@@ -0,0 +1,147 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutgoingWebhooksConfigs(t *testing.T) {
+	t.Run("unmarshal", func(t *testing.T) {
+		var cfgs OutgoingWebhooksConfigs
+		require.NoError(t, json.Unmarshal([]byte(`""`), &cfgs))
+		require.Empty(t, cfgs)
+
+		data, err := json.Marshal(`[{"url": "https://example.com/hook", "secret": "s", "events": ["call_started"]}]`)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &cfgs))
+		require.Equal(t, OutgoingWebhooksConfigs{
+			{URL: "https://example.com/hook", Secret: "s", Events: []string{"call_started"}},
+		}, cfgs)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		cfgs := OutgoingWebhooksConfigs{
+			{URL: "https://example.com/hook", Secret: "s"},
+		}
+		require.NoError(t, cfgs.IsValid())
+
+		cfgs[0].URL = "ftp://example.com"
+		require.EqualError(t, cfgs.IsValid(), "invalid webhook 0: URL is not valid")
+
+		cfgs[0].URL = "https://example.com/hook"
+		cfgs[0].Secret = ""
+		require.EqualError(t, cfgs.IsValid(), "invalid webhook 0: secret should not be empty")
+
+		cfgs[0].Secret = "s"
+		cfgs[0].Events = []string{"call_started", "call_paused"}
+		require.EqualError(t, cfgs.IsValid(), `invalid webhook 0: unknown event "call_paused"`)
+	})
+
+	t.Run("subscribed", func(t *testing.T) {
+		cfg := outgoingWebhookConfig{}
+		require.True(t, cfg.subscribed(webhookEventCallEnded))
+
+		cfg.Events = []string{webhookEventCallStarted}
+		require.True(t, cfg.subscribed(webhookEventCallStarted))
+		require.False(t, cfg.subscribed(webhookEventCallEnded))
+	})
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	require.Equal(t, time.Second, webhookRetryDelay(1))
+	require.Equal(t, 2*time.Second, webhookRetryDelay(2))
+	require.Equal(t, 8*time.Second, webhookRetryDelay(4))
+}
+
+func TestSendWebhook(t *testing.T) {
+	cfg := outgoingWebhookConfig{Secret: "secret"}
+	payload := webhookPayload{ID: "deliveryID", Event: webhookEventCallStarted, ChannelID: "channelID"}
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, body, data)
+		require.Equal(t, webhookEventCallStarted, r.Header.Get(webhookEventHeader))
+		require.Equal(t, "deliveryID", r.Header.Get(webhookDeliveryHeader))
+
+		timestamp, err := strconv.ParseInt(r.Header.Get(webhookTimestampHeader), 10, 64)
+		require.NoError(t, err)
+		require.Equal(t, "sha256="+signWebhookPayload("secret", timestamp, data), r.Header.Get(webhookSignatureHeader))
+
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	cfg.URL = ts.URL
+
+	code, err := sendWebhook(ts.Client(), cfg, payload, body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+
+	status = http.StatusInternalServerError
+	code, err = sendWebhook(ts.Client(), cfg, payload, body)
+	require.EqualError(t, err, "unexpected status code 500")
+	require.Equal(t, http.StatusInternalServerError, code)
+}
+
+func TestPublishCallEventQueue(t *testing.T) {
+	p, _, _ := newTestPlugin(t)
+	p.webhookCh = make(chan func(), 1)
+	p.configuration.OutgoingWebhooks = OutgoingWebhooksConfigs{
+		{URL: "http://localhost/hookA", Secret: "secret"},
+		{URL: "http://localhost/hookB", Secret: "secret", Events: []string{webhookEventCallEnded}},
+	}
+
+	// Only hookA is subscribed to call started.
+	p.publishCallEvent(webhookEventCallStarted, "channelID", "callID", "userID", nil)
+	require.Len(t, p.webhookCh, 1)
+
+	// The queue is full so the deliveries are dropped rather than piling up.
+	p.publishCallEvent(webhookEventCallEnded, "channelID", "callID", "", nil)
+	require.Len(t, p.webhookCh, 1)
+}
+
+func TestHandleGetWebhookDeliveries(t *testing.T) {
+	p, api, _ := newTestPlugin(t)
+	p.configuration.OutgoingWebhooks = OutgoingWebhooksConfigs{
+		{URL: "http://localhost/hookA", Secret: "secret"},
+		{URL: "http://localhost/hookB", Secret: "secret"},
+	}
+
+	require.NotEqual(t, webhookDeliveriesKey("http://localhost/hookA"), webhookDeliveriesKey("http://localhost/hookB"))
+
+	require.NoError(t, p.addWebhookDelivery(webhookDelivery{ID: "deliveryA", URL: "http://localhost/hookA", DoneAt: 1000}))
+	require.NoError(t, p.addWebhookDelivery(webhookDelivery{ID: "deliveryB", URL: "http://localhost/hookB", DoneAt: 3000}))
+	require.NoError(t, p.addWebhookDelivery(webhookDelivery{ID: "deliveryC", URL: "http://localhost/hookA", DoneAt: 2000}))
+
+	deliveries, err := p.kvGetWebhookDeliveries("http://localhost/hookA")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+
+	api.On("HasPermissionTo", "adminID", model.PermissionManageSystem).Return(true).Once()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/admin/webhooks/deliveries", nil)
+	r.Header.Set("Mattermost-User-Id", "adminID")
+	p.handleGetWebhookDeliveries(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&deliveries))
+	require.Len(t, deliveries, 3)
+	require.Equal(t, "deliveryB", deliveries[0].ID)
+	require.Equal(t, "deliveryC", deliveries[1].ID)
+	require.Equal(t, "deliveryA", deliveries[2].ID)
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync/atomic"
@@ -17,25 +18,57 @@ import (
 )
 
 const (
-	wsEventSignal             = "signal"
-	wsEventUserConnected      = "user_connected"
-	wsEventUserDisconnected   = "user_disconnected"
-	wsEventUserMuted          = "user_muted"
-	wsEventUserUnmuted        = "user_unmuted"
-	wsEventUserVoiceOn        = "user_voice_on"
-	wsEventUserVoiceOff       = "user_voice_off"
-	wsEventUserScreenOn       = "user_screen_on"
-	wsEventUserScreenOff      = "user_screen_off"
-	wsEventCallStart          = "call_start"
-	wsEventCallEnd            = "call_end"
-	wsEventUserRaiseHand      = "user_raise_hand"
-	wsEventUserUnraiseHand    = "user_unraise_hand"
-	wsEventUserReacted        = "user_reacted"
-	wsEventJoin               = "join"
-	wsEventError              = "error"
-	wsEventCallHostChanged    = "call_host_changed"
-	wsEventCallRecordingState = "call_recording_state"
-	wsReconnectionTimeout     = 10 * time.Second
+	wsEventSignal                 = "signal"
+	wsEventUserConnected          = "user_connected"
+	wsEventUserDisconnected       = "user_disconnected"
+	wsEventUserMuted              = "user_muted"
+	wsEventUserUnmuted            = "user_unmuted"
+	wsEventUserVoiceOn            = "user_voice_on"
+	wsEventUserVoiceOff           = "user_voice_off"
+	wsEventUserScreenOn           = "user_screen_on"
+	wsEventUserScreenOff          = "user_screen_off"
+	wsEventCallStart              = "call_start"
+	wsEventCallEnd                = "call_end"
+	wsEventUserRaiseHand          = "user_raise_hand"
+	wsEventUserUnraiseHand        = "user_unraise_hand"
+	wsEventUserReacted            = "user_reacted"
+	wsEventJoin                   = "join"
+	wsEventError                  = "error"
+	wsEventCallHostChanged        = "call_host_changed"
+	wsEventCallRecordingState     = "call_recording_state"
+	wsEventCallRecordingPublished = "call_recording_published"
+	wsEventCallHostAssigned       = "call_host_assigned"
+	wsEventHostMute               = "host_mute"
+	wsEventHostLowerHand          = "host_lower_hand"
+	wsEventHostScreenOff          = "host_screen_off"
+	wsEventHostRemoved            = "host_removed"
+	wsEventCallLobbyKnock         = "call_lobby_knock"
+	wsEventChannelLobbyChanged    = "channel_lobby_changed"
+	wsEventChannelPolicyChanged   = "channel_policy_changed"
+	wsEventCallLobbyWaiting       = "call_lobby_waiting"
+	wsEventCallLobbyAdmitted      = "call_lobby_admitted"
+	wsEventCallLobbyRejected      = "call_lobby_rejected"
+	wsEventCallLobbyLeft          = "call_lobby_left"
+	wsEventCallLobbyExpired       = "call_lobby_expired"
+	wsEventCallRTCMigrated        = "call_rtc_migrated"
+	wsEventCallRinging            = "call_ringing"
+	wsEventCallRingingStopped     = "call_ringing_stopped"
+	wsEventCallRingingDeclined    = "call_ringing_declined"
+	wsEventCallInvite             = "call_invite"
+	wsEventCallInviteRequest      = "call_invite_request"
+	wsEventCallInviteDenied       = "call_invite_denied"
+	wsEventCallInviteExpired      = "call_invite_expired"
+	wsReconnectionTimeout         = 10 * time.Second
+)
+
+// The reasons a call can end for.
+const (
+	// The last participant left the call.
+	callEndReasonLeft = "left"
+	// The call didn't end cleanly after being ended and was forcibly removed.
+	callEndReasonForced = "forced"
+	// The call was removed from the state as the plugin got (de)activated.
+	callEndReasonCleanUp = "cleanup"
 )
 
 func (p *Plugin) publishWebSocketEvent(ev string, data map[string]interface{}, broadcast *model.WebsocketBroadcast) {
@@ -81,6 +114,7 @@ func (p *Plugin) handleClientMessageTypeScreen(us *session, msg clientMessage, h
 		}
 	}
 
+	var callID string
 	if err := p.kvSetAtomicChannelState(us.channelID, func(state *channelState) (*channelState, error) {
 		if state == nil {
 			return nil, fmt.Errorf("channel state is missing from store")
@@ -88,8 +122,12 @@ func (p *Plugin) handleClientMessageTypeScreen(us *session, msg clientMessage, h
 		if state.Call == nil {
 			return nil, fmt.Errorf("call state is missing from channel state")
 		}
+		callID = state.Call.ID
 
 		if msg.Type == clientMessageTypeScreenOn {
+			if !state.Policy.screenSharingAllowed() {
+				return nil, fmt.Errorf("screen sharing is not allowed in this channel")
+			}
 			if state.Call.ScreenSharingID != "" {
 				return nil, fmt.Errorf("cannot start screen sharing, someone else is sharing already: %q", state.Call.ScreenSharingID)
 			}
@@ -118,6 +156,9 @@ func (p *Plugin) handleClientMessageTypeScreen(us *session, msg clientMessage, h
 	if msg.Type == clientMessageTypeScreenOff {
 		msgType = rtc.ScreenOffMessage
 		wsMsgType = wsEventUserScreenOff
+	} else {
+		p.metrics.IncScreenShare()
+		p.publishCallEvent(webhookEventScreenShareStarted, us.channelID, callID, us.userID, nil)
 	}
 
 	if handlerID != p.nodeID {
@@ -137,7 +178,7 @@ func (p *Plugin) handleClientMessageTypeScreen(us *session, msg clientMessage, h
 			Data:      msg.Data,
 		}
 
-		if err := p.sendRTCMessage(rtcMsg, us.channelID); err != nil {
+		if err := p.sendRTCMessage(rtcMsg, us.channelID, us.rtcd); err != nil {
 			return fmt.Errorf("failed to send RTC message: %w", err)
 		}
 	}
@@ -188,7 +229,7 @@ func (p *Plugin) handleClientMsg(us *session, msg clientMessage, handlerID strin
 				Data:      msg.Data,
 			}
 
-			if err := p.sendRTCMessage(rtcMsg, us.channelID); err != nil {
+			if err := p.sendRTCMessage(rtcMsg, us.channelID, us.rtcd); err != nil {
 				p.LogError(fmt.Errorf("failed to send RTC message: %w", err).Error())
 			}
 		}
@@ -201,7 +242,7 @@ func (p *Plugin) handleClientMsg(us *session, msg clientMessage, handlerID strin
 				Data:      msg.Data,
 			}
 
-			if err := p.sendRTCMessage(rtcMsg, us.channelID); err != nil {
+			if err := p.sendRTCMessage(rtcMsg, us.channelID, us.rtcd); err != nil {
 				p.LogError(fmt.Errorf("failed to send RTC message: %w", err).Error())
 			}
 		} else {
@@ -240,7 +281,7 @@ func (p *Plugin) handleClientMsg(us *session, msg clientMessage, handlerID strin
 				Data:      msg.Data,
 			}
 
-			if err := p.sendRTCMessage(rtcMsg, us.channelID); err != nil {
+			if err := p.sendRTCMessage(rtcMsg, us.channelID, us.rtcd); err != nil {
 				p.LogError(fmt.Errorf("failed to send RTC message: %w", err).Error())
 			}
 		}
@@ -316,6 +357,33 @@ func (p *Plugin) handleClientMsg(us *session, msg clientMessage, handlerID strin
 			"emoji":     emoji.toMap(),
 			"timestamp": time.Now().UnixMilli(),
 		}, &model.WebsocketBroadcast{ChannelId: us.channelID})
+	case clientMessageTypeStats:
+		var stats callQualityStats
+		if err := json.Unmarshal(msg.Data, &stats); err != nil {
+			p.LogError(err.Error())
+			return
+		}
+		if err := p.addQualityStats(us, stats); err != nil {
+			p.LogError(err.Error(), "userID", us.userID, "connID", us.connID)
+		}
+	case clientMessageTypeHostMute, clientMessageTypeHostLowerHand, clientMessageTypeHostScreenOff, clientMessageTypeHostRemove:
+		var data hostActionData
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			p.LogError(err.Error())
+			return
+		}
+		if err := p.handleHostAction(us.userID, us.channelID, msg.Type, data.UserID); err != nil {
+			p.LogError(err.Error(), "type", msg.Type, "userID", us.userID, "channelID", us.channelID)
+		}
+	case clientMessageTypeHostAdmit, clientMessageTypeHostReject:
+		var data hostActionData
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			p.LogError(err.Error())
+			return
+		}
+		if err := p.handleLobbyAction(us.userID, us.channelID, msg.Type, data.UserID); err != nil {
+			p.LogError(err.Error(), "type", msg.Type, "userID", us.userID, "channelID", us.channelID)
+		}
 	default:
 		p.LogError("invalid client message", "type", msg.Type)
 		return
@@ -329,7 +397,18 @@ func (p *Plugin) OnWebSocketDisconnect(connID, userID string) {
 
 	p.mut.RLock()
 	us := p.sessions[connID]
+	lobbyChannelID := p.lobbyConns[connID]
 	p.mut.RUnlock()
+
+	// Users waiting in the lobby have no session yet.
+	if lobbyChannelID != "" {
+		go func() {
+			if _, err := p.leaveLobby(userID, connID, lobbyChannelID); err != nil {
+				p.LogError("failed to leave lobby", "err", err.Error(), "userID", userID, "connID", connID)
+			}
+		}()
+	}
+
 	if us != nil {
 		if atomic.CompareAndSwapInt32(&us.wsClosed, 0, 1) {
 			p.LogDebug("closing ws channel for session", "userID", userID, "connID", connID, "channelID", us.channelID)
@@ -360,8 +439,9 @@ func (p *Plugin) wsReader(us *session, handlerID string) {
 	}
 }
 
-func (p *Plugin) sendRTCMessage(msg rtc.Message, channelID string) error {
-	if p.rtcdManager != nil {
+// sendRTCMessage routes the message to the RTC backend hosting the call.
+func (p *Plugin) sendRTCMessage(msg rtc.Message, channelID string, isRTCD bool) error {
+	if isRTCD {
 		cm := rtcd.ClientMessage{
 			Type: rtcd.ClientMessageRTC,
 			Data: msg,
@@ -438,15 +518,9 @@ func (p *Plugin) handleLeave(us *session, userID, connID, channelID string) erro
 		return err
 	}
 
-	handlerID, err := p.getHandlerID()
-	if err != nil {
-		p.LogError(err.Error())
-	}
-	if handlerID == "" && state != nil {
-		handlerID = state.NodeID
-	}
+	handlerID := p.getCallHandlerID(state)
 
-	if err := p.closeRTCSession(userID, us.originalConnID, channelID, handlerID); err != nil {
+	if err := p.closeRTCSession(userID, us.originalConnID, channelID, handlerID, p.isRTCDCall(state)); err != nil {
 		p.LogError(err.Error())
 	}
 
@@ -465,6 +539,115 @@ func (p *Plugin) handleLeave(us *session, userID, connID, channelID string) erro
 	return nil
 }
 
+// validateCallThread checks that a call can be attached to the given thread.
+func (p *Plugin) validateCallThread(channelID, threadID string) error {
+	if threadID == "" {
+		return nil
+	}
+
+	post, appErr := p.API.GetPost(threadID)
+	if appErr != nil {
+		return appErr
+	}
+
+	if post.ChannelId != channelID {
+		return fmt.Errorf("forbidden")
+	}
+
+	if post.DeleteAt > 0 {
+		return fmt.Errorf("cannot attach call to deleted thread")
+	}
+
+	if post.RootId != "" {
+		return fmt.Errorf("thread is not a root post")
+	}
+
+	return nil
+}
+
+// decCallsActive decrements the active calls gauge of the node that started
+// the call, which is the one that incremented it.
+func (p *Plugin) decCallsActive(channelID, nodeID string) {
+	if nodeID == "" || nodeID == p.nodeID {
+		p.metrics.DecCallsActive()
+		return
+	}
+
+	if err := p.sendClusterMessage(clusterMessage{
+		ChannelID: channelID,
+		SenderID:  p.nodeID,
+	}, clusterMessageTypeCallEnded, nodeID); err != nil {
+		p.LogError(err.Error())
+	}
+}
+
+// onCallStarted records a new call and notifies clients about it.
+func (p *Plugin) onCallStarted(channelID string, call *callState, userID, postID, threadID string) {
+	if err := p.initCallHistory(channelID, call, postID, threadID); err != nil {
+		p.LogError(err.Error())
+	}
+
+	p.metrics.IncCallsActive()
+	p.audit(auditEventCallStarted, channelID, call.ID, userID, map[string]interface{}{
+		"host_id": call.HostID,
+	})
+	p.publishCallEvent(webhookEventCallStarted, channelID, call.ID, userID, map[string]interface{}{
+		"start_at":  call.StartAt,
+		"post_id":   postID,
+		"thread_id": threadID,
+	})
+
+	// TODO: send all the info attached to a call.
+	p.publishWebSocketEvent(wsEventCallStart, map[string]interface{}{
+		"channelID": channelID,
+		"start_at":  call.StartAt,
+		"thread_id": threadID,
+		"post_id":   postID,
+		"owner_id":  call.OwnerID,
+		"host_id":   call.HostID,
+	}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+}
+
+// onCallEnded records the end of a call. User facing side effects such as
+// webhooks and missed call posts are skipped when the call is only being
+// cleaned up from the state, as it didn't actually end.
+func (p *Plugin) onCallEnded(channelID string, call *callState, nodeID, userID, reason string) {
+	p.endCallHistory(channelID, call)
+
+	dur, err := p.updateCallPostEnded(call.PostID)
+	if err != nil {
+		p.LogError(err.Error())
+	}
+
+	p.audit(auditEventCallEnded, channelID, call.ID, userID, map[string]interface{}{
+		"participants": call.Stats.Participants,
+		"reason":       reason,
+	})
+
+	if reason == callEndReasonCleanUp {
+		// Clients are still told to stop ringing but no missed call is posted.
+		for _, ringingUserID := range call.getRingingUserIDs() {
+			p.stopRingingUser(ringingUserID, channelID, call.ID)
+		}
+		return
+	}
+
+	p.missedCall(channelID, call)
+	p.metrics.ObserveCallEnded(time.Since(time.UnixMilli(call.StartAt)).Seconds(), call.Stats.Participants)
+	p.decCallsActive(channelID, nodeID)
+	p.publishCallEvent(webhookEventCallEnded, channelID, call.ID, "", map[string]interface{}{
+		"start_at":     call.StartAt,
+		"participants": call.Stats.Participants,
+	})
+	p.track(evCallEnded, map[string]interface{}{
+		"ChannelID":      channelID,
+		"CallID":         call.ID,
+		"Duration":       dur,
+		"Participants":   call.Stats.Participants,
+		"ScreenDuration": call.Stats.ScreenDuration,
+	})
+}
+
 func (p *Plugin) handleJoin(userID, connID, channelID, title, threadID string) error {
 	p.LogDebug("handleJoin", "userID", userID, "connID", connID, "channelID", channelID)
 
@@ -481,31 +664,19 @@ func (p *Plugin) handleJoin(userID, connID, channelID, title, threadID string) e
 		return fmt.Errorf("cannot join call in archived channel")
 	}
 
-	if threadID != "" {
-		post, appErr := p.API.GetPost(threadID)
-		if appErr != nil {
-			return appErr
-		}
-
-		if post.ChannelId != channelID {
-			return fmt.Errorf("forbidden")
-		}
-
-		if post.DeleteAt > 0 {
-			return fmt.Errorf("cannot attach call to deleted thread")
-		}
-
-		if post.RootId != "" {
-			return fmt.Errorf("thread is not a root post")
-		}
+	if err := p.validateCallThread(channelID, threadID); err != nil {
+		return err
 	}
 
 	state, prevState, err := p.addUserSession(userID, connID, channel)
-	if err != nil {
+	if errors.Is(err, errUserInLobby) {
+		p.knockLobby(userID, connID, channelID, state)
+		return nil
+	} else if err != nil {
 		return fmt.Errorf("failed to add user session: %w", err)
 	} else if state.Call == nil {
 		return fmt.Errorf("state.Call should not be nil")
-	} else if len(state.Call.Users) == 1 {
+	} else if prevState.Call == nil {
 		p.track(evCallStarted, map[string]interface{}{
 			"ParticipantID": userID,
 			"CallID":        state.Call.ID,
@@ -528,34 +699,29 @@ func (p *Plugin) handleJoin(userID, connID, channelID, title, threadID string) e
 			)
 		}
 
-		postID, threadID, err := p.startNewCallPost(userID, channelID, state.Call.StartAt, title, threadID)
+		postID, threadID, err := p.startCallPost(userID, channelID, state.Call.StartAt, title, threadID)
 		if err != nil {
 			p.LogError(err.Error())
 		}
 
-		// TODO: send all the info attached to a call.
-		p.publishWebSocketEvent(wsEventCallStart, map[string]interface{}{
-			"channelID": channelID,
-			"start_at":  state.Call.StartAt,
-			"thread_id": threadID,
-			"post_id":   postID,
-			"owner_id":  state.Call.OwnerID,
-			"host_id":   state.Call.HostID,
-		}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
-	}
+		p.onCallStarted(channelID, state.Call, userID, postID, threadID)
 
-	handlerID, err := p.getHandlerID()
-	if err != nil {
-		p.LogError(err.Error())
-	}
-	if handlerID == "" {
-		handlerID = state.NodeID
+		if cfg.ringingEnabled() && shouldRing(channel) {
+			p.startRinging(channel, state.Call, userID, postID)
+		}
+	} else if _, ok := prevState.Call.Ringing[userID]; ok {
+		p.stopRingingUser(userID, channelID, state.Call.ID)
 	}
+
+	isRTCD := p.isRTCDCall(&state)
+	handlerID := p.getCallHandlerID(&state)
 	p.LogDebug("got handlerID", "handlerID", handlerID)
 
-	us := newUserSession(userID, channelID, connID, p.rtcdManager == nil && handlerID == p.nodeID)
+	us := newUserSession(userID, channelID, connID, !isRTCD && handlerID == p.nodeID)
+	us.rtcd = isRTCD
 	p.mut.Lock()
 	p.sessions[connID] = us
+	delete(p.lobbyConns, connID)
 	p.mut.Unlock()
 	defer func() {
 		if err := p.handleLeave(us, userID, connID, channelID); err != nil {
@@ -563,7 +729,7 @@ func (p *Plugin) handleJoin(userID, connID, channelID, title, threadID string) e
 		}
 	}()
 
-	if p.rtcdManager != nil {
+	if isRTCD {
 		msg := rtcd.ClientMessage{
 			Type: rtcd.ClientMessageJoin,
 			Data: map[string]string{
@@ -619,14 +785,28 @@ func (p *Plugin) handleJoin(userID, connID, channelID, title, threadID string) e
 		"ChannelID":     channelID,
 		"CallID":        state.Call.ID,
 	})
+	p.addCallHistoryParticipant(channelID, state.Call.ID, userID, connID, state.Call.Users[userID].JoinAt)
+	p.audit(auditEventParticipantJoined, channelID, state.Call.ID, userID, map[string]interface{}{
+		"session_id": connID,
+	})
+	p.publishCallEvent(webhookEventParticipantJoined, channelID, state.Call.ID, userID, map[string]interface{}{
+		"session_id": connID,
+	})
 
 	if prevState.Call != nil && state.Call.HostID != prevState.Call.HostID {
 		p.publishWebSocketEvent(wsEventCallHostChanged, map[string]interface{}{
 			"hostID": state.Call.HostID,
 		}, &model.WebsocketBroadcast{ChannelId: channelID, ReliableClusterSend: true})
+		p.addCallHistoryHostChange(channelID, state.Call.ID, state.Call.HostID)
+		p.notifyLobbyHost(channelID, state.Call)
+		p.audit(auditEventHostChanged, channelID, state.Call.ID, userID, map[string]interface{}{
+			"host_id":      state.Call.HostID,
+			"prev_host_id": prevState.Call.HostID,
+		})
 	}
 
 	if userID == p.getBotID() && state.Call.Recording != nil {
+		p.setCallHistoryRecording(channelID, state.Call.ID, state.Call.Recording)
 		p.publishWebSocketEvent(wsEventCallRecordingState, map[string]interface{}{
 			"callID":   channelID,
 			"recState": state.Call.Recording.getClientState().toMap(),
@@ -656,6 +836,7 @@ func (p *Plugin) handleReconnect(userID, connID, channelID, originalConnID, prev
 	}
 
 	var rtc bool
+	var quality callQualitySummary
 	p.mut.Lock()
 	us := p.sessions[connID]
 
@@ -668,6 +849,10 @@ func (p *Plugin) handleReconnect(userID, connID, channelID, originalConnID, prev
 
 	if us != nil {
 		rtc = us.rtc
+		// The quality stats collected so far carry over to the new session.
+		us.mut.Lock()
+		quality = us.quality
+		us.mut.Unlock()
 		if atomic.CompareAndSwapInt32(&us.wsReconnected, 0, 1) {
 			p.LogDebug("closing reconnectCh", "userID", userID, "connID", connID, "channelID", channelID,
 				"originalConnID", originalConnID)
@@ -692,6 +877,8 @@ func (p *Plugin) handleReconnect(userID, connID, channelID, originalConnID, prev
 
 	us = newUserSession(userID, channelID, connID, rtc)
 	us.originalConnID = originalConnID
+	us.rtcd = p.isRTCDCall(state)
+	us.quality = quality
 	p.sessions[connID] = us
 	p.mut.Unlock()
 
@@ -703,7 +890,7 @@ func (p *Plugin) handleReconnect(userID, connID, channelID, originalConnID, prev
 		p.LogError(err.Error())
 	}
 
-	if p.rtcdManager != nil {
+	if p.isRTCDCall(state) {
 		msg := rtcd.ClientMessage{
 			Type: rtcd.ClientMessageReconnect,
 			Data: map[string]string{
@@ -715,13 +902,7 @@ func (p *Plugin) handleReconnect(userID, connID, channelID, originalConnID, prev
 		}
 	}
 
-	handlerID, err := p.getHandlerID()
-	if err != nil {
-		p.LogError(err.Error())
-	}
-	if handlerID == "" && state != nil {
-		handlerID = state.NodeID
-	}
+	handlerID := p.getCallHandlerID(state)
 
 	p.wsReader(us, handlerID)
 
@@ -845,6 +1026,21 @@ func (p *Plugin) WebSocketMessageHasBeenPosted(connID, userID string, req *model
 			return
 		}
 		msg.Data = []byte(msgData)
+	case clientMessageTypeStats:
+		msgData, ok := req.Data["data"].(string)
+		if !ok {
+			p.LogError("invalid or missing stats data")
+			return
+		}
+		msg.Data = []byte(msgData)
+	case clientMessageTypeHostMute, clientMessageTypeHostLowerHand, clientMessageTypeHostScreenOff, clientMessageTypeHostRemove,
+		clientMessageTypeHostAdmit, clientMessageTypeHostReject:
+		msgData, ok := req.Data["data"].(string)
+		if !ok {
+			p.LogError("invalid or missing host action data")
+			return
+		}
+		msg.Data = []byte(msgData)
 
 	}
 
@@ -856,9 +1052,9 @@ func (p *Plugin) WebSocketMessageHasBeenPosted(connID, userID string, req *model
 	}
 }
 
-func (p *Plugin) closeRTCSession(userID, connID, channelID, handlerID string) error {
+func (p *Plugin) closeRTCSession(userID, connID, channelID, handlerID string, isRTCD bool) error {
 	p.LogDebug("closeRTCSession", "userID", userID, "connID", connID, "channelID", channelID)
-	if p.rtcServer != nil {
+	if !isRTCD {
 		if handlerID == p.nodeID {
 			if err := p.rtcServer.CloseSession(connID); err != nil {
 				return err
@@ -873,7 +1069,7 @@ func (p *Plugin) closeRTCSession(userID, connID, channelID, handlerID string) er
 				return err
 			}
 		}
-	} else if p.rtcdManager != nil {
+	} else {
 		msg := rtcd.ClientMessage{
 			Type: rtcd.ClientMessageLeave,
 			Data: map[string]string{
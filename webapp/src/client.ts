@@ -214,9 +214,7 @@ export default class CallsClient extends EventEmitter {
             }
         });
 
-        ws.on('join', async () => {
-            logDebug('join ack received, initializing connection');
-
+        const initPeer = () => {
             const peer = new RTCPeer({
                 iceServers: this.config.iceServers || [],
                 logger: {
@@ -252,6 +250,10 @@ export default class CallsClient extends EventEmitter {
 
             peer.on('error', (err) => {
                 logErr('peer error', err);
+                if (this.peer !== peer) {
+                    // The peer was replaced after the call got migrated.
+                    return;
+                }
                 if (!this.closed) {
                     this.disconnect(rtcPeerErr);
                 }
@@ -276,16 +278,58 @@ export default class CallsClient extends EventEmitter {
 
             peer.on('connect', () => {
                 logDebug('rtc connected');
+                if (this.connected) {
+                    // Reconnected to a new host after the call got migrated.
+                    return;
+                }
                 this.emit('connect');
                 this.connected = true;
             });
 
             peer.on('close', () => {
                 logDebug('rtc closed');
+                if (this.peer !== peer) {
+                    return;
+                }
                 if (!this.closed) {
                     this.disconnect(rtcPeerCloseErr);
                 }
             });
+
+            return peer;
+        };
+
+        ws.on('join', async () => {
+            logDebug('join ack received, initializing connection');
+            initPeer();
+        });
+
+        ws.on('migrated', async () => {
+            if (!this.peer || this.closed) {
+                return;
+            }
+
+            logDebug('call migrated to a new rtc host, renegotiating connection');
+
+            // Screen sharing needs to be started again by the user once the
+            // new connection is up.
+            this.unshareScreen();
+
+            const prevPeer = this.peer;
+            this.peer = null;
+            prevPeer.destroy();
+
+            this.remoteVoiceTracks = [];
+            this.remoteScreenTrack = null;
+            this.voiceTrackAdded = false;
+
+            const peer = initPeer();
+
+            if (this.audioTrack && this.stream && this.audioTrack.enabled) {
+                logDebug('adding track to peer', this.audioTrack.id, this.stream.id);
+                await peer.addTrack(this.audioTrack, this.stream);
+                this.voiceTrackAdded = true;
+            }
         });
 
         ws.on('message', async ({data}) => {
@@ -78,7 +78,12 @@ const PostType = ({
         </>
     ) : null;
 
-    const subMessage = post.props.end_at ? (
+    const expired = Boolean(post.props.scheduled_call_expired);
+
+    // The post was created ahead of a scheduled call that hasn't started yet.
+    const scheduled = Boolean(post.props.scheduled_call_pending) && !post.props.end_at;
+
+    let subMessage = post.props.end_at ? (
         <>
             <Duration>
                 {formatMessage({defaultMessage: 'Ended at {endTime}'}, {endTime: moment(post.props.end_at).format('h:mm A')})}
@@ -93,10 +98,26 @@ const PostType = ({
         <Duration>{moment(post.props.start_at).fromNow()}</Duration>
     );
 
+    if (scheduled) {
+        subMessage = (
+            <Duration>
+                {formatMessage({defaultMessage: 'Starts at {startTime}'}, {startTime: moment(post.props.start_at).format('h:mm A')})}
+            </Duration>
+        );
+    }
+
+    if (expired) {
+        subMessage = (
+            <Duration>
+                {formatMessage({defaultMessage: 'Scheduled for {startTime}'}, {startTime: moment(post.props.start_at).format('h:mm A')})}
+            </Duration>
+        );
+    }
+
     let joinButton = (
         <JoinButton onClick={onJoinCallClick}>
             <CallIcon fill='var(--center-channel-bg)'/>
-            <ButtonText>{formatMessage({defaultMessage: 'Join call'})}</ButtonText>
+            <ButtonText>{scheduled ? formatMessage({defaultMessage: 'Start call'}) : formatMessage({defaultMessage: 'Join call'})}</ButtonText>
         </JoinButton>
     );
 
@@ -146,8 +167,14 @@ const PostType = ({
             <Main data-testid={'call-thread'}>
                 <SubMain ended={Boolean(post.props.end_at)}>
                     <Left>
-                        <CallIndicator ended={Boolean(post.props.end_at)}>
-                            {!post.props.end_at &&
+                        <CallIndicator ended={Boolean(post.props.end_at) || scheduled}>
+                            {scheduled &&
+                                <CallIcon
+                                    fill={'rgba(var(--center-channel-color-rgb), 0.56)'}
+                                    style={{width: '100%', height: '100%'}}
+                                />
+                            }
+                            {!post.props.end_at && !scheduled &&
                                 <ActiveCallIcon
                                     fill='var(--center-channel-bg)'
                                     style={{width: '100%', height: '100%'}}
@@ -162,12 +189,18 @@ const PostType = ({
                         </CallIndicator>
                         <MessageWrapper>
                             <Message>
-                                { !post.props.end_at &&
+                                { scheduled &&
+                                    formatMessage({defaultMessage: 'Scheduled call'})
+                                }
+                                { !post.props.end_at && !scheduled &&
                                     formatMessage({defaultMessage: '{user} started a call'}, {user: getUserDisplayName(user)})
                                 }
-                                { post.props.end_at &&
+                                { post.props.end_at && !expired &&
                                     formatMessage({defaultMessage: 'Call ended'})
                                 }
+                                { expired &&
+                                    formatMessage({defaultMessage: 'Scheduled call was not started'})
+                                }
                             </Message>
                             <SubMessage>{subMessage}</SubMessage>
                         </MessageWrapper>
@@ -175,16 +208,18 @@ const PostType = ({
                     <Right>
                         {callActive &&
                             <>
-                                <Profiles>
-                                    <ConnectedProfiles
-                                        profiles={profiles}
-                                        pictures={pictures}
-                                        size={32}
-                                        fontSize={12}
-                                        border={true}
-                                        maxShowedProfiles={2}
-                                    />
-                                </Profiles>
+                                {!scheduled &&
+                                    <Profiles>
+                                        <ConnectedProfiles
+                                            profiles={profiles}
+                                            pictures={pictures}
+                                            size={32}
+                                            fontSize={12}
+                                            border={true}
+                                            maxShowedProfiles={2}
+                                        />
+                                    </Profiles>
+                                }
                                 {button}
                             </>
                         }
@@ -0,0 +1,25 @@
+import React from 'react';
+import {useSelector} from 'react-redux';
+import {FormattedMessage} from 'react-intl';
+
+import {GlobalState} from '@mattermost/types/store';
+import {Post} from '@mattermost/types/posts';
+
+import {getUser} from 'mattermost-redux/selectors/entities/users';
+
+import {getUserDisplayName} from 'src/utils';
+
+interface Props {
+    post: Post,
+}
+
+export const PostTypeMissedCall = ({post}: Props) => {
+    const caller = useSelector((state: GlobalState) => getUser(state, post.props?.caller_id));
+
+    return (
+        <FormattedMessage
+            defaultMessage={'Missed call from {caller}'}
+            values={{caller: getUserDisplayName(caller)}}
+        />
+    );
+};
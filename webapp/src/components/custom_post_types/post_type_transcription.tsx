@@ -0,0 +1,8 @@
+import React from 'react';
+import {FormattedMessage} from 'react-intl';
+
+export const PostTypeTranscription = () => {
+    return (
+        <FormattedMessage defaultMessage={'Here\'s the call transcription'}/>
+    );
+};
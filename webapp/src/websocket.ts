@@ -134,6 +134,10 @@ export class WebSocketClient extends EventEmitter {
                 this.emit('join');
             }
 
+            if (msg.event === this.eventPrefix + '_call_rtc_migrated') {
+                this.emit('migrated');
+            }
+
             if (msg.event === this.eventPrefix + '_error') {
                 this.emit('error', new WebSocketError(WebSocketErrorType.Join, msg.data.data));
             }
@@ -172,6 +176,7 @@ export class WebSocketClient extends EventEmitter {
             this.removeAllListeners('open');
             this.removeAllListeners('event');
             this.removeAllListeners('join');
+            this.removeAllListeners('migrated');
             this.removeAllListeners('close');
             this.removeAllListeners('error');
             this.removeAllListeners('message');